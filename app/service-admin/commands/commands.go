@@ -0,0 +1,23 @@
+// Package commands contains the functionality for the set of commands
+// currently supported by the CLI tooling.
+package commands
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrHelp provides context that help was given or the arguments were
+// invalid so the caller can exit with a usage status.
+var ErrHelp = errors.New("provided help")
+
+// AuthConfig holds the settings needed to sign tokens the way the service
+// does.
+type AuthConfig struct {
+	KeysFolder string
+	ActiveKID  string
+	Algorithm  string
+}
+
+// timeout bounds how long a single command can take against the database.
+const timeout = time.Minute
@@ -0,0 +1,100 @@
+package commands
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dapperauteur/go-base-service/business/auth"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// keygenUsage describes the arguments of the keygen command.
+const keygenUsage = "help: keygen [algorithm] [--kid=KID]"
+
+// KeyGen generates a private key for the signing algorithm in args, or the
+// configured algorithm when none is given, and writes it to the keys folder
+// as <kid>.pem so the service picks it up. The kid is random unless --kid is
+// set. The type of key follows the algorithm as auth.GenerateKey describes.
+func KeyGen(keysFolder string, algorithm string, args []string) error {
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		algorithm, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	kid := fs.String("kid", "", "key id to use instead of a random one")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		fmt.Println(keygenUsage)
+		return ErrHelp
+	}
+
+	// The kid names the key file so it can't hold a path.
+	if *kid == "" {
+		*kid = uuid.New().String()
+	}
+	if strings.ContainsAny(*kid, `/\`) || strings.HasPrefix(*kid, ".") || strings.TrimSpace(*kid) != *kid {
+		return errors.Errorf("invalid kid %q", *kid)
+	}
+
+	// Generate a new private key.
+	privateKey, err := auth.GenerateKey(algorithm)
+	if err != nil {
+		return errors.Wrap(err, "generating key")
+	}
+
+	// Construct a PEM block for the private key. RSA keys keep the PKCS1
+	// form used so far, every other key type is stored as PKCS8.
+	var privateBlock pem.Block
+	if rsaKey, ok := privateKey.(*rsa.PrivateKey); ok {
+		privateBlock = pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(rsaKey),
+		}
+	} else {
+		der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			return errors.Wrap(err, "marshaling private key")
+		}
+		privateBlock = pem.Block{
+			Type:  "PRIVATE KEY",
+			Bytes: der,
+		}
+	}
+
+	// Create a file for the private key information in PEM form. Only the
+	// private key is written since the folder must hold private keys only;
+	// the public key is served by the JWKS endpoint.
+	if err := os.MkdirAll(keysFolder, 0700); err != nil {
+		return errors.Wrap(err, "creating keys folder")
+	}
+	path := filepath.Join(keysFolder, *kid+".pem")
+
+	privateFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return errors.Wrap(err, "creating private file")
+	}
+	defer privateFile.Close()
+
+	// Write the private key to the private key file.
+	if err := pem.Encode(privateFile, &privateBlock); err != nil {
+		return errors.Wrap(err, "encoding to private file")
+	}
+
+	fmt.Println("private key file generated")
+	fmt.Println("kid :", *kid)
+	fmt.Println("file:", path)
+	fmt.Println()
+	fmt.Println("to sign new tokens with this key, either write the kid to the active file")
+	fmt.Printf("  echo %s > %s\n", *kid, filepath.Join(keysFolder, auth.ActiveFile))
+	fmt.Println("and send SIGHUP to a running service, or start the service with")
+	fmt.Printf("  SERVICE_AUTH_ACTIVEKID=%s\n", *kid)
+	return nil
+}
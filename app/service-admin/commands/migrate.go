@@ -0,0 +1,133 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dapperauteur/go-base-service/business/data/schema"
+	"github.com/dapperauteur/go-base-service/foundation/database"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// migrateUsage describes the arguments of the migrate command.
+const migrateUsage = "help: migrate [status | up [--to=VERSION] [--dry-run] | down --to=VERSION [--dry-run]]"
+
+// Migrate creates, inspects or rolls back the schema in the database. With
+// no arguments every pending migration is applied.
+func Migrate(cfg database.Config, args []string) error {
+	action := "up"
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("migrate "+action, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	to := fs.String("to", "", "version to migrate to")
+	dryRun := fs.Bool("dry-run", false, "print the SQL instead of running it")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		fmt.Println(migrateUsage)
+		return ErrHelp
+	}
+
+	var opts schema.Options
+	opts.DryRun = *dryRun
+	opts.Out = os.Stdout
+	if *to != "" {
+		version, err := strconv.Atoi(*to)
+		if err != nil || version < 0 {
+			fmt.Println(migrateUsage)
+			return ErrHelp
+		}
+		opts.To = version
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return errors.Wrap(err, "connect database")
+	}
+	defer db.Close()
+
+	// Migrations aren't bounded by a timeout since they can take as long as
+	// the tables they change are large.
+	ctx := context.Background()
+
+	switch action {
+	case "status":
+		return migrateStatus(ctx, db)
+
+	case "up":
+		applied, err := schema.Up(ctx, db, opts)
+		if err != nil {
+			return errors.Wrap(err, "migrate database")
+		}
+		if !opts.DryRun {
+			fmt.Printf("migrations complete: %d applied\n", len(applied))
+		}
+		return nil
+
+	case "down":
+
+		// Rolling back everything must be asked for explicitly with --to=0.
+		if *to == "" {
+			fmt.Println(migrateUsage)
+			return ErrHelp
+		}
+		reverted, err := schema.Down(ctx, db, opts)
+		if err != nil {
+			return errors.Wrap(err, "roll back database")
+		}
+		if !opts.DryRun {
+			fmt.Printf("rollback complete: %d reverted\n", len(reverted))
+		}
+		return nil
+	}
+
+	fmt.Println(migrateUsage)
+	return ErrHelp
+}
+
+// migrateStatus writes the state of every migration as a table. It fails
+// when an applied migration was edited so deploy jobs can catch it.
+func migrateStatus(ctx context.Context, db *sqlx.DB) error {
+	statuses, err := schema.Status(ctx, db)
+	if err != nil {
+		return errors.Wrap(err, "migration status")
+	}
+
+	var modified int
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tDESCRIPTION\tSTATE\tAPPLIED")
+	for _, ms := range statuses {
+		state := "pending"
+		switch {
+		case ms.Unknown:
+			state = "unknown"
+		case ms.ChecksumMismatch:
+			state = "modified"
+			modified++
+		case ms.Applied:
+			state = "applied"
+		}
+
+		applied := "-"
+		if ms.Applied {
+			applied = ms.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", ms.Version, ms.Description, state, applied)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if modified > 0 {
+		return errors.Wrapf(schema.ErrChecksumMismatch, "%d migrations", modified)
+	}
+	return nil
+}
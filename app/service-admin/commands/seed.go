@@ -0,0 +1,30 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/dapperauteur/go-base-service/business/data/schema"
+	"github.com/dapperauteur/go-base-service/foundation/database"
+	"github.com/pkg/errors"
+)
+
+// Seed loads the named set of data into the database. The dev set is used
+// when no name is provided.
+func Seed(cfg database.Config, name string) error {
+	if name == "" {
+		name = schema.SeedDev
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return errors.Wrap(err, "connect database")
+	}
+	defer db.Close()
+
+	if err := schema.Seed(db, name); err != nil {
+		return errors.Wrap(err, "seed database")
+	}
+
+	fmt.Printf("seed data complete: %s\n", name)
+	return nil
+}
@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dapperauteur/go-base-service/business/auth"
+	"github.com/dapperauteur/go-base-service/business/data/user"
+	"github.com/dapperauteur/go-base-service/foundation/database"
+	"github.com/dapperauteur/go-base-service/foundation/logger"
+	"github.com/pkg/errors"
+)
+
+// TokenGen generates a JWT for the specified user. An empty kid signs the
+// token with the active key.
+func TokenGen(traceID string, log *logger.Logger, cfg database.Config, authCfg AuthConfig, email string, kid string) error {
+	if email == "" {
+		fmt.Println("help: tokengen <email> [kid]")
+		return ErrHelp
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return errors.Wrap(err, "connect database")
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	keys, err := auth.LoadKeys(authCfg.KeysFolder)
+	if err != nil {
+		return errors.Wrap(err, "loading auth keys")
+	}
+
+	activeKID, err := auth.ActiveKID(authCfg.KeysFolder, keys, authCfg.ActiveKID)
+	if err != nil {
+		return errors.Wrap(err, "selecting active key")
+	}
+
+	a, err := auth.New(authCfg.Algorithm, nil, keys)
+	if err != nil {
+		return errors.Wrap(err, "constructing auth")
+	}
+
+	if err := a.SetActiveKID(activeKID); err != nil {
+		return errors.Wrap(err, "setting active key")
+	}
+
+	u := user.New(log, db)
+
+	// The lookup is done on behalf of the admin running the tool.
+	admin := auth.Claims{
+		Roles:  []string{auth.RoleAdmin},
+		Scopes: auth.Permissions,
+	}
+	usr, err := u.QueryByEmail(ctx, traceID, admin, email)
+	if err != nil {
+		return errors.Wrap(err, "retrieve user")
+	}
+
+	claims, err := u.ClaimsByID(ctx, traceID, time.Now(), usr.ID)
+	if err != nil {
+		return errors.Wrap(err, "building claims")
+	}
+
+	token, err := a.GenerateToken(kid, claims)
+	if err != nil {
+		return errors.Wrap(err, "generating token")
+	}
+
+	fmt.Printf("-----BEGIN TOKEN-----\n%s\n-----END TOKEN-----\n", token)
+	return nil
+}
@@ -0,0 +1,40 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dapperauteur/go-base-service/business/data/token"
+	"github.com/dapperauteur/go-base-service/foundation/database"
+	"github.com/dapperauteur/go-base-service/foundation/logger"
+	"github.com/pkg/errors"
+)
+
+// tokensUsage describes the arguments of the tokens command.
+const tokensUsage = "help: tokens purge"
+
+// Tokens runs the tokens subcommand specified by args.
+func Tokens(traceID string, log *logger.Logger, cfg database.Config, args []string) error {
+	if len(args) != 1 || args[0] != "purge" {
+		fmt.Println(tokensUsage)
+		return ErrHelp
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return errors.Wrap(err, "connect database")
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	n, err := token.New(log, db).PurgeDenied(ctx, traceID, time.Now())
+	if err != nil {
+		return errors.Wrap(err, "purge denylist")
+	}
+
+	fmt.Printf("%d expired access tokens removed from the denylist\n", n)
+	return nil
+}
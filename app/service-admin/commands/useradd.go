@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dapperauteur/go-base-service/business/auth"
+	"github.com/dapperauteur/go-base-service/business/data/user"
+	"github.com/dapperauteur/go-base-service/foundation/database"
+	"github.com/dapperauteur/go-base-service/foundation/logger"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// UserAdd adds a new user to the database. Roles are a comma separated list
+// and default to USER.
+func UserAdd(traceID string, log *logger.Logger, cfg database.Config, name string, email string, password string, roles string) error {
+	if name == "" || email == "" || password == "" {
+		fmt.Println("help: useradd <name> <email> <password> [roles]")
+		return ErrHelp
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return errors.Wrap(err, "connect database")
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	nu := user.NewUser{
+		Name:            name,
+		Email:           email,
+		Password:        password,
+		PasswordConfirm: password,
+		Roles:           []string{auth.RoleUser},
+	}
+	if roles != "" {
+		nu.Roles = strings.Split(roles, ",")
+	}
+
+	// The user is created on behalf of the admin running the tool.
+	admin := auth.Claims{
+		Roles:  []string{auth.RoleAdmin},
+		Scopes: auth.Permissions,
+	}
+	admin.Subject = actor
+
+	// The user and its audit event are committed together.
+	var usr user.Info
+	err = database.WithTx(ctx, db, func(tx *sqlx.Tx) error {
+		var err error
+		usr, err = user.New(log, tx).Create(ctx, traceID, admin, nu, time.Now())
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "create user")
+	}
+
+	fmt.Println("user id:", usr.ID)
+	return nil
+}
@@ -0,0 +1,174 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dapperauteur/go-base-service/business/auth"
+	"github.com/dapperauteur/go-base-service/business/data/product"
+	"github.com/dapperauteur/go-base-service/business/data/user"
+	"github.com/dapperauteur/go-base-service/foundation/database"
+	"github.com/dapperauteur/go-base-service/foundation/logger"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// actor names the admin tool in the audit log.
+const actor = "service-admin"
+
+// usersUsage describes the arguments of the users command.
+const usersUsage = "help: users [list [page] [rows] | purge --older-than=DURATION [--reassign-to=USER_ID] [--dry-run]]"
+
+// Users runs the users subcommand specified by args.
+func Users(traceID string, log *logger.Logger, cfg database.Config, args []string) error {
+	if len(args) == 0 {
+		fmt.Println(usersUsage)
+		return ErrHelp
+	}
+
+	switch args[0] {
+	case "list":
+		return usersList(traceID, log, cfg, args[1:])
+	case "purge":
+		return usersPurge(traceID, log, cfg, args[1:])
+	}
+
+	fmt.Println(usersUsage)
+	return ErrHelp
+}
+
+// usersList writes a page of users as a table.
+func usersList(traceID string, log *logger.Logger, cfg database.Config, args []string) error {
+	page, rows := 1, 50
+
+	var err error
+	if len(args) > 0 {
+		if page, err = strconv.Atoi(args[0]); err != nil || page < 1 {
+			fmt.Println(usersUsage)
+			return ErrHelp
+		}
+	}
+	if len(args) > 1 {
+		if rows, err = strconv.Atoi(args[1]); err != nil || rows < 1 {
+			fmt.Println(usersUsage)
+			return ErrHelp
+		}
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return errors.Wrap(err, "connect database")
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	u := user.New(log, db)
+	users, err := u.Query(ctx, traceID, user.QueryFilter{}, user.DefaultOrderBy, page, rows)
+	if err != nil {
+		return errors.Wrap(err, "query users")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tEMAIL\tROLES\tCREATED")
+	for _, usr := range users {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", usr.ID, usr.Name, usr.Email, strings.Join(usr.Roles, ","), usr.DateCreated.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+// usersPurge permanently removes users deleted longer ago than --older-than.
+// Their products, and the sales of those products, are removed with them
+// unless --reassign-to names a user to hand the products to. Everything
+// happens in one transaction.
+func usersPurge(traceID string, log *logger.Logger, cfg database.Config, args []string) error {
+	fs := flag.NewFlagSet("users purge", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	olderThan := fs.Duration("older-than", 0, "how long users must have been deleted")
+	reassignTo := fs.String("reassign-to", "", "user to give the products of purged users to")
+	dryRun := fs.Bool("dry-run", false, "list the users instead of purging them")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 || *olderThan <= 0 {
+		fmt.Println(usersUsage)
+		return ErrHelp
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return errors.Wrap(err, "connect database")
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	now := time.Now()
+
+	// The purge and its audit events are committed together.
+	err = database.WithTx(ctx, db, func(tx *sqlx.Tx) error {
+		u := user.New(log, tx)
+		p := product.New(log, tx)
+
+		// The new owner must be a live user or the products end up orphaned.
+		// The lookup is done on behalf of the admin running the tool.
+		if *reassignTo != "" {
+			admin := auth.Claims{
+				Roles:  []string{auth.RoleAdmin},
+				Scopes: auth.Permissions,
+			}
+			if _, err := u.QueryByID(ctx, traceID, admin, *reassignTo); err != nil {
+				return errors.Wrapf(err, "reassign to user %s", *reassignTo)
+			}
+		}
+
+		users, err := u.QueryDeleted(ctx, traceID, now.Add(-*olderThan))
+		if err != nil {
+			return errors.Wrap(err, "query deleted users")
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tEMAIL\tDELETED\tPRODUCTS")
+		for _, usr := range users {
+			var n int
+			switch {
+			case *dryRun:
+				fmt.Fprintf(w, "%s\t%s\t%s\t-\n", usr.ID, usr.Email, usr.DeletedAt.Format(time.RFC3339))
+				continue
+			case *reassignTo != "":
+				n, err = p.Reassign(ctx, traceID, actor, usr.ID, *reassignTo, now)
+			default:
+				n, err = p.DeleteByOwner(ctx, traceID, actor, usr.ID, now)
+			}
+			if err != nil {
+				return errors.Wrapf(err, "products of user %s", usr.ID)
+			}
+
+			if err := u.Purge(ctx, traceID, actor, usr.ID, now); err != nil {
+				return errors.Wrapf(err, "purge user %s", usr.ID)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", usr.ID, usr.Email, usr.DeletedAt.Format(time.RFC3339), n)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		switch {
+		case *dryRun:
+			fmt.Printf("%d users would be purged\n", len(users))
+		case *reassignTo != "":
+			fmt.Printf("%d users purged, products reassigned to %s\n", len(users), *reassignTo)
+		default:
+			fmt.Printf("%d users purged with their products\n", len(users))
+		}
+		return nil
+	})
+
+	return err
+}
@@ -1,161 +1,151 @@
 package main
 
 import (
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
 	"fmt"
-	"io/ioutil"
-	"log"
 	"os"
-	"time"
+	"text/tabwriter"
 
+	"github.com/ardanlabs/conf"
+	"github.com/dapperauteur/go-base-service/app/service-admin/commands"
 	"github.com/dapperauteur/go-base-service/business/data/schema"
 	"github.com/dapperauteur/go-base-service/foundation/database"
-	"github.com/dgrijalva/jwt-go"
+	"github.com/dapperauteur/go-base-service/foundation/logger"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
 )
 
-/*
-	openssl genpkey -algorithm RSA -out private.pem -pkeyopt rsa_keygen_bits:2048
-	openssl rsa -pubout -in private.pem -out public.pem
-*/
+// build is the git version of this program. It is set using build flags in the makefile.
+var build = "develop"
 
-func main() {
-	// keygen()
-
-	// tokengen()
-	migrate()
-
-}
-
-func migrate() {
-
-	dbConfig := database.Config{
-		User:       "postgres",
-		Password:   "postgres",
-		Host:       "0.0.0.0",
-		Name:       "postgres",
-		DisableTLS: true,
-	}
-
-	db, err := database.Open(dbConfig)
-	if err != nil {
-		log.Fatalln(err)
-	}
-	defer db.Close()
-
-	if err := schema.Migrate(db); err != nil {
-		log.Fatalln(err)
-	}
+// Exit codes returned to the shell so scripts can tell a failed command from
+// a command that was called incorrectly.
+const (
+	exitFailure = 1
+	exitUsage   = 2
+)
 
-	fmt.Println("migrations complete")
+func main() {
+	log := logger.New(os.Stderr, "ADMIN", logger.LevelWarn)
 
-	if err := schema.Seed(db); err != nil {
-		log.Fatalln(err)
+	if err := run(log); err != nil {
+		if errors.Cause(err) == commands.ErrHelp {
+			os.Exit(exitUsage)
+		}
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(exitFailure)
 	}
-
-	fmt.Println("seed data complete")
 }
 
-func tokengen() {
-	privatePEM, err := ioutil.ReadFile("/Users/awe/Coding/repos/my-repos/go-base-service/private.pem")
-	if err != nil {
-		log.Fatalln(err)
+func run(log *logger.Logger) error {
+
+	// =========================================================================
+	// Configuration
+
+	// The settings are shared with service-api so both read the same
+	// SERVICE_ environment variables.
+	var cfg struct {
+		conf.Version
+		Args conf.Args
+		Auth struct {
+			KeysFolder string `conf:"default:zarf/keys/"`
+			ActiveKID  string
+			Algorithm  string `conf:"default:RS256"`
+		}
+		DB struct {
+			User       string `conf:"default:postgres"`
+			Password   string `conf:"default:postgres,noprint"`
+			Host       string `conf:"default:db"`
+			Name       string `conf:"default:postgres"`
+			DisableTLS bool   `conf:"default:true"`
+		}
+	}
+	cfg.Version.SVN = build
+	cfg.Version.Desc = "copyright information here"
+
+	const prefix = "SERVICE"
+	if err := conf.Parse(os.Args[1:], prefix, &cfg); err != nil {
+		switch err {
+		case conf.ErrHelpWanted:
+			usage, err := conf.Usage(prefix, &cfg)
+			if err != nil {
+				return errors.Wrap(err, "generating config usage")
+			}
+			fmt.Println(usage)
+			printCommands()
+			return nil
+		case conf.ErrVersionWanted:
+			version, err := conf.VersionString(prefix, &cfg)
+			if err != nil {
+				return errors.Wrap(err, "generating config version")
+			}
+			fmt.Println(version)
+			return nil
+		}
+		return errors.Wrap(err, "parsing config")
+	}
+
+	// =========================================================================
+	// Commands
+
+	if err := schema.Validate(); err != nil {
+		return errors.Wrap(err, "validating schema")
 	}
 
-	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
-	if err != nil {
-		log.Fatalln(err)
+	dbConfig := database.Config{
+		User:       cfg.DB.User,
+		Password:   cfg.DB.Password,
+		Host:       cfg.DB.Host,
+		Name:       cfg.DB.Name,
+		DisableTLS: cfg.DB.DisableTLS,
 	}
 
-	// iss (issuer): Issuer of the JWT
-	// sub (subject): Subject of the JWT (the user)
-	// aud (audience): Recipient for which the JWT is intended
-	// exp (expiration time): Time after which the JWT expires
-	// nbf (not before time): Time before which the JWT must not be accepted for processing
-	// iat (issued at time): Time at which the JWT was issued; can be used to determine age of the JWT
-	// jti (JWT ID): Unique identifier; can be used to prevent the JWT from being replayed (allows a token to be used only once)
-	claims := struct {
-		jwt.StandardClaims
-		Roles []string `json:"roles"`
-	}{
-		StandardClaims: jwt.StandardClaims{
-			Issuer:    "go-base-service project",
-			Subject:   "12343589",
-			ExpiresAt: time.Now().Add(8760 * time.Hour).Unix(),
-			IssuedAt:  time.Now().Unix(),
-		},
-		Roles: []string{"ADMIN"},
+	authConfig := commands.AuthConfig{
+		KeysFolder: cfg.Auth.KeysFolder,
+		ActiveKID:  cfg.Auth.ActiveKID,
+		Algorithm:  cfg.Auth.Algorithm,
 	}
 
-	method := jwt.GetSigningMethod("RS256")
-	token := jwt.NewWithClaims(method, claims)
-	// token.Header["kid"] = "a.publicKID"
-	token.Header["kid"] = "54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"
+	traceID := uuid.New().String()
 
-	str, err := token.SignedString(privateKey)
-	if err != nil {
-		log.Fatalln(err)
-	}
+	switch cfg.Args.Num(0) {
+	case "migrate":
+		return commands.Migrate(dbConfig, cfg.Args[1:])
 
-	fmt.Println("***** START TOKEN *****")
-	fmt.Println(str)
-	fmt.Println("***** END TOKEN *****")
-}
+	case "seed":
+		return commands.Seed(dbConfig, cfg.Args.Num(1))
 
-func keygen() {
+	case "keygen":
+		return commands.KeyGen(cfg.Auth.KeysFolder, cfg.Auth.Algorithm, cfg.Args[1:])
 
-	// Generate a new private key.
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		log.Fatalln(err)
-	}
+	case "tokengen":
+		return commands.TokenGen(traceID, log, dbConfig, authConfig, cfg.Args.Num(1), cfg.Args.Num(2))
 
-	// Create a file for the private key information in PEM form.
-	privateFile, err := os.Create("private.pem")
-	if err != nil {
-		log.Fatalln(err)
-	}
-	defer privateFile.Close()
+	case "useradd":
+		return commands.UserAdd(traceID, log, dbConfig, cfg.Args.Num(1), cfg.Args.Num(2), cfg.Args.Num(3), cfg.Args.Num(4))
 
-	// Construct a PEM block for the private key.
-	privateBlock := pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
-	}
+	case "users":
+		return commands.Users(traceID, log, dbConfig, cfg.Args[1:])
 
-	// Write the private key to the private key file.
-	if err := pem.Encode(privateFile, &privateBlock); err != nil {
-		log.Fatalln(err)
+	case "tokens":
+		return commands.Tokens(traceID, log, dbConfig, cfg.Args[1:])
 	}
 
-	// ================================
-
-	// Marshal the public key from the private key to PKIX.
-	asn1Bytes, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
-	if err != nil {
-		log.Fatalln(err)
-	}
-
-	// Create a file for the public key information in PEM form.
-	publicFile, err := os.Create("public.pem")
-	if err != nil {
-		log.Fatalln(err)
-	}
-	defer publicFile.Close()
-
-	// Construct a PEM block for the public key.
-	publicBlock := pem.Block{
-		Type:  "RSA PUBLIC KEY",
-		Bytes: asn1Bytes,
-	}
-
-	// Write the public key to the private key file.
-	if err := pem.Encode(publicFile, &publicBlock); err != nil {
-		log.Fatalln(err)
-	}
+	printCommands()
+	return commands.ErrHelp
+}
 
-	fmt.Println("private and public key files generated")
-	return
+// printCommands writes the set of supported commands.
+func printCommands() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "Commands:")
+	fmt.Fprintln(w, "  migrate [status | up [--to=VERSION] [--dry-run]]\tshow or apply schema migrations")
+	fmt.Fprintln(w, "  migrate down --to=VERSION [--dry-run]\troll back schema migrations")
+	fmt.Fprintln(w, "  seed [dev | demo | test]\tadd a named set of data to the database")
+	fmt.Fprintln(w, "  keygen [algorithm] [--kid=KID]\tgenerate a private key in the keys folder")
+	fmt.Fprintln(w, "  tokengen <email> [kid]\tgenerate a token for a user")
+	fmt.Fprintln(w, "  useradd <name> <email> <password> [roles]\tadd a user")
+	fmt.Fprintln(w, "  users list [page] [rows]\tlist users")
+	fmt.Fprintln(w, "  users purge --older-than=DURATION [--reassign-to=USER_ID] [--dry-run]\tremove deleted users and their products for good")
+	fmt.Fprintln(w, "  tokens purge\tremove expired access tokens from the denylist")
+	w.Flush()
 }
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dapperauteur/go-base-service/business/data/audit"
+	"github.com/dapperauteur/go-base-service/foundation/web"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type auditGroup struct {
+	audit audit.Audit
+}
+
+// query returns the newest audit events. The entity is a type like user,
+// optionally followed by :id to get the history of a single entity. Since is
+// RFC3339 or YYYY-MM-DD.
+func (ag auditGroup) query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.auditGroup.query")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	qs := r.URL.Query()
+
+	filter := audit.QueryFilter{
+		Actor: qs.Get("actor"),
+	}
+	if entity := qs.Get("entity"); entity != "" {
+		parts := strings.SplitN(entity, ":", 2)
+		filter.Entity = parts[0]
+		if len(parts) == 2 {
+			filter.EntityID = parts[1]
+		}
+	}
+	if s := qs.Get("since"); s != "" {
+		since, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			if since, err = time.Parse("2006-01-02", s); err != nil {
+				return web.NewRequestError(fmt.Errorf("invalid since format: %s", s), http.StatusBadRequest)
+			}
+		}
+		filter.Since = since
+	}
+
+	limit := 100
+	if s := qs.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 1000 {
+			return web.NewRequestError(fmt.Errorf("invalid limit format: %s", s), http.StatusBadRequest)
+		}
+		limit = n
+	}
+
+	events, err := ag.audit.Query(ctx, v.TraceID, filter, limit)
+	if err != nil {
+		return errors.Wrap(err, "unable to query for audit events")
+	}
+
+	return web.Respond(ctx, w, events, http.StatusOK)
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dapperauteur/go-base-service/business/auth"
+	"github.com/dapperauteur/go-base-service/foundation/web"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type authGroup struct {
+	auth *auth.Auth
+}
+
+// jwks returns the public keys used to verify tokens in JSON Web Key Set
+// format so other services can validate our tokens without sharing secrets.
+func (ag authGroup) jwks(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.authGroup.jwks")
+	defer span.End()
+
+	return web.Respond(ctx, w, ag.auth.JWKS(), http.StatusOK)
+}
+
+// keys returns the ids of the keys currently loaded and the active key so
+// operators can confirm a rotation took effect.
+func (ag authGroup) keys(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.authGroup.keys")
+	defer span.End()
+
+	kids, active := ag.auth.KIDs()
+
+	info := struct {
+		Active string   `json:"active"`
+		KIDs   []string `json:"kids"`
+	}{
+		Active: active,
+		KIDs:   kids,
+	}
+
+	return web.Respond(ctx, w, info, http.StatusOK)
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 
+	"github.com/dapperauteur/go-base-service/business/data/schema"
 	"github.com/dapperauteur/go-base-service/foundation/database"
 	"github.com/dapperauteur/go-base-service/foundation/web"
 	"github.com/jmoiron/sqlx"
@@ -35,6 +36,9 @@ func (cg checkGroup) readiness(ctx context.Context, w http.ResponseWriter, r *ht
 	if err := database.StatusCheck(ctx, cg.db); err != nil {
 		status = "db not ready"
 		statusCode = http.StatusInternalServerError
+	} else if err := schema.CheckVersion(ctx, cg.db); err != nil {
+		status = "schema not ready"
+		statusCode = http.StatusServiceUnavailable
 	}
 
 	health := struct {
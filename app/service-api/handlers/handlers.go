@@ -3,41 +3,156 @@
 package handlers
 
 import (
-	"log"
 	"net/http"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/dapperauteur/go-base-service/business/auth"
+	"github.com/dapperauteur/go-base-service/business/data/audit"
+	"github.com/dapperauteur/go-base-service/business/data/product"
+	"github.com/dapperauteur/go-base-service/business/data/role"
+	"github.com/dapperauteur/go-base-service/business/data/sale"
+	"github.com/dapperauteur/go-base-service/business/data/token"
 	"github.com/dapperauteur/go-base-service/business/data/user"
+	"github.com/dapperauteur/go-base-service/business/link"
 	"github.com/dapperauteur/go-base-service/business/mid"
+	"github.com/dapperauteur/go-base-service/foundation/logger"
+	"github.com/dapperauteur/go-base-service/foundation/mail"
 	"github.com/dapperauteur/go-base-service/foundation/web"
 	"github.com/jmoiron/sqlx"
 )
 
+// APIConfig contains the dependencies of the application routes. Users,
+// audit events and roles are kept in the provided stores so tests can swap
+// Postgres for memory. When DB is set the stores must be the Postgres stores
+// for it, since changes are then written through stores built on a
+// transaction per request to commit together with their audit events.
+// Links to verify an email or reset a password are sent to users through the
+// Mailer. A reset link is the ResetURL with the reset token added as the
+// token query parameter. Work the handlers carry on with after answering a
+// request, like mailing a reset link, is tracked in Background so shutdown can
+// wait for it; it may be left nil when nothing waits.
+type APIConfig struct {
+	Build      string
+	Shutdown   chan os.Signal
+	Log        *logger.Logger
+	Auth       *auth.Auth
+	DB         *sqlx.DB
+	Users      user.Store
+	Audit      audit.Store
+	Roles      role.Store
+	Mailer     mail.Mailer
+	Signup     SignupConfig
+	ResetURL   string
+	Background *sync.WaitGroup
+}
+
+// SignupConfig contains what is needed to let people sign themselves up.
+// The verification link is the VerifyURL with a token signed by the Signer
+// added as the token query parameter. It expires after VerifyTTL.
+type SignupConfig struct {
+	Signer    link.Signer
+	VerifyURL string
+	VerifyTTL time.Duration
+}
+
 // API constructs an http.Handler with all application routes defined.
-func API(build string, shutdown chan os.Signal, log *log.Logger, a *auth.Auth, db *sqlx.DB) *web.App {
+func API(cfg APIConfig) *web.App {
+	log, a, db := cfg.Log, cfg.Auth, cfg.DB
+
+	background := cfg.Background
+	if background == nil {
+		background = &sync.WaitGroup{}
+	}
 
-	app := web.NewApp(shutdown, mid.Logger(log), mid.Errors(log), mid.Panics(log))
+	app := web.NewApp(cfg.Shutdown, mid.Logger(log), mid.Metrics(), mid.Errors(log), mid.Panics(log))
 
 	cg := checkGroup{
-		build: build,
+		build: cfg.Build,
 		db:    db,
 	}
 
 	app.Handle(http.MethodGet, "/readiness", cg.readiness)
 	app.Handle(http.MethodGet, "/liveness", cg.liveness)
-	app.Handle(http.MethodGet, "/testing", cg.liveness, mid.Authenticate(a), mid.Authorize(log, auth.RoleAdmin))
+	app.Handle(http.MethodGet, "/testing", cg.liveness, mid.Authenticate(a), mid.RequirePermission(log, auth.PermTestingRead))
+
+	// Register the public keys used to verify tokens.
+	ag := authGroup{
+		auth: a,
+	}
+	app.Handle(http.MethodGet, "/.well-known/jwks.json", ag.jwks)
+	app.Handle(http.MethodGet, "/auth/keys", ag.keys, mid.Authenticate(a), mid.RequirePermission(log, auth.PermKeysRead))
 
 	// Register user management and authentication endpoints.
 	ug := userGroup{
-		user: user.New(log, db),
-		auth: a,
+		user:       user.NewWithStore(log, cfg.Users, cfg.Audit, cfg.Roles),
+		tokens:     token.New(log, db),
+		auth:       a,
+		log:        log,
+		db:         db,
+		mailer:     cfg.Mailer,
+		signups:    cfg.Signup,
+		resetURL:   cfg.ResetURL,
+		background: background,
 	}
-	app.Handle(http.MethodGet, "/users/:page/:rows", ug.query, mid.Authenticate(a), mid.Authorize(log, auth.RoleAdmin))
+	app.Handle(http.MethodPost, "/signup", ug.signup)
+	app.Handle(http.MethodGet, "/verify", ug.verify)
+	app.Handle(http.MethodPost, "/password/forgot", ug.forgotPassword)
+	app.Handle(http.MethodPost, "/password/reset", ug.resetPassword)
+	app.Handle(http.MethodGet, "/users", ug.queryCursor, mid.Authenticate(a), mid.RequirePermission(log, auth.PermUsersRead))
+	app.Handle(http.MethodGet, "/users/:page/:rows", ug.query, mid.Authenticate(a), mid.RequirePermission(log, auth.PermUsersRead))
+	app.Handle(http.MethodGet, "/users/token", ug.token)
 	app.Handle(http.MethodGet, "/users/token/:kid", ug.token)
+	app.Handle(http.MethodPost, "/users/token/refresh", ug.refresh)
+	app.Handle(http.MethodPost, "/users/token/revoke", ug.revoke, mid.Authenticate(a))
+	app.Handle(http.MethodGet, "/me", ug.queryMe, mid.Authenticate(a))
+	app.Handle(http.MethodPut, "/me", ug.updateMe, mid.Authenticate(a))
+	app.Handle(http.MethodPut, "/me/password", ug.changePassword, mid.Authenticate(a))
 	app.Handle(http.MethodGet, "/users/:id", ug.queryByID, mid.Authenticate(a))
-	app.Handle(http.MethodPost, "/users", ug.create, mid.Authenticate(a), mid.Authorize(log, auth.RoleAdmin))
-	app.Handle(http.MethodPut, "/users/:id", ug.update, mid.Authenticate(a), mid.Authorize(log, auth.RoleAdmin))
-	app.Handle(http.MethodDelete, "/users/:id", ug.delete, mid.Authenticate(a), mid.Authorize(log, auth.RoleAdmin))
+	app.Handle(http.MethodPost, "/users", ug.create, mid.Authenticate(a), mid.RequirePermission(log, auth.PermUsersWrite))
+	app.Handle(http.MethodPut, "/users/:id", ug.update, mid.Authenticate(a), mid.RequirePermission(log, auth.PermUsersWrite))
+	app.Handle(http.MethodDelete, "/users/:id", ug.delete, mid.Authenticate(a), mid.RequirePermission(log, auth.PermUsersWrite))
+	app.Handle(http.MethodPost, "/users/:id/restore", ug.restore, mid.Authenticate(a), mid.RequirePermission(log, auth.PermUsersWrite))
+
+	// Register role management endpoints.
+	rg := roleGroup{
+		role: role.NewWithStore(log, cfg.Roles, cfg.Audit),
+		user: ug.user,
+		log:  log,
+		db:   db,
+	}
+	app.Handle(http.MethodGet, "/roles", rg.query, mid.Authenticate(a), mid.RequirePermission(log, auth.PermRolesRead))
+	app.Handle(http.MethodGet, "/roles/:name", rg.queryByName, mid.Authenticate(a), mid.RequirePermission(log, auth.PermRolesRead))
+	app.Handle(http.MethodPost, "/roles", rg.create, mid.Authenticate(a), mid.RequirePermission(log, auth.PermRolesWrite))
+	app.Handle(http.MethodPut, "/roles/:name", rg.update, mid.Authenticate(a), mid.RequirePermission(log, auth.PermRolesWrite))
+	app.Handle(http.MethodDelete, "/roles/:name", rg.delete, mid.Authenticate(a), mid.RequirePermission(log, auth.PermRolesWrite))
+
+	// Register the audit log.
+	aug := auditGroup{
+		audit: audit.NewWithStore(log, cfg.Audit),
+	}
+	app.Handle(http.MethodGet, "/audit", aug.query, mid.Authenticate(a), mid.RequirePermission(log, auth.PermAuditRead))
+
+	// Register product management endpoints.
+	pg := productGroup{
+		product: product.New(log, db),
+		log:     log,
+		db:      db,
+	}
+	app.Handle(http.MethodGet, "/products/:page/:rows", pg.query, mid.Authenticate(a))
+	app.Handle(http.MethodGet, "/products/:id", pg.queryByID, mid.Authenticate(a))
+	app.Handle(http.MethodPost, "/products", pg.create, mid.Authenticate(a))
+	app.Handle(http.MethodPut, "/products/:id", pg.update, mid.Authenticate(a))
+	app.Handle(http.MethodDelete, "/products/:id", pg.delete, mid.Authenticate(a))
+
+	// Register sale recording endpoints.
+	sg := saleGroup{
+		sale: sale.New(log, db),
+	}
+	app.Handle(http.MethodGet, "/products/:id/sales", sg.query, mid.Authenticate(a))
+	app.Handle(http.MethodPost, "/products/:id/sales", sg.create, mid.Authenticate(a))
+	app.Handle(http.MethodGet, "/reports/sales", sg.report, mid.Authenticate(a))
+
 	return app
 }
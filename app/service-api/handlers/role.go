@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dapperauteur/go-base-service/business/auth"
+	"github.com/dapperauteur/go-base-service/business/data/role"
+	"github.com/dapperauteur/go-base-service/business/data/user"
+	"github.com/dapperauteur/go-base-service/foundation/database"
+	"github.com/dapperauteur/go-base-service/foundation/logger"
+	"github.com/dapperauteur/go-base-service/foundation/web"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type roleGroup struct {
+	role role.Role
+	user user.User
+	log  *logger.Logger
+	db   *sqlx.DB
+}
+
+// write runs fn with a Role and a User whose changes and their audit events
+// are stored in one transaction. Without a database the configured stores are
+// used as they are.
+func (rg roleGroup) write(ctx context.Context, fn func(r role.Role, u user.User) error) error {
+	if rg.db == nil {
+		return fn(rg.role, rg.user)
+	}
+
+	return database.WithTx(ctx, rg.db, func(tx *sqlx.Tx) error {
+		return fn(role.New(rg.log, tx), user.New(rg.log, tx))
+	})
+}
+
+func (rg roleGroup) query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.roleGroup.query")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	roles, err := rg.role.Query(ctx, v.TraceID)
+	if err != nil {
+		return errors.Wrap(err, "unable to query for roles")
+	}
+
+	return web.Respond(ctx, w, roles, http.StatusOK)
+}
+
+func (rg roleGroup) queryByName(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.roleGroup.queryByName")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	params := web.Params(r)
+	rl, err := rg.role.QueryByName(ctx, v.TraceID, params["name"])
+	if err != nil {
+		switch err {
+		case role.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "Name: %s", params["name"])
+		}
+	}
+
+	return web.Respond(ctx, w, rl, http.StatusOK)
+}
+
+func (rg roleGroup) create(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.roleGroup.create")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var nr role.NewRole
+	if err := web.Decode(r, &nr); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	var rl role.Info
+	err := rg.write(ctx, func(roles role.Role, _ user.User) error {
+		var err error
+		rl, err = roles.Create(ctx, v.TraceID, claims, nr, v.Now)
+		return err
+	})
+	if err != nil {
+		switch errors.Cause(err) {
+		case role.ErrUnknownPermission:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case role.ErrExists:
+			return web.NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "Role: %+v", &nr)
+		}
+	}
+
+	return web.Respond(ctx, w, rl, http.StatusCreated)
+}
+
+func (rg roleGroup) update(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.roleGroup.update")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var ur role.UpdateRole
+	if err := web.Decode(r, &ur); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	params := web.Params(r)
+	err := rg.write(ctx, func(roles role.Role, _ user.User) error {
+		return roles.Update(ctx, v.TraceID, claims, params["name"], ur, v.Now)
+	})
+	if err != nil {
+		switch errors.Cause(err) {
+		case role.ErrUnknownPermission:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case role.ErrAdminPermissions:
+			return web.NewRequestError(err, http.StatusForbidden)
+		case role.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "Name: %s  Role: %+v", params["name"], &ur)
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// delete removes a role as long as no user holds it.
+func (rg roleGroup) delete(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.roleGroup.delete")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	err := rg.write(ctx, func(_ role.Role, u user.User) error {
+		return u.DeleteRole(ctx, v.TraceID, claims, params["name"], v.Now)
+	})
+	if err != nil {
+		switch errors.Cause(err) {
+		case role.ErrBuiltIn:
+			return web.NewRequestError(err, http.StatusForbidden)
+		case role.ErrInUse:
+			return web.NewRequestError(err, http.StatusConflict)
+		case role.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "Name: %s", params["name"])
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
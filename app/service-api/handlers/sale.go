@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dapperauteur/go-base-service/business/auth"
+	"github.com/dapperauteur/go-base-service/business/data/sale"
+	"github.com/dapperauteur/go-base-service/foundation/web"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type saleGroup struct {
+	sale sale.Sale
+}
+
+func (sg saleGroup) create(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.saleGroup.create")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var ns sale.NewSale
+	if err := web.Decode(r, &ns); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	params := web.Params(r)
+	sl, err := sg.sale.Create(ctx, v.TraceID, claims, params["id"], ns, v.Now)
+	if err != nil {
+		switch err {
+		case sale.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case sale.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case sale.ErrInsufficientStock:
+			return web.NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "ID: %s  Sale: %+v", params["id"], &ns)
+		}
+	}
+
+	return web.Respond(ctx, w, sl, http.StatusCreated)
+}
+
+func (sg saleGroup) query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.saleGroup.query")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	params := web.Params(r)
+	sales, err := sg.sale.QueryByProduct(ctx, v.TraceID, params["id"])
+	if err != nil {
+		switch err {
+		case sale.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["id"])
+		}
+	}
+
+	return web.Respond(ctx, w, sales, http.StatusOK)
+}
+
+func (sg saleGroup) report(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.saleGroup.report")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	// The range defaults to the last 30 days. Dates are in the form
+	// YYYY-MM-DD and the to date is exclusive.
+	const layout = "2006-01-02"
+	to := v.Now
+	if s := r.URL.Query().Get("to"); s != "" {
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			return web.NewRequestError(fmt.Errorf("invalid to format: %s", s), http.StatusBadRequest)
+		}
+		to = t
+	}
+	from := to.AddDate(0, 0, -30)
+	if s := r.URL.Query().Get("from"); s != "" {
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			return web.NewRequestError(fmt.Errorf("invalid from format: %s", s), http.StatusBadRequest)
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		return web.NewRequestError(errors.New("from must be before to"), http.StatusBadRequest)
+	}
+
+	rpt, err := sg.sale.Report(ctx, v.TraceID, claims, from, to)
+	if err != nil {
+		return errors.Wrap(err, "unable to build sales report")
+	}
+
+	return web.Respond(ctx, w, rpt, http.StatusOK)
+}
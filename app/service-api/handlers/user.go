@@ -4,18 +4,50 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/dapperauteur/go-base-service/business/auth"
+	"github.com/dapperauteur/go-base-service/business/data/token"
 	"github.com/dapperauteur/go-base-service/business/data/user"
+	"github.com/dapperauteur/go-base-service/foundation/database"
+	"github.com/dapperauteur/go-base-service/foundation/logger"
+	"github.com/dapperauteur/go-base-service/foundation/mail"
 	"github.com/dapperauteur/go-base-service/foundation/web"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel/trace"
 )
 
 type userGroup struct {
-	user user.User
-	auth *auth.Auth
+	user     user.User
+	tokens   token.Token
+	auth     *auth.Auth
+	log      *logger.Logger
+	db       *sqlx.DB
+	mailer   mail.Mailer
+	signups  SignupConfig
+	resetURL string
+
+	// background tracks the work carried on after a request was answered.
+	background *sync.WaitGroup
+}
+
+// write runs fn with a User whose changes and their audit events are stored
+// in one transaction, so a change is never kept without its event. Without a
+// database the configured stores are used as they are.
+func (ug userGroup) write(ctx context.Context, fn func(u user.User) error) error {
+	if ug.db == nil {
+		return fn(ug.user)
+	}
+
+	return database.WithTx(ctx, ug.db, func(tx *sqlx.Tx) error {
+		return fn(user.New(ug.log, tx))
+	})
 }
 
 func (ug userGroup) query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
@@ -38,7 +70,17 @@ func (ug userGroup) query(ctx context.Context, w http.ResponseWriter, r *http.Re
 		return web.NewRequestError(fmt.Errorf("invalid rows format: %s", params["rows"]), http.StatusBadRequest)
 	}
 
-	users, err := ug.user.Query(ctx, v.TraceID, pageNumber, rowsPerPage)
+	filter, err := parseUserFilter(r)
+	if err != nil {
+		return web.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	orderBy, err := database.ParseOrderBy(r.URL.Query().Get("order_by"), user.OrderByFields, user.DefaultOrderBy)
+	if err != nil {
+		return web.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	users, err := ug.user.Query(ctx, v.TraceID, filter, orderBy, pageNumber, rowsPerPage)
 	if err != nil {
 		return errors.Wrap(err, "unable to query for users")
 	}
@@ -46,6 +88,86 @@ func (ug userGroup) query(ctx context.Context, w http.ResponseWriter, r *http.Re
 	return web.Respond(ctx, w, users, http.StatusOK)
 }
 
+func (ug userGroup) queryCursor(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.queryCursor")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	qs := r.URL.Query()
+
+	limit := 50
+	if s := qs.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 1000 {
+			return web.NewRequestError(fmt.Errorf("invalid limit format: %s", s), http.StatusBadRequest)
+		}
+		limit = n
+	}
+
+	filter, err := parseUserFilter(r)
+	if err != nil {
+		return web.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	page, err := ug.user.QueryCursor(ctx, v.TraceID, filter, qs.Get("cursor"), limit)
+	if err != nil {
+		switch err {
+		case user.ErrInvalidCursor:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrap(err, "unable to query for users")
+		}
+	}
+
+	return web.Respond(ctx, w, page, http.StatusOK)
+}
+
+// parseUserFilter builds a user.QueryFilter from the query string. Roles are
+// comma separated, name and email match by case-insensitive prefix, q is a
+// case-insensitive substring of either, and dates are RFC3339 or YYYY-MM-DD.
+func parseUserFilter(r *http.Request) (user.QueryFilter, error) {
+	qs := r.URL.Query()
+
+	filter := user.QueryFilter{
+		Name:   qs.Get("name"),
+		Email:  qs.Get("email"),
+		Search: qs.Get("q"),
+	}
+	if roles := qs.Get("role"); roles != "" {
+		filter.Roles = strings.Split(roles, ",")
+	}
+
+	dates := []struct {
+		name string
+		dst  *time.Time
+	}{
+		{"created_after", &filter.CreatedAfter},
+		{"created_before", &filter.CreatedBefore},
+		{"updated_after", &filter.UpdatedAfter},
+		{"updated_before", &filter.UpdatedBefore},
+	}
+	for _, d := range dates {
+		s := qs.Get(d.name)
+		if s == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			if t, err = time.Parse("2006-01-02", s); err != nil {
+				return user.QueryFilter{}, fmt.Errorf("invalid %s format: %s", d.name, s)
+			}
+		}
+		*d.dst = t
+	}
+
+	return filter, nil
+}
+
 func (ug userGroup) queryByID(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.queryByID")
@@ -76,6 +198,8 @@ func (ug userGroup) queryByID(ctx context.Context, w http.ResponseWriter, r *htt
 		}
 	}
 
+	w.Header().Set("ETag", etag(usr.Version))
+
 	return web.Respond(ctx, w, usr, http.StatusOK)
 }
 
@@ -89,14 +213,33 @@ func (ug userGroup) create(ctx context.Context, w http.ResponseWriter, r *http.R
 		return web.NewShutdownError("web value missing from context")
 	}
 
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
 	var nu user.NewUser
 	if err := web.Decode(r, &nu); err != nil {
 		return errors.Wrap(err, "unable to decode payload")
 	}
 
-	usr, err := ug.user.Create(ctx, v.TraceID, nu, v.Now)
+	var usr user.Info
+	err := ug.write(ctx, func(u user.User) error {
+		var err error
+		usr, err = u.Create(ctx, v.TraceID, claims, nu, v.Now)
+		return err
+	})
 	if err != nil {
-		return errors.Wrapf(err, "User: %+v", &usr)
+		switch errors.Cause(err) {
+		case user.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		case user.ErrUniqueEmail:
+			return web.NewRequestError(err, http.StatusConflict)
+		case user.ErrUnknownRole:
+			return roleFieldError(err)
+		default:
+			return errors.Wrapf(err, "User: %+v", &usr)
+		}
 	}
 
 	return web.Respond(ctx, w, usr, http.StatusCreated)
@@ -117,21 +260,40 @@ func (ug userGroup) update(ctx context.Context, w http.ResponseWriter, r *http.R
 		return errors.New("claims missing from context")
 	}
 
+	// Clients must send back the ETag they read so concurrent edits are
+	// rejected instead of overwriting each other.
+	version, err := parseIfMatch(r)
+	if err != nil {
+		return err
+	}
+
 	var upd user.UpdateUser
 	if err := web.Decode(r, &upd); err != nil {
 		return errors.Wrap(err, "unable to decode payload")
 	}
 
 	params := web.Params(r)
-	err := ug.user.Update(ctx, v.TraceID, claims, params["id"], upd, v.Now)
+	err = ug.write(ctx, func(u user.User) error {
+		if err := u.Update(ctx, v.TraceID, claims, params["id"], upd, version, v.Now); err != nil {
+			return err
+		}
+		return ug.reverify(ctx, v.TraceID, u, upd, v.Now)
+	})
 	if err != nil {
-		switch err {
+		// Every forbidden reason wraps user.ErrForbidden.
+		switch errors.Cause(err) {
+		case user.ErrVersionConflict:
+			return web.NewRequestError(err, http.StatusPreconditionFailed)
 		case user.ErrInvalidID:
 			return web.NewRequestError(err, http.StatusBadRequest)
 		case user.ErrNotFound:
 			return web.NewRequestError(err, http.StatusNotFound)
 		case user.ErrForbidden:
 			return web.NewRequestError(err, http.StatusForbidden)
+		case user.ErrUniqueEmail:
+			return web.NewRequestError(err, http.StatusConflict)
+		case user.ErrUnknownRole:
+			return roleFieldError(err)
 		default:
 			return errors.Wrapf(err, "ID: %s  User: %+v", params["id"], &upd)
 		}
@@ -140,6 +302,43 @@ func (ug userGroup) update(ctx context.Context, w http.ResponseWriter, r *http.R
 	return web.Respond(ctx, w, nil, http.StatusNoContent)
 }
 
+// roleFieldError reports roles that do not exist the same way web.Decode
+// reports a field that fails validation.
+func roleFieldError(err error) error {
+	return &web.Error{
+		Err:    errors.New("field validation error"),
+		Status: http.StatusBadRequest,
+		Fields: []web.FieldError{{Field: "roles", Error: err.Error()}},
+	}
+}
+
+// etag returns the entity tag for a version of a user.
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// parseIfMatch returns the user version named by the If-Match header. A
+// wildcard matches any version and is returned as zero. A missing header
+// fails with 428 and a tag that can never match with 412.
+func parseIfMatch(r *http.Request) (int, error) {
+	tag := strings.TrimSpace(r.Header.Get("If-Match"))
+	switch tag {
+	case "":
+		err := errors.New("If-Match header is required")
+		return 0, web.NewRequestError(err, http.StatusPreconditionRequired)
+	case "*":
+		return 0, nil
+	}
+
+	tag = strings.TrimPrefix(tag, "W/")
+	version, err := strconv.Atoi(strings.Trim(tag, `"`))
+	if err != nil || version < 1 {
+		return 0, web.NewRequestError(user.ErrVersionConflict, http.StatusPreconditionFailed)
+	}
+
+	return version, nil
+}
+
 func (ug userGroup) delete(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.delete")
@@ -150,10 +349,18 @@ func (ug userGroup) delete(ctx context.Context, w http.ResponseWriter, r *http.R
 		return web.NewShutdownError("web value missing from context")
 	}
 
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
 	params := web.Params(r)
-	err := ug.user.Delete(ctx, v.TraceID, params["id"])
+	err := ug.write(ctx, func(u user.User) error {
+		return u.Delete(ctx, v.TraceID, claims, params["id"], v.Now)
+	})
 	if err != nil {
-		switch err {
+		// Every forbidden reason wraps user.ErrForbidden.
+		switch errors.Cause(err) {
 		case user.ErrInvalidID:
 			return web.NewRequestError(err, http.StatusBadRequest)
 		case user.ErrNotFound:
@@ -168,6 +375,39 @@ func (ug userGroup) delete(ctx context.Context, w http.ResponseWriter, r *http.R
 	return web.Respond(ctx, w, nil, http.StatusNoContent)
 }
 
+func (ug userGroup) restore(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.restore")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	err := ug.write(ctx, func(u user.User) error {
+		return u.Restore(ctx, v.TraceID, claims, params["id"], v.Now)
+	})
+	if err != nil {
+		switch errors.Cause(err) {
+		case user.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case user.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["id"])
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
 func (ug userGroup) token(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.token")
@@ -189,6 +429,8 @@ func (ug userGroup) token(ctx context.Context, w http.ResponseWriter, r *http.Re
 		switch errors.Cause(err) {
 		case user.ErrAuthenticationFailure:
 			return web.NewRequestError(err, http.StatusUnauthorized)
+		case user.ErrNotVerified:
+			return web.NewRequestError(err, http.StatusForbidden)
 		default:
 			return errors.Wrap(err, "authenticating")
 		}
@@ -197,12 +439,512 @@ func (ug userGroup) token(ctx context.Context, w http.ResponseWriter, r *http.Re
 	params := web.Params(r)
 
 	var tkn struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 	tkn.Token, err = ug.auth.GenerateToken(params["kid"], claims)
 	if err != nil {
 		return errors.Wrap(err, "generating token")
 	}
 
+	tkn.RefreshToken, err = ug.tokens.Create(ctx, v.TraceID, claims.Subject, claims.Id, time.Unix(claims.ExpiresAt, 0), v.Now)
+	if err != nil {
+		return errors.Wrap(err, "generating refresh token")
+	}
+
+	return web.Respond(ctx, w, tkn, http.StatusOK)
+}
+
+func (ug userGroup) refresh(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.refresh")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var req struct {
+		KID          string `json:"kid"`
+		RefreshToken string `json:"refresh_token" validate:"required"`
+	}
+	if err := web.Decode(r, &req); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	// The jti and expiry of the new access token are recorded with the new
+	// refresh token so both can be revoked together.
+	jti := uuid.New().String()
+
+	userID, refresh, err := ug.tokens.Rotate(ctx, v.TraceID, req.RefreshToken, jti, v.Now.Add(user.AccessTTL), v.Now)
+	if err != nil {
+		switch err {
+		case token.ErrNotFound, token.ErrExpired, token.ErrRevoked:
+			return web.NewRequestError(err, http.StatusUnauthorized)
+		default:
+			return errors.Wrap(err, "rotating refresh token")
+		}
+	}
+
+	claims, err := ug.user.ClaimsByID(ctx, v.TraceID, v.Now, userID)
+	if err != nil {
+		switch err {
+		case user.ErrNotFound:
+			return web.NewRequestError(err, http.StatusUnauthorized)
+		default:
+			return errors.Wrapf(err, "ID: %s", userID)
+		}
+	}
+	claims.Id = jti
+
+	var tkn struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	tkn.RefreshToken = refresh
+	tkn.Token, err = ug.auth.GenerateToken(req.KID, claims)
+	if err != nil {
+		return errors.Wrap(err, "generating token")
+	}
+
 	return web.Respond(ctx, w, tkn, http.StatusOK)
 }
+
+func (ug userGroup) revoke(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.revoke")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	// Either a single refresh token is revoked (logout) or every session of a
+	// user is revoked (forced logout). Only callers granted users:write may
+	// force out other users.
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+		UserID       string `json:"user_id"`
+	}
+	if err := web.Decode(r, &req); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	var userID string
+	switch {
+	case req.UserID != "":
+		if _, err := uuid.Parse(req.UserID); err != nil {
+			return web.NewRequestError(user.ErrInvalidID, http.StatusBadRequest)
+		}
+		if !claims.HasPermission(auth.PermUsersWrite) && claims.Subject != req.UserID {
+			return web.NewRequestError(user.ErrForbidden, http.StatusForbidden)
+		}
+		if err := ug.tokens.RevokeUser(ctx, v.TraceID, req.UserID, v.Now); err != nil {
+			return errors.Wrapf(err, "ID: %s", req.UserID)
+		}
+		userID = req.UserID
+
+	case req.RefreshToken != "":
+
+		// Holding a refresh token is proof enough to be allowed to revoke it.
+		var err error
+		userID, err = ug.tokens.Revoke(ctx, v.TraceID, req.RefreshToken, v.Now)
+		if err != nil {
+			switch err {
+			case token.ErrNotFound:
+				return web.NewRequestError(err, http.StatusNotFound)
+			default:
+				return errors.Wrap(err, "revoking refresh token")
+			}
+		}
+
+	default:
+		err := errors.New("must provide refresh_token or user_id")
+		return web.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	// When users log themselves out the token used to make this call is
+	// revoked as well.
+	if claims.Id != "" && userID == claims.Subject {
+		if err := ug.tokens.Deny(ctx, v.TraceID, claims.Id, time.Unix(claims.ExpiresAt, 0)); err != nil {
+			return errors.Wrap(err, "denying token")
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// queryMe returns the user the token was issued to.
+func (ug userGroup) queryMe(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.queryMe")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	usr, err := ug.user.QueryByID(ctx, v.TraceID, claims, claims.Subject)
+	if err != nil {
+		switch err {
+		case user.ErrInvalidID, user.ErrNotFound:
+			return web.NewRequestError(user.ErrNotFound, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "ID: %s", claims.Subject)
+		}
+	}
+
+	w.Header().Set("ETag", etag(usr.Version))
+
+	return web.Respond(ctx, w, usr, http.StatusOK)
+}
+
+// updateMe lets users change their own profile. Only the fields of
+// user.UpdateProfile are accepted.
+func (ug userGroup) updateMe(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.updateMe")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	version, err := parseIfMatch(r)
+	if err != nil {
+		return err
+	}
+
+	var up user.UpdateProfile
+	if err := web.Decode(r, &up); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	upd := user.UpdateUser{
+		Name:            up.Name,
+		Email:           up.Email,
+		CurrentPassword: up.CurrentPassword,
+	}
+	err = ug.write(ctx, func(u user.User) error {
+		if err := u.Update(ctx, v.TraceID, claims, claims.Subject, upd, version, v.Now); err != nil {
+			return err
+		}
+		return ug.reverify(ctx, v.TraceID, u, upd, v.Now)
+	})
+	if err != nil {
+		switch errors.Cause(err) {
+		case user.ErrVersionConflict:
+			return web.NewRequestError(err, http.StatusPreconditionFailed)
+		case user.ErrInvalidID, user.ErrNotFound:
+			return web.NewRequestError(user.ErrNotFound, http.StatusNotFound)
+		case user.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		case user.ErrUniqueEmail:
+			return web.NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "ID: %s  User: %+v", claims.Subject, &up)
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// changePassword lets users change their own password. Every other session
+// of the user is logged out so a leaked password stops working everywhere.
+func (ug userGroup) changePassword(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.changePassword")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var cp user.ChangePassword
+	if err := web.Decode(r, &cp); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	err := ug.write(ctx, func(u user.User) error {
+		return u.ChangePassword(ctx, v.TraceID, claims, cp, v.Now)
+	})
+	if err != nil {
+		switch errors.Cause(err) {
+		case user.ErrVersionConflict:
+			return web.NewRequestError(err, http.StatusPreconditionFailed)
+		case user.ErrInvalidID, user.ErrNotFound:
+			return web.NewRequestError(user.ErrNotFound, http.StatusNotFound)
+		case user.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "ID: %s", claims.Subject)
+		}
+	}
+
+	if err := ug.tokens.RevokeOthers(ctx, v.TraceID, claims.Subject, claims.Id, v.Now); err != nil {
+		return errors.Wrapf(err, "ID: %s", claims.Subject)
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// verifyPurpose is what signed verification links are valid for.
+const verifyPurpose = "verify-email"
+
+// signup creates an unverified user and emails them a link to verify their
+// email address. Signing up again with an unverified email sends a new link
+// and a verified one is told it already has an account. The response is the
+// same in every case so it can't be used to find out which accounts exist.
+func (ug userGroup) signup(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.signup")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var ns user.NewSignup
+	if err := web.Decode(r, &ns); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	// The mail is sent inside the transaction so a failure to send doesn't
+	// leave behind an account nobody can verify.
+	err := ug.write(ctx, func(u user.User) error {
+		usr, err := u.Signup(ctx, v.TraceID, ns, v.Now)
+		if err != nil {
+			return err
+		}
+
+		if usr.DateVerified == nil {
+			return ug.mailVerify(ctx, usr, v.Now)
+		}
+
+		msg := mail.Message{
+			To:      usr.Email,
+			Subject: "You already have an account",
+			Body:    fmt.Sprintf("Hi %s,\n\nSomeone tried to sign up with your email but you already have an account. If you forgot your password you can reset it.\n\nIf this was not you, you can ignore this email.\n", usr.Name),
+		}
+		if err := ug.mailer.Send(ctx, msg); err != nil {
+			return errors.Wrapf(err, "sending signup mail to user %s", usr.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		switch errors.Cause(err) {
+
+		// The email belongs to a deleted user or another signup got in
+		// first. Nothing is sent but the caller can't tell.
+		case user.ErrUniqueEmail:
+		default:
+			return errors.Wrapf(err, "Email: %s", ns.Email)
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusAccepted)
+}
+
+// mailVerify sends the user a link to verify their email.
+func (ug userGroup) mailVerify(ctx context.Context, usr user.Info, now time.Time) error {
+	tkn := ug.signups.Signer.Sign(verifyPurpose, usr.ID, now.Add(ug.signups.VerifyTTL))
+	msg := mail.Message{
+		To:      usr.Email,
+		Subject: "Verify your email",
+		Body:    fmt.Sprintf("Hi %s,\n\nOpen this link to verify your email:\n\n%s?token=%s\n", usr.Name, ug.signups.VerifyURL, url.QueryEscape(tkn)),
+	}
+	if err := ug.mailer.Send(ctx, msg); err != nil {
+		return errors.Wrapf(err, "sending verification mail to user %s", usr.ID)
+	}
+	return nil
+}
+
+// reverify sends a new verification link after an update set the email of a
+// user, since a changed email is no longer verified. It runs in the same
+// transaction as the update so a failure to send undoes the change.
+func (ug userGroup) reverify(ctx context.Context, traceID string, u user.User, upd user.UpdateUser, now time.Time) error {
+	if upd.Email == nil {
+		return nil
+	}
+
+	usr, err := u.QueryForMail(ctx, traceID, *upd.Email)
+	if err != nil {
+		return err
+	}
+	if usr.DateVerified != nil {
+		return nil
+	}
+
+	return ug.mailVerify(ctx, usr, now)
+}
+
+// verify activates the account named by a verification link.
+func (ug userGroup) verify(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.verify")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	userID, err := ug.signups.Signer.Verify(verifyPurpose, r.URL.Query().Get("token"), v.Now)
+	if err != nil {
+		return web.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	err = ug.write(ctx, func(u user.User) error {
+		return u.Verify(ctx, v.TraceID, userID, v.Now)
+	})
+	if err != nil {
+		switch errors.Cause(err) {
+		case user.ErrVersionConflict:
+			return web.NewRequestError(err, http.StatusPreconditionFailed)
+		case user.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case user.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "ID: %s", userID)
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// forgotPassword emails a link to reset their password to the user with the
+// email. It accepts the request whether or not the email belongs to a user
+// so it can't be used to find out which accounts exist.
+func (ug userGroup) forgotPassword(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.forgotPassword")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var fp user.ForgotPassword
+	if err := web.Decode(r, &fp); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	usr, err := ug.user.QueryForMail(ctx, v.TraceID, fp.Email)
+	if err != nil {
+		switch err {
+		case user.ErrNotFound:
+			return web.Respond(ctx, w, nil, http.StatusAccepted)
+		default:
+			return errors.Wrapf(err, "Email: %s", fp.Email)
+		}
+	}
+
+	// The reset is issued and mailed in the background so a known email is
+	// answered as quickly as an unknown one. It stays part of the trace of
+	// the request, and shutdown waits for it.
+	bg := trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx))
+	ug.background.Add(1)
+	go func() {
+		defer ug.background.Done()
+		ug.mailReset(bg, v.TraceID, usr, v.Now)
+	}()
+
+	return web.Respond(ctx, w, nil, http.StatusAccepted)
+}
+
+// mailResetTimeout bounds issuing and mailing a password reset, which is no
+// longer tied to a request.
+const mailResetTimeout = 30 * time.Second
+
+// mailReset issues a password reset token for the user and mails them the
+// link to use it. It runs after the request was answered, so failures are
+// only logged.
+func (ug userGroup) mailReset(ctx context.Context, traceID string, usr user.Info, now time.Time) {
+	ctx, cancel := context.WithTimeout(ctx, mailResetTimeout)
+	defer cancel()
+
+	tkn, err := ug.tokens.CreateReset(ctx, traceID, usr.ID, now)
+	if err != nil {
+		ug.log.Error(ctx, "creating password reset", "trace_id", traceID, "user_id", usr.ID, "error", err)
+		return
+	}
+
+	msg := mail.Message{
+		To:      usr.Email,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf("Hi %s,\n\nOpen this link to choose a new password:\n\n%s?token=%s\n\nIf you did not ask for this you can ignore this email.\n", usr.Name, ug.resetURL, url.QueryEscape(tkn)),
+	}
+	if err := ug.mailer.Send(ctx, msg); err != nil {
+		ug.log.Error(ctx, "sending password reset", "trace_id", traceID, "user_id", usr.ID, "error", err)
+	}
+}
+
+// resetPassword sets a new password with a reset token and logs the user out
+// of every session.
+func (ug userGroup) resetPassword(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.resetPassword")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var rp user.ResetPassword
+	if err := web.Decode(r, &rp); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	// The token is only used up when the new password is saved with it, and
+	// the sessions of the user are revoked in the same transaction.
+	err := ug.tokens.UseReset(ctx, v.TraceID, rp.Token, v.Now, func(tx *sqlx.Tx, id string) error {
+		if err := user.New(ug.log, tx).ResetPassword(ctx, v.TraceID, id, rp, v.Now); err != nil {
+			return err
+		}
+		if err := ug.tokens.RevokeUserTx(ctx, tx, v.TraceID, id, v.Now); err != nil {
+			return errors.Wrapf(err, "revoking sessions of user %s", id)
+		}
+		return nil
+	})
+	if err != nil {
+		switch errors.Cause(err) {
+		case token.ErrNotFound, token.ErrResetUsed, token.ErrResetExpired, user.ErrNotFound:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case user.ErrVersionConflict:
+			return web.NewRequestError(err, http.StatusPreconditionFailed)
+		default:
+			return errors.Wrap(err, "resetting password")
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
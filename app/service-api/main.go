@@ -2,23 +2,33 @@ package main
 
 import (
 	"context"
-	"crypto/rsa"
+	"crypto/rand"
 	"expvar"
 	"fmt"
-	"io/ioutil"
-	"log"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/ardanlabs/conf"
 	"github.com/dapperauteur/go-base-service/app/service-api/handlers"
 	"github.com/dapperauteur/go-base-service/business/auth"
+	"github.com/dapperauteur/go-base-service/business/data/audit"
+	"github.com/dapperauteur/go-base-service/business/data/role"
+	"github.com/dapperauteur/go-base-service/business/data/schema"
+	"github.com/dapperauteur/go-base-service/business/data/token"
+	"github.com/dapperauteur/go-base-service/business/data/user"
+	"github.com/dapperauteur/go-base-service/business/link"
 	"github.com/dapperauteur/go-base-service/foundation/database"
-	"github.com/dgrijalva/jwt-go"
+	"github.com/dapperauteur/go-base-service/foundation/logger"
+	"github.com/dapperauteur/go-base-service/foundation/mail"
+	"github.com/dapperauteur/go-base-service/foundation/metrics"
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel/api/global"
 	"go.opentelemetry.io/otel/exporters/trace/zipkin"
@@ -39,15 +49,16 @@ https://github.com/google/pprof/pull/366
 var build = "develop"
 
 func main() {
-	log := log.New(os.Stdout, "SERVICE : ", log.LstdFlags|log.Lmicroseconds|log.Lshortfile)
+	log := logger.New(os.Stdout, "SERVICE", logger.LevelInfo)
 
 	if err := run(log); err != nil {
-		log.Println("main: error: ", err)
+		log.Error(context.Background(), "main: error", "error", err)
 		os.Exit(1)
 	}
 }
 
-func run(log *log.Logger) error {
+func run(log *logger.Logger) error {
+	ctx := context.Background()
 
 	// ==
 	// Configuration
@@ -61,26 +72,47 @@ func run(log *log.Logger) error {
 			WriteTimeout    time.Duration `conf:"default:5s"`
 			ShutdownTimeout time.Duration `conf:"default:5s"`
 		}
+		Log struct {
+			Level string `conf:"default:info"`
+		}
 		Auth struct {
-			// KeyID string `conf:"default:zarf/keys/"`
-			KeyID          string `conf:"default:54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"`
-			PrivateKeyFile string `conf:"default:./private.pem"` // when using docker/kube
-			// PrivateKeyFile string `conf:"default:zarf/keys/"`
-			// PrivateKeyFile string `conf:"default:/Users/awe/Coding/repos/my-repos/go-base-service/private.pem"` // when private.pem is on local machine
-			Algorithm string `conf:"default:RS256"`
+			KeysFolder     string `conf:"default:zarf/keys/"`
+			ActiveKID      string
+			Algorithm      string        `conf:"default:RS256"`
+			ReloadInterval time.Duration `conf:"default:0s"`
+			DevMode        bool          `conf:"default:false"`
 		}
 		DB struct {
-			User       string `conf:"default:postgres"`
-			Password   string `conf:"default:postgres,noprint"`
-			Host       string `conf:"default:db"`
-			Name       string `conf:"default:postgres"`
-			DisableTLS bool   `conf:"default:true"`
+			User             string        `conf:"default:postgres"`
+			Password         string        `conf:"default:postgres,noprint"`
+			Host             string        `conf:"default:db"`
+			Name             string        `conf:"default:postgres"`
+			DisableTLS       bool          `conf:"default:true"`
+			MigrateOnStartup bool          `conf:"default:false"`
+			MigrateTimeout   time.Duration `conf:"default:5m"`
 		}
 		Zipkin struct {
 			ReporterURI string  `conf:"default:http://zipkin:9411/api/v2/spans"`
 			ServiceName string  `conf:"default:service-api"`
 			Probability float64 `conf:"default:0.05"`
 		}
+		Mail struct {
+			Host     string
+			Port     int `conf:"default:587"`
+			Username string
+			Password string `conf:"noprint"`
+			From     string `conf:"default:noreply@example.com"`
+			File     string
+		}
+		Signup struct {
+			VerifyURL string        `conf:"default:http://localhost:3000/verify"`
+			VerifyTTL time.Duration `conf:"default:24h"`
+			Secret    string        `conf:"noprint"`
+			DevMode   bool          `conf:"default:false"`
+		}
+		Reset struct {
+			URL string `conf:"default:http://localhost:3000/reset"`
+		}
 	}
 
 	cfg.Version.SVN = build
@@ -106,53 +138,84 @@ func run(log *log.Logger) error {
 		return errors.Wrap(err, "parsing config")
 	}
 
+	level, err := logger.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		return errors.Wrap(err, "parsing log level")
+	}
+	log = log.WithLevel(level)
+
 	// =========================================================================
 	// App Starting
 
 	// Print the build version for logs.
 	// Also expose it under /debug/vars
 	expvar.NewString("build").Set(build)
-	log.Printf("main: Started: Application initializing: version %q", build)
-	defer log.Println("main: Completed")
+	log.Info(ctx, "main: Started: Application initializing", "version", build)
+	defer log.Info(ctx, "main: Completed")
 
 	out, err := conf.String(&cfg)
 	if err != nil {
 		return errors.Wrap(err, "generating config for output")
 	}
-	log.Printf("main: Config:\n%v\n", out)
+	log.Info(ctx, "main: Config", "config", out)
 
 	// =========================================================================
 	// Initialize authentication support
 
-	log.Println("main: Started: Initializing authentication support")
+	log.Info(ctx, "main: Started: Initializing authentication support")
 
-	privatePEM, err := ioutil.ReadFile(cfg.Auth.PrivateKeyFile)
+	// Every key in the folder can verify tokens. Only the active key signs
+	// new ones. It is named by the active file in the folder or by ActiveKID,
+	// which can both be left out while the folder holds a single key. The
+	// keys must be supplied by the operator. Only in dev mode is a key made up
+	// when there are none, and tokens signed with it die with the process.
+	keys, err := auth.LoadKeys(cfg.Auth.KeysFolder)
 	if err != nil {
-		return errors.Wrap(err, "reading auth private key")
+		if !cfg.Auth.DevMode || errors.Cause(err) != auth.ErrNoKeys {
+			return errors.Wrap(err, "loading auth keys")
+		}
+		log.Warn(ctx, "main: No auth keys found, generating one for this process in dev mode", "folder", cfg.Auth.KeysFolder)
+		key, err := auth.GenerateKey(cfg.Auth.Algorithm)
+		if err != nil {
+			return errors.Wrap(err, "generating dev auth key")
+		}
+		keys = auth.Keys{uuid.New().String(): key}
 	}
 
-	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
+	activeKID, err := auth.ActiveKID(cfg.Auth.KeysFolder, keys, cfg.Auth.ActiveKID)
 	if err != nil {
-		return errors.Wrap(err, "parsing auth private key")
-	}
-
-	lookup := func(kid string) (*rsa.PublicKey, error) {
-		switch kid {
-		case cfg.Auth.KeyID:
-			return &privateKey.PublicKey, nil
-		}
-		return nil, fmt.Errorf("no public key found for the specified kid: %s", kid)
+		return errors.Wrap(err, "selecting active key")
 	}
 
-	auth, err := auth.New(cfg.Auth.Algorithm, lookup, auth.Keys{cfg.Auth.KeyID: privateKey})
+	auth, err := auth.New(cfg.Auth.Algorithm, nil, keys)
 	if err != nil {
 		return errors.Wrap(err, "constructing auth")
 	}
 
+	if err := auth.SetActiveKID(activeKID); err != nil {
+		return errors.Wrap(err, "setting active key")
+	}
+
+	// Keys are reloaded from the folder when the process receives SIGHUP. When
+	// a ReloadInterval is configured the folder is also polled for changes.
+	// The active file is read again on every reload so signing can move to a
+	// new key without a restart.
+	//
+	// Not concerned with shutting this down when the application is shutdown.
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go watchKeys(log, auth, cfg.Auth.KeysFolder, cfg.Auth.ActiveKID, cfg.Auth.ReloadInterval, reload)
+
 	// =========================================================================
 	// Start Database
 
-	log.Println("main: Initializing database support")
+	// The embedded migrations are checked for gaps and duplicates before the
+	// service relies on them.
+	if err := schema.Validate(); err != nil {
+		return errors.Wrap(err, "validating schema")
+	}
+
+	log.Info(ctx, "main: Initializing database support")
 
 	db, err := database.Open(database.Config{
 		User:       cfg.DB.User,
@@ -165,10 +228,35 @@ func run(log *log.Logger) error {
 		return errors.Wrap(err, "connecting to db")
 	}
 	defer func() {
-		log.Printf("main: Database Stopping: %s", cfg.DB.Host)
+		log.Info(ctx, "main: Database Stopping", "host", cfg.DB.Host)
 		db.Close()
 	}()
 
+	// Reject access tokens that were revoked before they expired.
+	auth.SetDenylist(token.New(log, db))
+
+	// Export the connection pool statistics under /metrics.
+	database.RegisterMetrics(db)
+
+	// When enabled the schema is migrated in the background so liveness is
+	// served while replicas wait on each other for the migration lock.
+	// Readiness reports false until the schema version matches.
+	migrationErrors := make(chan error, 1)
+	if cfg.DB.MigrateOnStartup {
+		go func() {
+			log.Info(ctx, "main: Migrating database schema", "version", schema.LatestVersion())
+
+			ctx, cancel := context.WithTimeout(ctx, cfg.DB.MigrateTimeout)
+			defer cancel()
+
+			if err := schema.MigrateLocked(ctx, db); err != nil {
+				migrationErrors <- err
+				return
+			}
+			log.Info(ctx, "main: Database schema migrated", "version", schema.LatestVersion())
+		}()
+	}
+
 	// =========================================================================
 	// Start Tracing Support
 
@@ -176,12 +264,12 @@ func run(log *log.Logger) error {
 	// compatible with your project. Please review the documentation for
 	// opentelemetry.
 
-	log.Println("main: Initializing OT/Zipkin tracing support")
+	log.Info(ctx, "main: Initializing OT/Zipkin tracing support")
 
 	exporter, err := zipkin.NewRawExporter(
 		cfg.Zipkin.ReporterURI,
 		cfg.Zipkin.ServiceName,
-		zipkin.WithLogger(log),
+		zipkin.WithLogger(log.StdLogger(logger.LevelWarn)),
 	)
 	if err != nil {
 		return errors.Wrap(err, "creating new exporter")
@@ -203,31 +291,99 @@ func run(log *log.Logger) error {
 	//
 	// /debug/pprof - Added to the default mux by importing the net/http/pprof package.
 	// /debug/vars - Added to the default mux by importing the expvar package.
+	// /metrics - Prometheus text format for the request and database metrics.
 	//
 	// Not concerned with shutting this down when the application is shutdown.
 
-	log.Println("main: Initializing debugging support")
+	log.Info(ctx, "main: Initializing debugging support")
+
+	http.Handle("/metrics", metrics.Handler())
 
 	go func() {
-		log.Printf("main: Debug Listening %s", cfg.Web.DebugHost)
+		log.Info(ctx, "main: Debug Listening", "host", cfg.Web.DebugHost)
 		if err := http.ListenAndServe(cfg.Web.DebugHost, http.DefaultServeMux); err != nil {
-			log.Printf("main: Debug Listener closed: %v", err)
+			log.Error(ctx, "main: Debug Listener closed", "error", err)
 		}
 	}()
 
 	// =========================================================================
 	// Start API Service
 
-	log.Println("main: Initializing API support")
+	log.Info(ctx, "main: Initializing API support")
 
 	// Make a channel to listen for an interrupt or terminate signal from the OS.
 	// Use a buffered channel because the signal package requires it.
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
+	// Without a mail host, mail is written to stdout or the configured file
+	// so signups and password resets can be completed locally.
+	var mailer mail.Mailer
+	switch {
+	case cfg.Mail.Host != "":
+		mailer = mail.NewSMTP(mail.SMTPConfig{
+			Host:     cfg.Mail.Host,
+			Port:     cfg.Mail.Port,
+			Username: cfg.Mail.Username,
+			Password: cfg.Mail.Password,
+			From:     cfg.Mail.From,
+		})
+	case cfg.Mail.File != "":
+		f, err := os.OpenFile(cfg.Mail.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return errors.Wrap(err, "opening mail file")
+		}
+		defer f.Close()
+		mailer = mail.NewFile(f)
+	default:
+		mailer = mail.NewFile(os.Stdout)
+	}
+
+	// Verification links are signed with the configured secret. A random one
+	// only works for a single instance and breaks every link on restart, so
+	// it is only used in dev mode.
+	secret := []byte(cfg.Signup.Secret)
+	if len(secret) == 0 {
+		if !cfg.Signup.DevMode {
+			return errors.New("no signup secret configured, set one or enable signup dev mode")
+		}
+		log.Warn(ctx, "main: No signup secret configured, using a random one in dev mode")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return errors.Wrap(err, "generating signup secret")
+		}
+	}
+	signer, err := link.NewSigner(secret)
+	if err != nil {
+		return errors.Wrap(err, "constructing signup signer")
+	}
+
+	// Tracks the mail the handlers send after answering a request, so none
+	// is dropped on shutdown.
+	var background sync.WaitGroup
+
+	apiCfg := handlers.APIConfig{
+		Build:    build,
+		Shutdown: shutdown,
+		Log:      log,
+		Auth:     auth,
+		DB:       db,
+		Users:    user.NewPostgresStore(log, db),
+		Audit:    audit.NewPostgresStore(log, db),
+		Roles:    role.NewPostgresStore(log, db),
+		Mailer:   mailer,
+		Signup: handlers.SignupConfig{
+			Signer:    signer,
+			VerifyURL: cfg.Signup.VerifyURL,
+			VerifyTTL: cfg.Signup.VerifyTTL,
+		},
+		ResetURL:   cfg.Reset.URL,
+		Background: &background,
+	}
+
 	api := http.Server{
 		Addr:         cfg.Web.APIHost,
-		Handler:      handlers.API(build, shutdown, log, auth, db),
+		Handler:      handlers.API(apiCfg),
 		ReadTimeout:  cfg.Web.ReadTimeout,
 		WriteTimeout: cfg.Web.WriteTimeout,
 	}
@@ -238,7 +394,7 @@ func run(log *log.Logger) error {
 
 	// Start the service listening for requests.
 	go func() {
-		log.Printf("main: API listening on %s", api.Addr)
+		log.Info(ctx, "main: API listening", "host", api.Addr)
 		serverErrors <- api.ListenAndServe()
 	}()
 
@@ -250,11 +406,14 @@ func run(log *log.Logger) error {
 	case err := <-serverErrors:
 		return errors.Wrap(err, "server error")
 
+	case err := <-migrationErrors:
+		return errors.Wrap(err, "migrating database")
+
 	case sig := <-shutdown:
-		log.Printf("main: %v: Start shutdown", sig)
+		log.Info(ctx, "main: Start shutdown", "signal", sig)
 
 		// Give outstanding requests a deadline for completion.
-		ctx, cancel := context.WithTimeout(context.Background(), cfg.Web.ShutdownTimeout)
+		ctx, cancel := context.WithTimeout(ctx, cfg.Web.ShutdownTimeout)
 		defer cancel()
 
 		// Asking listener to shutdown and shed load.
@@ -263,8 +422,77 @@ func run(log *log.Logger) error {
 			return errors.Wrap(err, "could not stop server gracefully")
 		}
 
-		log.Printf("main: %v: Completed shutdown", sig)
+		// Waiting for the work still running for requests already answered.
+		done := make(chan struct{})
+		go func() {
+			background.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "could not finish background work")
+		}
+
+		log.Info(ctx, "main: Completed shutdown", "signal", sig)
 	}
 
 	return nil
 }
+
+// watchKeys reloads the auth key store every time a signal is received on
+// reload or, when interval is not zero, the key files in dir change.
+func watchKeys(log *logger.Logger, a *auth.Auth, dir string, activeKID string, interval time.Duration, reload <-chan os.Signal) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	ctx := context.Background()
+
+	last := keysFingerprint(dir)
+	for {
+		select {
+		case sig := <-reload:
+			log.Info(ctx, "main: Reloading keys", "signal", sig)
+		case <-tick:
+			fp := keysFingerprint(dir)
+			if fp == last {
+				continue
+			}
+			log.Info(ctx, "main: Key folder changed: Reloading keys")
+		}
+		last = keysFingerprint(dir)
+
+		if err := a.ReloadKeys(dir, activeKID); err != nil {
+			log.Error(ctx, "main: Reloading keys", "error", err)
+			continue
+		}
+
+		kids, active := a.KIDs()
+		log.Info(ctx, "main: Keys reloaded", "active", active, "loaded", kids)
+	}
+}
+
+// keysFingerprint summarizes the name, size and modification time of every
+// key file and of the active file in dir so changes to the folder can be
+// detected by polling.
+func keysFingerprint(dir string) string {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return ""
+	}
+	files = append(files, filepath.Join(dir, auth.ActiveFile))
+
+	var b strings.Builder
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&b, "%s:%d:%d;", file, info.Size(), info.ModTime().UnixNano())
+	}
+	return b.String()
+}
@@ -0,0 +1,231 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/dapperauteur/go-base-service/app/service-api/handlers"
+	"github.com/dapperauteur/go-base-service/business/auth"
+	"github.com/dapperauteur/go-base-service/business/data/audit"
+	"github.com/dapperauteur/go-base-service/business/data/role"
+	"github.com/dapperauteur/go-base-service/business/data/user"
+	"github.com/dapperauteur/go-base-service/business/tests"
+	"github.com/google/go-cmp/cmp"
+)
+
+// RoleTests holds methods for each role subtest.
+type RoleTests struct {
+	app        http.Handler
+	userToken  string
+	adminToken string
+}
+
+// TestRoles is the entry point for testing role management functions.
+func TestRoles(t *testing.T) {
+	test := tests.NewMemoryIntegration(t)
+	t.Cleanup(test.Teardown)
+
+	shutdown := make(chan os.Signal, 1)
+	tests := RoleTests{
+		app: handlers.API(handlers.APIConfig{
+			Build:    "develop",
+			Shutdown: shutdown,
+			Log:      test.Log,
+			Auth:     test.Auth,
+			DB:       test.DB,
+			Users:    test.Users,
+			Audit:    test.Audit,
+			Roles:    test.Roles,
+		}),
+		userToken:  test.Token(test.KID, "user@example.com", "gophers"),
+		adminToken: test.Token(test.KID, "admin@example.com", "gophers"),
+	}
+
+	t.Run("crudRoles", tests.crudRole)
+	t.Run("getRoles403", tests.getRoles403)
+	t.Run("postUser400", tests.postUser400)
+}
+
+// crudRole performs a complete test of CRUD against the api.
+func (rt *RoleTests) crudRole(t *testing.T) {
+	nr := role.NewRole{
+		Name:        "AUDITOR",
+		Description: "Reads the audit log.",
+		Permissions: []string{auth.PermAuditRead},
+	}
+
+	t.Log("Given the need to manage roles with the roles endpoint.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using the declared role value.", testID)
+		{
+			body, err := json.Marshal(&nr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code := rt.do(http.MethodPost, "/roles", body); code != http.StatusCreated {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 201 for the create : %v", tests.Failed, testID, code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 201 for the create.", tests.Success, testID)
+
+			ur := role.UpdateRole{
+				Permissions: []string{auth.PermAuditRead, auth.PermUsersRead},
+			}
+			body, err = json.Marshal(&ur)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code := rt.do(http.MethodPut, "/roles/AUDITOR", body); code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 204 for the update : %v", tests.Failed, testID, code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 204 for the update.", tests.Success, testID)
+
+			r := httptest.NewRequest(http.MethodGet, "/roles/AUDITOR", nil)
+			w := httptest.NewRecorder()
+
+			r.Header.Set("Authorization", "Bearer "+rt.adminToken)
+			rt.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the retrieve : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 200 for the retrieve.", tests.Success, testID)
+
+			var got role.Info
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+			exp := []string{auth.PermAuditRead, auth.PermUsersRead}
+			if diff := cmp.Diff([]string(got.Permissions), exp); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get the updated permissions. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the updated permissions.", tests.Success, testID)
+
+			strip, err := json.Marshal(role.UpdateRole{Permissions: []string{auth.PermUsersRead}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code := rt.do(http.MethodPut, "/roles/"+auth.RoleAdmin, strip); code != http.StatusForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 403 for changing the admin permissions : %v", tests.Failed, testID, code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 403 for changing the admin permissions.", tests.Success, testID)
+
+			if code := rt.do(http.MethodDelete, "/roles/"+auth.RoleAdmin, nil); code != http.StatusForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 403 for deleting a built-in role : %v", tests.Failed, testID, code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 403 for deleting a built-in role.", tests.Success, testID)
+
+			if code := rt.do(http.MethodDelete, "/roles/AUDITOR", nil); code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 204 for the delete : %v", tests.Failed, testID, code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 204 for the delete.", tests.Success, testID)
+
+			if code := rt.do(http.MethodGet, "/roles/AUDITOR", nil); code != http.StatusNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 404 for the deleted role : %v", tests.Failed, testID, code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 404 for the deleted role.", tests.Success, testID)
+
+			r = httptest.NewRequest(http.MethodGet, "/audit?entity=role:AUDITOR", nil)
+			w = httptest.NewRecorder()
+			r.Header.Set("Authorization", "Bearer "+rt.adminToken)
+			rt.app.ServeHTTP(w, r)
+
+			var events []audit.Event
+			if err := json.NewDecoder(w.Body).Decode(&events); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the audit events : %v", tests.Failed, testID, err)
+			}
+			var actions []string
+			for _, ev := range events {
+				actions = append(actions, ev.Action)
+			}
+			exp = []string{audit.ActionDelete, audit.ActionUpdate, audit.ActionCreate}
+			if diff := cmp.Diff(actions, exp); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould audit every change to the role. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould audit every change to the role.", tests.Success, testID)
+		}
+	}
+}
+
+// getRoles403 validates a user without the roles:read permission can't list
+// the roles.
+func (rt *RoleTests) getRoles403(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/roles", nil)
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+rt.userToken)
+	rt.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to keep roles away from regular users.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using a user token.", testID)
+		{
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 403 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 403 for the response.", tests.Success, testID)
+		}
+	}
+}
+
+// postUser400 validates a user can't be given a role that does not exist.
+func (rt *RoleTests) postUser400(t *testing.T) {
+	nu := user.NewUser{
+		Name:            "Earl Stevens",
+		Email:           "earl@awews.com",
+		Roles:           []string{"OWNER"},
+		Password:        "gophers",
+		PasswordConfirm: "gophers",
+	}
+
+	body, err := json.Marshal(&nu)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/users", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+rt.adminToken)
+	rt.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to validate the roles of a new user.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using an unknown role.", testID)
+		{
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 400 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 400 for the response.", tests.Success, testID)
+
+			var got struct {
+				Fields []struct {
+					Field string `json:"field"`
+				} `json:"fields"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+			if len(got.Fields) != 1 || got.Fields[0].Field != "roles" {
+				t.Fatalf("\t%s\tTest %d:\tShould report the roles field : %+v", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould report the roles field.", tests.Success, testID)
+		}
+	}
+}
+
+// do sends a request as the admin and returns the status code.
+func (rt *RoleTests) do(method string, target string, body []byte) int {
+	r := httptest.NewRequest(method, target, bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+rt.adminToken)
+	rt.app.ServeHTTP(w, r)
+	return w.Code
+}
@@ -2,17 +2,24 @@ package tests
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/dapperauteur/go-base-service/app/service-api/handlers"
 	"github.com/dapperauteur/go-base-service/business/auth"
+	"github.com/dapperauteur/go-base-service/business/data/audit"
 	"github.com/dapperauteur/go-base-service/business/data/user"
+	"github.com/dapperauteur/go-base-service/business/link"
 	"github.com/dapperauteur/go-base-service/business/tests"
+	"github.com/dapperauteur/go-base-service/foundation/mail"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -21,26 +28,59 @@ import (
 // subtests are registered.
 type UserTests struct {
 	app        http.Handler
+	mail       *bytes.Buffer
+	users      user.User
+	auth       *auth.Auth
 	kid        string
 	userToken  string
 	adminToken string
 }
 
-// TestUsers is the entry point for testing user management functions.
+// TestUsers is the entry point for testing user management functions. Users
+// are kept in memory so these tests do not need Docker.
 func TestUsers(t *testing.T) {
-	test := tests.NewIntegration(t)
+	test := tests.NewMemoryIntegration(t)
 	t.Cleanup(test.Teardown)
 
+	signer, err := link.NewSigner([]byte(strings.Repeat("k", 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mailbox bytes.Buffer
+
 	shutdown := make(chan os.Signal, 1)
 	tests := UserTests{
-		app:        handlers.API("develop", shutdown, test.Log, test.Auth, test.DB),
+		app: handlers.API(handlers.APIConfig{
+			Build:    "develop",
+			Shutdown: shutdown,
+			Log:      test.Log,
+			Auth:     test.Auth,
+			DB:       test.DB,
+			Users:    test.Users,
+			Audit:    test.Audit,
+			Roles:    test.Roles,
+			Mailer:   mail.NewFile(&mailbox),
+			Signup: handlers.SignupConfig{
+				Signer:    signer,
+				VerifyURL: "http://localhost:3000/verify",
+				VerifyTTL: time.Hour,
+			},
+			ResetURL: "http://localhost:3000/reset",
+		}),
+		mail:       &mailbox,
+		users:      user.NewWithStore(test.Log, test.Users, test.Audit, test.Roles),
+		auth:       test.Auth,
 		kid:        test.KID,
-		userToken:  test.Token(test.KID, "brad@awews.com", "gophers"),
-		adminToken: test.Token(test.KID, "earl@awews.com", "gophers"),
+		userToken:  test.Token(test.KID, "user@example.com", "gophers"),
+		adminToken: test.Token(test.KID, "admin@example.com", "gophers"),
 	}
 
 	// t.Run("getToken200", tests.getToken200)
 	t.Run("crudUsers", tests.crudUser)
+	t.Run("me", tests.me)
+	t.Run("signup", tests.signup)
+	t.Run("changeEmail", tests.changeEmail)
+	t.Run("forgotPassword", tests.forgotPassword)
 }
 
 // crudUser performs a complete test of CRUD against the api.
@@ -48,9 +88,15 @@ func (ut *UserTests) crudUser(t *testing.T) {
 	nu := ut.postUser201(t)
 	defer ut.deleteUser204(t, nu.ID)
 
-	ut.getUser200(t, nu.ID)
-	ut.putUser204(t, nu.ID)
-	ut.putUser403(t, nu.ID)
+	tag := ut.getUser200(t, nu.ID)
+	ut.putUser428(t, nu.ID)
+	ut.putUser204(t, nu.ID, tag)
+	ut.putUser412(t, nu.ID, tag)
+	ut.putUser403(t, nu.ID, tag)
+	ut.deleteUser204(t, nu.ID)
+	ut.restoreUser204(t, nu.ID)
+	ut.getAudit200(t, nu.ID)
+	ut.getAudit403(t)
 }
 
 // postUser201 validates a user can be created with the endpoint.
@@ -87,6 +133,10 @@ func (ut *UserTests) postUser201(t *testing.T) user.Info {
 			}
 			t.Logf("\t%s\tTest %d:\tShould receive a status code of 201 for the response.", tests.Success, testID)
 
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+
 			// Define what we wanted to receive.
 			// We will just trust the generated fields like ID and Dates so we copy u.
 			exp := got
@@ -124,8 +174,49 @@ func (ut *UserTests) deleteUser204(t *testing.T, id string) {
 	}
 }
 
-// getUser200 validates a user request for an existing userid.
-func (ut *UserTests) getUser200(t *testing.T, id string) {
+// restoreUser204 validates bringing back a user that was deleted.
+func (ut *UserTests) restoreUser204(t *testing.T, id string) {
+	get := func() int {
+		r := httptest.NewRequest(http.MethodGet, "/users/"+id, nil)
+		w := httptest.NewRecorder()
+
+		r.Header.Set("Authorization", "Bearer "+ut.adminToken)
+		ut.app.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	t.Log("Given the need to restore a deleted user.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using the deleted user %s.", testID, id)
+		{
+			if code := get(); code != http.StatusNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 404 for the deleted user : %v", tests.Failed, testID, code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 404 for the deleted user.", tests.Success, testID)
+
+			r := httptest.NewRequest(http.MethodPost, "/users/"+id+"/restore", nil)
+			w := httptest.NewRecorder()
+
+			r.Header.Set("Authorization", "Bearer "+ut.adminToken)
+			ut.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 204 for the restore : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 204 for the restore.", tests.Success, testID)
+
+			if code := get(); code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the restored user : %v", tests.Failed, testID, code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 200 for the restored user.", tests.Success, testID)
+		}
+	}
+}
+
+// getUser200 validates a user request for an existing userid. It returns the
+// ETag of the user.
+func (ut *UserTests) getUser200(t *testing.T, id string) string {
 	r := httptest.NewRequest(http.MethodGet, "/users/"+id, nil)
 	w := httptest.NewRecorder()
 
@@ -159,18 +250,26 @@ func (ut *UserTests) getUser200(t *testing.T, id string) {
 				t.Fatalf("\t%s\tTest %d:\tShould get the expected result. Diff:\n%s", tests.Failed, testID, diff)
 			}
 			t.Logf("\t%s\tTest %d:\tShould get the expected result. Diff:\n", tests.Success, testID)
+
+			if tag := w.Header().Get("ETag"); tag != `"1"` {
+				t.Fatalf("\t%s\tTest %d:\tShould get the version as the ETag : got %q.", tests.Failed, testID, tag)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the version as the ETag.", tests.Success, testID)
 		}
 	}
+
+	return w.Header().Get("ETag")
 }
 
 // putUser204 validates updating a user that does exist.
-func (ut *UserTests) putUser204(t *testing.T, id string) {
+func (ut *UserTests) putUser204(t *testing.T, id string, tag string) {
 	body := `{"name": "E -40"}`
 
 	r := httptest.NewRequest(http.MethodPut, "/users/"+id, strings.NewReader(body))
 	w := httptest.NewRecorder()
 
 	r.Header.Set("Authorization", "Bearer "+ut.adminToken)
+	r.Header.Set("If-Match", tag)
 	ut.app.ServeHTTP(w, r)
 
 	t.Log("Given the need to update a user with the users endpoint.")
@@ -208,18 +307,72 @@ func (ut *UserTests) putUser204(t *testing.T, id string) {
 				t.Fatalf("\t%s\tTest %d:\tShould see an updated Email : got %q want q", tests.Failed, testID, ru.Email)
 			}
 			t.Logf("\t%s\tTest %d:\tShould see an updated Email.", tests.Success, testID)
+
+			if w.Header().Get("ETag") == tag {
+				t.Fatalf("\t%s\tTest %d:\tShould see a new ETag : got %q.", tests.Failed, testID, tag)
+			}
+			t.Logf("\t%s\tTest %d:\tShould see a new ETag.", tests.Success, testID)
+		}
+	}
+}
+
+// putUser412 validates that an update made from a stale copy of a user is
+// rejected.
+func (ut *UserTests) putUser412(t *testing.T, id string, tag string) {
+	body := `{"name": "Earl Stevens"}`
+
+	r := httptest.NewRequest(http.MethodPut, "/users/"+id, strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+ut.adminToken)
+	r.Header.Set("If-Match", tag)
+	ut.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to stop concurrent updates overwriting each other.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using an ETag that is out of date.", testID)
+		{
+			if w.Code != http.StatusPreconditionFailed {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 412 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 412 for the response.", tests.Success, testID)
+		}
+	}
+}
+
+// putUser428 validates that an update must say which version it replaces.
+func (ut *UserTests) putUser428(t *testing.T, id string) {
+	body := `{"name": "Earl Stevens"}`
+
+	r := httptest.NewRequest(http.MethodPut, "/users/"+id, strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+ut.adminToken)
+	ut.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to stop concurrent updates overwriting each other.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the If-Match header is missing.", testID)
+		{
+			if w.Code != http.StatusPreconditionRequired {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 428 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 428 for the response.", tests.Success, testID)
 		}
 	}
 }
 
 // putUser403 validates that a user can't modify users unless they are an admin.
-func (ut *UserTests) putUser403(t *testing.T, id string) {
+func (ut *UserTests) putUser403(t *testing.T, id string, tag string) {
 	body := `{"name": "Brad Jordan"}`
 
 	r := httptest.NewRequest(http.MethodPut, "/users/"+id, strings.NewReader(body))
 	w := httptest.NewRecorder()
 
 	r.Header.Set("Authorization", "Bearer "+ut.userToken)
+	r.Header.Set("If-Match", tag)
 	ut.app.ServeHTTP(w, r)
 
 	t.Log("Given the need to update a user with the users endpoint.")
@@ -234,3 +387,408 @@ func (ut *UserTests) putUser403(t *testing.T, id string) {
 		}
 	}
 }
+
+// getAudit200 validates the history of a user is recorded newest first and
+// that the password hash never shows up in it.
+func (ut *UserTests) getAudit200(t *testing.T, id string) {
+	r := httptest.NewRequest(http.MethodGet, "/audit?entity=user:"+id, nil)
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+ut.adminToken)
+	ut.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to review the changes made to a user.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using the restored user %s.", testID, id)
+		{
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 200 for the response.", tests.Success, testID)
+
+			var events []audit.Event
+			if err := json.NewDecoder(w.Body).Decode(&events); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+
+			var got []string
+			for _, ev := range events {
+				got = append(got, ev.Action)
+				if _, ok := ev.Changes["password_hash"]; ok {
+					t.Fatalf("\t%s\tTest %d:\tShould not record the password hash in the %s event.", tests.Failed, testID, ev.Action)
+				}
+			}
+			exp := []string{audit.ActionRestore, audit.ActionDelete, audit.ActionUpdate, audit.ActionCreate}
+			if diff := cmp.Diff(got, exp); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get the events newest first. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the events newest first.", tests.Success, testID)
+
+			if events[0].Actor != events[3].Actor || events[0].Actor == "" {
+				t.Fatalf("\t%s\tTest %d:\tShould record the admin as the actor : %q", tests.Failed, testID, events[0].Actor)
+			}
+			t.Logf("\t%s\tTest %d:\tShould record the admin as the actor.", tests.Success, testID)
+		}
+	}
+}
+
+// getAudit403 validates only admins can read the audit log.
+func (ut *UserTests) getAudit403(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/audit", nil)
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+ut.userToken)
+	ut.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to keep the audit log away from regular users.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using a user token.", testID)
+		{
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 403 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 403 for the response.", tests.Success, testID)
+		}
+	}
+}
+
+// me validates regular users can read and change their own profile but not
+// their roles, and need their old password to change it.
+func (ut *UserTests) me(t *testing.T) {
+	send := func(method string, target string, tag string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		w := httptest.NewRecorder()
+
+		r.Header.Set("Authorization", "Bearer "+ut.userToken)
+		if tag != "" {
+			r.Header.Set("If-Match", tag)
+		}
+		ut.app.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Log("Given the need for users to manage their own profile.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using a user token.", testID)
+		{
+			w := send(http.MethodGet, "/me", "", "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the profile : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 200 for the profile.", tests.Success, testID)
+
+			var got user.Info
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+			if got.Email != "user@example.com" {
+				t.Fatalf("\t%s\tTest %d:\tShould get the user of the token : %s", tests.Failed, testID, got.Email)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the user of the token.", tests.Success, testID)
+
+			tag := w.Header().Get("ETag")
+			if w := send(http.MethodPut, "/me", tag, `{"roles":["ADMIN"]}`); w.Code != http.StatusBadRequest {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 400 for changing roles : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 400 for changing roles.", tests.Success, testID)
+
+			if w := send(http.MethodPut, "/me", tag, `{"email":"someone@example.com"}`); w.Code != http.StatusForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 403 for changing the email without the password : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 403 for changing the email without the password.", tests.Success, testID)
+
+			if w := send(http.MethodPut, "/me", tag, `{"name":"Jill Walker"}`); w.Code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 204 for changing the name : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 204 for changing the name.", tests.Success, testID)
+
+			body := `{"old_password":"guessed","password":"hijacked","password_confirm":"hijacked"}`
+			if w := send(http.MethodPut, "/me/password", "", body); w.Code != http.StatusForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 403 for a wrong old password : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 403 for a wrong old password.", tests.Success, testID)
+		}
+	}
+}
+
+// signup validates a user can sign themselves up and only authenticate once
+// they followed the link sent to verify their email, and that signing up
+// again answers the same way.
+func (ut *UserTests) signup(t *testing.T) {
+	ns := user.NewSignup{
+		Name:            "Ann Signup",
+		Email:           "ann@signup.com",
+		Password:        "gophers",
+		PasswordConfirm: "gophers",
+	}
+	body, err := json.Marshal(&ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Log("Given the need to let people sign themselves up.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen signing up with a new email.", testID)
+		{
+			r := httptest.NewRequest(http.MethodPost, "/signup", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+			ut.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 202 for the signup : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 202 for the signup.", tests.Success, testID)
+
+			got, err := ut.users.QueryForMail(tests.Context(), "00000000-0000-0000-0000-000000000000", ns.Email)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to find the user : %v", tests.Failed, testID, err)
+			}
+			if diff := cmp.Diff([]string(got.Roles), []string{auth.RoleUser}); diff != "" || got.DateVerified != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be an unverified user : %+v", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be an unverified user.", tests.Success, testID)
+
+			ut.mail.Reset()
+			r = httptest.NewRequest(http.MethodPost, "/signup", bytes.NewReader(body))
+			w = httptest.NewRecorder()
+			ut.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 202 for signing up twice : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 202 for signing up twice.", tests.Success, testID)
+
+			r = httptest.NewRequest(http.MethodGet, "/users/token/"+ut.kid, nil)
+			w = httptest.NewRecorder()
+			r.SetBasicAuth(ns.Email, ns.Password)
+			ut.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 403 for a token before verifying : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 403 for a token before verifying.", tests.Success, testID)
+
+			match := regexp.MustCompile(`http://localhost:3000/verify\?token=(\S+)`).FindStringSubmatch(ut.mail.String())
+			if match == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould mail a verification link : %s", tests.Failed, testID, ut.mail)
+			}
+			t.Logf("\t%s\tTest %d:\tShould mail a verification link.", tests.Success, testID)
+
+			r = httptest.NewRequest(http.MethodGet, "/verify?token="+url.QueryEscape("bogus."+match[1]), nil)
+			w = httptest.NewRecorder()
+			ut.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 400 for a tampered link : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 400 for a tampered link.", tests.Success, testID)
+
+			r = httptest.NewRequest(http.MethodGet, "/verify?token="+match[1], nil)
+			w = httptest.NewRecorder()
+			ut.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 204 for the verify : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 204 for the verify.", tests.Success, testID)
+
+			if _, err := ut.users.Authenticate(tests.Context(), "00000000-0000-0000-0000-000000000000", time.Now(), ns.Email, ns.Password); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to authenticate once verified : %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to authenticate once verified.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen signing up with a verified email.", testID)
+		{
+			ut.mail.Reset()
+			r := httptest.NewRequest(http.MethodPost, "/signup", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+			ut.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 202 for the signup : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 202 for the signup.", tests.Success, testID)
+
+			if !strings.Contains(ut.mail.String(), "already have an account") || strings.Contains(ut.mail.String(), "/verify?token=") {
+				t.Fatalf("\t%s\tTest %d:\tShould tell the owner they already have an account : %s", tests.Failed, testID, ut.mail)
+			}
+			t.Logf("\t%s\tTest %d:\tShould tell the owner they already have an account.", tests.Success, testID)
+		}
+	}
+}
+
+// changeEmail validates a user who changes their email has to verify the new
+// one before they can authenticate again. It relies on the user verified by
+// signup.
+func (ut *UserTests) changeEmail(t *testing.T) {
+	const email = "ann@changed.com"
+
+	t.Log("Given the need to verify a changed email.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a verified user changes their email.", testID)
+		{
+			claims, err := ut.users.Authenticate(tests.Context(), "00000000-0000-0000-0000-000000000000", time.Now(), "ann@signup.com", "gophers")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to authenticate the verified user : %v", tests.Failed, testID, err)
+			}
+			token, err := ut.auth.GenerateToken(ut.kid, claims)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to generate a token : %v", tests.Failed, testID, err)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/me", nil)
+			w := httptest.NewRecorder()
+			r.Header.Set("Authorization", "Bearer "+token)
+			ut.app.ServeHTTP(w, r)
+			tag := w.Header().Get("ETag")
+
+			ut.mail.Reset()
+			body := `{"email":"` + email + `","current_password":"gophers"}`
+			r = httptest.NewRequest(http.MethodPut, "/me", strings.NewReader(body))
+			w = httptest.NewRecorder()
+			r.Header.Set("Authorization", "Bearer "+token)
+			r.Header.Set("If-Match", tag)
+			ut.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 204 for changing the email : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 204 for changing the email.", tests.Success, testID)
+
+			got, err := ut.users.QueryForMail(tests.Context(), "00000000-0000-0000-0000-000000000000", email)
+			if err != nil || got.DateVerified != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould leave the new email unverified : %+v : %v", tests.Failed, testID, got, err)
+			}
+			if _, err := ut.users.Authenticate(tests.Context(), "00000000-0000-0000-0000-000000000000", time.Now(), email, "gophers"); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to authenticate before verifying the new email.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould leave the new email unverified.", tests.Success, testID)
+
+			match := regexp.MustCompile(`http://localhost:3000/verify\?token=(\S+)`).FindStringSubmatch(ut.mail.String())
+			if match == nil || !strings.Contains(ut.mail.String(), email) {
+				t.Fatalf("\t%s\tTest %d:\tShould mail a verification link to the new email : %s", tests.Failed, testID, ut.mail)
+			}
+			t.Logf("\t%s\tTest %d:\tShould mail a verification link to the new email.", tests.Success, testID)
+
+			r = httptest.NewRequest(http.MethodGet, "/verify?token="+match[1], nil)
+			w = httptest.NewRecorder()
+			ut.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 204 for the verify : %v", tests.Failed, testID, w.Code)
+			}
+			if _, err := ut.users.Authenticate(tests.Context(), "00000000-0000-0000-0000-000000000000", time.Now(), email, "gophers"); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to authenticate once the new email is verified : %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to authenticate once the new email is verified.", tests.Success, testID)
+		}
+	}
+}
+
+// forgotPassword validates asking for a password reset does not reveal
+// whether an email belongs to a user.
+func (ut *UserTests) forgotPassword(t *testing.T) {
+	t.Log("Given the need to keep password resets from revealing accounts.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen asking for a reset of an unknown email.", testID)
+		{
+			sent := ut.mail.Len()
+
+			r := httptest.NewRequest(http.MethodPost, "/password/forgot", strings.NewReader(`{"email":"nobody@example.com"}`))
+			w := httptest.NewRecorder()
+			ut.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 202 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 202 for the response.", tests.Success, testID)
+
+			if ut.mail.Len() != sent {
+				t.Fatalf("\t%s\tTest %d:\tShould not send any mail : %s", tests.Failed, testID, ut.mail)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not send any mail.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen asking for a reset without an email.", testID)
+		{
+			r := httptest.NewRequest(http.MethodPost, "/password/forgot", strings.NewReader(`{}`))
+			w := httptest.NewRecorder()
+			ut.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 400 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 400 for the response.", tests.Success, testID)
+		}
+	}
+}
+
+// conflictStore reports every update as a conflict, as if another request
+// always changed the user first.
+type conflictStore struct {
+	user.Store
+}
+
+func (conflictStore) Update(ctx context.Context, traceID string, usr user.Info) error {
+	return user.ErrVersionConflict
+}
+
+// TestUserConflicts validates every endpoint updating a user answers a
+// conflicting write with 412.
+func TestUserConflicts(t *testing.T) {
+	test := tests.NewMemoryIntegration(t)
+	t.Cleanup(test.Teardown)
+
+	app := handlers.API(handlers.APIConfig{
+		Build:    "develop",
+		Shutdown: make(chan os.Signal, 1),
+		Log:      test.Log,
+		Auth:     test.Auth,
+		Users:    conflictStore{test.Users},
+		Audit:    test.Audit,
+		Roles:    test.Roles,
+		Mailer:   mail.NewFile(&bytes.Buffer{}),
+	})
+	adminToken := test.Token(test.KID, "admin@example.com", "gophers")
+	userToken := test.Token(test.KID, "user@example.com", "gophers")
+
+	reqs := []struct {
+		method string
+		target string
+		token  string
+		body   string
+	}{
+		{http.MethodPut, "/users/" + tests.UserID, adminToken, `{"name":"Jill Walker"}`},
+		{http.MethodPut, "/me", userToken, `{"name":"Jill Walker"}`},
+		{http.MethodPut, "/me/password", userToken, `{"old_password":"gophers","password":"changed","password_confirm":"changed"}`},
+	}
+
+	t.Log("Given the need to report conflicting updates the same way.")
+	{
+		for testID, req := range reqs {
+			t.Logf("\tTest %d:\tWhen another request changed the user during %s %s.", testID, req.method, req.target)
+			{
+				r := httptest.NewRequest(req.method, req.target, strings.NewReader(req.body))
+				w := httptest.NewRecorder()
+
+				r.Header.Set("Authorization", "Bearer "+req.token)
+				r.Header.Set("If-Match", `"1"`)
+				app.ServeHTTP(w, r)
+
+				if w.Code != http.StatusPreconditionFailed {
+					t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 412 for the response : %v", tests.Failed, testID, w.Code)
+				}
+				t.Logf("\t%s\tTest %d:\tShould receive a status code of 412 for the response.", tests.Success, testID)
+			}
+		}
+	}
+}
@@ -2,7 +2,10 @@
 package auth
 
 import (
-	"crypto/rsa"
+	"context"
+	"crypto"
+	"sort"
+	"sync"
 
 	"github.com/dgrijalva/jwt-go"
 	// "github.com/dgrijalva/jwt-go/v4"
@@ -15,6 +18,36 @@ const (
 	RoleUser  = "USER"
 )
 
+// These are the permissions a role can grant. A token carries the
+// permissions of its user's roles in Claims.Scopes. Users can always read and
+// change what they own; users:read, users:write and products:write extend
+// that to everyone else's, and reports:read extends the sales report to every
+// product. Assigning roles takes roles:write.
+const (
+	PermUsersRead     = "users:read"
+	PermUsersWrite    = "users:write"
+	PermRolesRead     = "roles:read"
+	PermRolesWrite    = "roles:write"
+	PermAuditRead     = "audit:read"
+	PermKeysRead      = "keys:read"
+	PermProductsWrite = "products:write"
+	PermReportsRead   = "reports:read"
+	PermTestingRead   = "testing:read"
+)
+
+// Permissions is the set of every permission a role can grant.
+var Permissions = []string{
+	PermUsersRead,
+	PermUsersWrite,
+	PermRolesRead,
+	PermRolesWrite,
+	PermAuditRead,
+	PermKeysRead,
+	PermProductsWrite,
+	PermReportsRead,
+	PermTestingRead,
+}
+
 // ctxKey represents the type of value for the context key.
 type ctxKey int
 
@@ -24,7 +57,8 @@ const Key ctxKey = 1
 // Claims represents the authorization claims transmitted via a JWT.
 type Claims struct {
 	jwt.StandardClaims
-	Roles []string `json:"roles"`
+	Roles  []string `json:"roles"`
+	Scopes []string `json:"scopes,omitempty"`
 }
 
 // Authorize returns true if the claims has at least one of the provided roles.
@@ -39,8 +73,21 @@ func (c Claims) Authorize(roles ...string) bool {
 	return false
 }
 
-// Keys represents an in memory store of keys.
-type Keys map[string]*rsa.PrivateKey
+// HasPermission returns true if the claims were granted the permission.
+func (c Claims) HasPermission(permission string) bool {
+	for _, has := range c.Scopes {
+		if has == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Keys represents an in memory store of keys. Any private key usable as a
+// crypto.Signer is supported as long as it matches the signing algorithm:
+// *rsa.PrivateKey for RS*, *ecdsa.PrivateKey for ES* and ed25519.PrivateKey
+// for EdDSA.
+type Keys map[string]crypto.Signer
 
 /*
 PublicKeyLookup defines the signature of a function to lookup public keys.
@@ -55,7 +102,7 @@ A key lookup function is required for creating an Authenticator.
  * KID to public key resolution is usually accomplished via a public JWKS endpoint.
  See https://auth0.com/docs/jwks for more details.
 */
-type PublicKeyLookup func(kid string) (*rsa.PublicKey, error)
+type PublicKeyLookup func(kid string) (crypto.PublicKey, error)
 
 // KeyLookup declares a method set of behavior for looking up
 // private and public keys for JWT use.
@@ -64,24 +111,52 @@ type PublicKeyLookup func(kid string) (*rsa.PublicKey, error)
 // 	PublicKey(kid string) (*rsa.PublicKey, error)
 // }
 
+// Denylist declares the behavior for checking whether a token id (jti) has
+// been revoked before the token expired.
+type Denylist interface {
+	Denied(ctx context.Context, jti string) (bool, error)
+}
+
 // Auth is used to authenticate clients. It can generate a token for a
-// set of user claims and recreate the claims by parsing the token.
+// set of user claims and recreate the claims by parsing the token. The key
+// store is safe to change while tokens are generated and validated.
 type Auth struct {
 	algorithm string
 	// keyLookup KeyLookup
 	// method    jwt.SigningMethod
-	keyFunc func(t *jwt.Token) (interface{}, error)
-	parser  *jwt.Parser
-	keys    Keys
+	keyFunc  func(t *jwt.Token) (interface{}, error)
+	parser   *jwt.Parser
+	denylist Denylist
+
+	mu        sync.RWMutex
+	keys      Keys
+	activeKID string
 }
 
-// New creates an *Auth to support authentication/authorization.
+// New creates an *Auth to support authentication/authorization. The keys are
+// copied into the Auth's own store. A nil lookup resolves public keys from
+// that store so keys added or reloaded later are used for verification.
 // func New(algorithm string, keyLookup KeyLookup) (*Auth, error) {
 func New(algorithm string, lookup PublicKeyLookup, keys Keys) (*Auth, error) {
 	if jwt.GetSigningMethod(algorithm) == nil {
 		return nil, errors.Errorf("unknown algorithm %v", algorithm)
 	}
 
+	a := Auth{
+		algorithm: algorithm,
+		keys:      make(Keys, len(keys)),
+	}
+	for kid, privateKey := range keys {
+		if err := CheckKey(algorithm, privateKey); err != nil {
+			return nil, errors.Wrapf(err, "key %s", kid)
+		}
+		a.keys[kid] = privateKey
+	}
+
+	if lookup == nil {
+		lookup = a.publicKey
+	}
+
 	keyFunc := func(t *jwt.Token) (interface{}, error) {
 		kid, ok := t.Header["kid"]
 		if !ok {
@@ -102,31 +177,117 @@ func New(algorithm string, lookup PublicKeyLookup, keys Keys) (*Auth, error) {
 		ValidMethods: []string{algorithm},
 	}
 
-	a := Auth{
-		algorithm: algorithm,
-		// keyLookup: keyLookup,
-		// method:    method,
-		keyFunc: keyFunc,
-		parser:  &parser,
-		keys:    keys,
-	}
+	// a.keyLookup = keyLookup
+	// a.method = method
+	a.keyFunc = keyFunc
+	a.parser = &parser
 
 	return &a, nil
 
 }
 
-// AddKey adds a private key and combination kid id to our local store.
-func (a *Auth) AddKey(privateKey *rsa.PrivateKey, kid string) {
+// SetDenylist sets the store used to reject revoked tokens. It must be called
+// before the Auth is used to validate tokens.
+func (a *Auth) SetDenylist(denylist Denylist) {
+	a.denylist = denylist
+}
+
+// SetActiveKID sets the key used to sign tokens when no kid is requested.
+// Every other key in the store remains valid for verification so keys can be
+// rotated without invalidating tokens that are already issued.
+func (a *Auth) SetActiveKID(kid string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.keys[kid]; !ok {
+		return errors.Errorf("active kid %s not found in key store", kid)
+	}
+	a.activeKID = kid
+	return nil
+}
+
+// AddKey adds a private key and combination kid id to our local store. The
+// key must suit the algorithm of the Auth.
+func (a *Auth) AddKey(privateKey crypto.Signer, kid string) error {
+	if err := CheckKey(a.algorithm, privateKey); err != nil {
+		return errors.Wrapf(err, "key %s", kid)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
 	a.keys[kid] = privateKey
+	return nil
 }
 
 // RemoveKey removes a private key and combination kid id from our local store.
 func (a *Auth) RemoveKey(kid string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
 	delete(a.keys, kid)
 }
 
+// ReplaceKeys swaps the whole key store in one step and sets the active key.
+// Tokens signed by keys missing from the new store stop validating. The store
+// is left untouched when any of the keys doesn't suit the algorithm.
+func (a *Auth) ReplaceKeys(keys Keys, activeKID string) error {
+	if _, ok := keys[activeKID]; !ok {
+		return errors.Errorf("active kid %s not found in key store", activeKID)
+	}
+
+	store := make(Keys, len(keys))
+	for kid, privateKey := range keys {
+		if err := CheckKey(a.algorithm, privateKey); err != nil {
+			return errors.Wrapf(err, "key %s", kid)
+		}
+		store[kid] = privateKey
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.keys = store
+	a.activeKID = activeKID
+	return nil
+}
+
+// KIDs returns the sorted ids of the keys currently loaded and the id of the
+// active key.
+func (a *Auth) KIDs() ([]string, string) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	kids := make([]string, 0, len(a.keys))
+	for kid := range a.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	return kids, a.activeKID
+}
+
+// publicKey looks up the public half of a key in the store.
+func (a *Auth) publicKey(kid string) (crypto.PublicKey, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	privateKey, ok := a.keys[kid]
+	if !ok {
+		return nil, errors.Errorf("no public key found for the specified kid: %s", kid)
+	}
+	return privateKey.Public(), nil
+}
+
 // GenerateToken generates a signed JWT token string representing the user Claims.
+// An empty kid signs the token with the active key.
 func (a *Auth) GenerateToken(kid string, claims Claims) (string, error) {
+	a.mu.RLock()
+	if kid == "" {
+		kid = a.activeKID
+	}
+	privateKey, ok := a.keys[kid]
+	a.mu.RUnlock()
 
 	// method := jwt.GetSigningMethod("RS256")
 	method := jwt.GetSigningMethod(a.algorithm)
@@ -134,7 +295,6 @@ func (a *Auth) GenerateToken(kid string, claims Claims) (string, error) {
 	token := jwt.NewWithClaims(method, claims)
 	token.Header["kid"] = kid
 
-	privateKey, ok := a.keys[kid]
 	if !ok {
 		return "", errors.New("kid lookup failed")
 	}
@@ -148,8 +308,9 @@ func (a *Auth) GenerateToken(kid string, claims Claims) (string, error) {
 }
 
 // ValidateToken recreates the Claims that were used to generate a token. It
-// verifies that the token was signed using our key.
-func (a *Auth) ValidateToken(tokenStr string) (Claims, error) {
+// verifies that the token was signed using our key and, when a denylist is
+// set, that the token has not been revoked.
+func (a *Auth) ValidateToken(ctx context.Context, tokenStr string) (Claims, error) {
 	var claims Claims
 	token, err := a.parser.ParseWithClaims(tokenStr, &claims, a.keyFunc)
 	if err != nil {
@@ -160,5 +321,15 @@ func (a *Auth) ValidateToken(tokenStr string) (Claims, error) {
 		return Claims{}, errors.New("invalid token")
 	}
 
+	if a.denylist != nil && claims.Id != "" {
+		denied, err := a.denylist.Denied(ctx, claims.Id)
+		if err != nil {
+			return Claims{}, errors.Wrap(err, "checking denylist")
+		}
+		if denied {
+			return Claims{}, errors.New("token has been revoked")
+		}
+	}
+
 	return claims, nil
 }
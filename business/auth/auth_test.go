@@ -1,9 +1,16 @@
 package auth_test
 
 import (
+	"context"
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -33,7 +40,7 @@ func TestAuth(t *testing.T) {
 
 			// The key id we are stating represents the public key in the public key store.
 			const keyID = "54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"
-			lookup := func(kid string) (*rsa.PublicKey, error) {
+			lookup := func(kid string) (crypto.PublicKey, error) {
 				switch kid {
 				case keyID:
 					return &privateKey.PublicKey, nil
@@ -65,7 +72,7 @@ func TestAuth(t *testing.T) {
 			}
 			t.Logf("\t%s\tTest %d:\tShould be able to generate a JWT.", success, testID)
 
-			parsedClaims, err := a.ValidateToken(token)
+			parsedClaims, err := a.ValidateToken(context.Background(), token)
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to parse the claims: %v", failed, testID, err)
 			}
@@ -88,6 +95,308 @@ func TestAuth(t *testing.T) {
 	}
 }
 
+func TestKeys(t *testing.T) {
+	t.Log("Given the need to rotate keys loaded from a directory.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen handling a directory with two keys.", testID)
+		{
+			dir := t.TempDir()
+			for _, kid := range []string{"old", "new"} {
+				privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to generate a private key: %v", failed, testID, err)
+				}
+				block := pem.Block{
+					Type:  "RSA PRIVATE KEY",
+					Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+				}
+				if err := ioutil.WriteFile(filepath.Join(dir, kid+".pem"), pem.EncodeToMemory(&block), 0600); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to write the key file: %v", failed, testID, err)
+				}
+			}
+
+			keys, err := auth.LoadKeys(dir)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to load the keys: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to load the keys.", success, testID)
+
+			a, err := auth.New("RS256", nil, keys)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create an authenticator: %v", failed, testID, err)
+			}
+			if err := a.SetActiveKID("new"); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to set the active key: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to set the active key.", success, testID)
+
+			claims := auth.Claims{
+				StandardClaims: jwt.StandardClaims{
+					Subject:   "5cf37266-3473-4006-984f-9325122678b7",
+					ExpiresAt: time.Now().Add(time.Hour).Unix(),
+					IssuedAt:  time.Now().Unix(),
+				},
+				Roles: []string{auth.RoleUser},
+			}
+
+			for _, kid := range []string{"", "old"} {
+				token, err := a.GenerateToken(kid, claims)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to generate a JWT with kid %q: %v", failed, testID, kid, err)
+				}
+				if _, err := a.ValidateToken(context.Background(), token); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to validate a JWT with kid %q: %v", failed, testID, kid, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to validate tokens signed by the active and older keys.", success, testID)
+
+			if got := len(a.JWKS().Keys); got != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould publish both keys in the JWKS: got %d", failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould publish both keys in the JWKS.", success, testID)
+
+			if err := ioutil.WriteFile(filepath.Join(dir, auth.ActiveFile), []byte("old"), 0600); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to write the active file: %v", failed, testID, err)
+			}
+			if err := a.ReloadKeys(dir, "new"); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reload the keys: %v", failed, testID, err)
+			}
+			if _, active := a.KIDs(); active != "old" {
+				t.Fatalf("\t%s\tTest %d:\tShould sign with the key named in the active file after a reload: got %s", failed, testID, active)
+			}
+			t.Logf("\t%s\tTest %d:\tShould sign with the key named in the active file after a reload.", success, testID)
+		}
+	}
+}
+
+func TestActiveKID(t *testing.T) {
+	one := auth.Keys{"only": nil}
+	two := auth.Keys{"old": nil, "new": nil}
+
+	empty := t.TempDir()
+	named := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(named, auth.ActiveFile), []byte("old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		name string
+		dir  string
+		keys auth.Keys
+		kid  string
+		exp  string
+		fail bool
+	}{
+		{"configured", empty, two, "new", "new", false},
+		{"single key", empty, one, "", "only", false},
+		{"several keys", empty, two, "", "", true},
+		{"named in the active file", named, two, "new", "old", false},
+	}
+
+	t.Log("Given the need to pick the key that signs new tokens.")
+	{
+		for testID, tst := range tt {
+			t.Logf("\tTest %d:\tWhen the kid is %s.", testID, tst.name)
+			{
+				got, err := auth.ActiveKID(tst.dir, tst.keys, tst.kid)
+				if tst.fail {
+					if err == nil {
+						t.Fatalf("\t%s\tTest %d:\tShould require a configured kid : got %s.", failed, testID, got)
+					}
+					t.Logf("\t%s\tTest %d:\tShould require a configured kid.", success, testID)
+					continue
+				}
+				if err != nil || got != tst.exp {
+					t.Fatalf("\t%s\tTest %d:\tShould pick %s : got %s, %v.", failed, testID, tst.exp, got, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould pick %s.", success, testID, tst.exp)
+			}
+		}
+	}
+}
+
+func TestAlgorithms(t *testing.T) {
+	t.Log("Given the need to sign tokens with different key types.")
+	{
+		algorithms := []string{"RS256", "ES256", "ES384", "ES512", "EdDSA"}
+
+		for testID, alg := range algorithms {
+			t.Logf("\tTest %d:\tWhen using the %s algorithm.", testID, alg)
+			{
+				key, err := auth.GenerateKey(alg)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to generate a key: %v", failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to generate a key.", success, testID)
+
+				const keyID = "54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"
+				keys := auth.Keys{keyID: key}
+
+				a, err := auth.New(alg, nil, keys)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to create an authenticator: %v", failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to create an authenticator.", success, testID)
+
+				claims := auth.Claims{
+					StandardClaims: jwt.StandardClaims{
+						Subject:   "5cf37266-3473-4006-984f-9325122678b7",
+						ExpiresAt: time.Now().Add(time.Hour).Unix(),
+						IssuedAt:  time.Now().Unix(),
+					},
+					Roles: []string{auth.RoleAdmin},
+				}
+
+				token, err := a.GenerateToken(keyID, claims)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to generate a JWT: %v", failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to generate a JWT.", success, testID)
+
+				parsedClaims, err := a.ValidateToken(context.Background(), token)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to parse the claims: %v", failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to parse the claims.", success, testID)
+
+				if exp, got := claims.Subject, parsedClaims.Subject; exp != got {
+					t.Fatalf("\t%s\tTest %d:\tShould have the expected subject: exp %s got %s", failed, testID, exp, got)
+				}
+				t.Logf("\t%s\tTest %d:\tShould have the expected subject.", success, testID)
+
+				if got := len(a.JWKS().Keys); got != 1 {
+					t.Fatalf("\t%s\tTest %d:\tShould publish the key in the JWKS: got %d", failed, testID, got)
+				}
+				t.Logf("\t%s\tTest %d:\tShould publish the key in the JWKS.", success, testID)
+			}
+		}
+	}
+}
+
+func TestKeyTypes(t *testing.T) {
+	t.Log("Given the need to only sign with keys that suit the algorithm.")
+	{
+		keys := make(map[string]crypto.Signer)
+		for _, alg := range []string{"RS256", "ES256", "ES384", "EdDSA"} {
+			key, err := auth.GenerateKey(alg)
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to generate a %s key: %v", failed, alg, err)
+			}
+			keys[alg] = key
+		}
+
+		mismatches := []struct {
+			alg string
+			key string
+		}{
+			{"RS256", "ES256"},
+			{"ES256", "RS256"},
+			{"ES256", "ES384"},
+			{"EdDSA", "ES256"},
+		}
+
+		for testID, tst := range mismatches {
+			t.Logf("\tTest %d:\tWhen using a %s key under %s.", testID, tst.key, tst.alg)
+			{
+				if _, err := auth.New(tst.alg, nil, auth.Keys{"bad": keys[tst.key]}); err == nil {
+					t.Fatalf("\t%s\tTest %d:\tShould NOT be able to create an authenticator.", failed, testID)
+				}
+				t.Logf("\t%s\tTest %d:\tShould NOT be able to create an authenticator.", success, testID)
+
+				a, err := auth.New(tst.alg, nil, auth.Keys{"good": keys[tst.alg]})
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to create an authenticator: %v", failed, testID, err)
+				}
+				if err := a.AddKey(keys[tst.key], "bad"); err == nil {
+					t.Fatalf("\t%s\tTest %d:\tShould NOT be able to add the key.", failed, testID)
+				}
+				if err := a.ReplaceKeys(auth.Keys{"good": keys[tst.alg], "bad": keys[tst.key]}, "good"); err == nil {
+					t.Fatalf("\t%s\tTest %d:\tShould NOT be able to reload the key.", failed, testID)
+				}
+				if kids, _ := a.KIDs(); len(kids) != 1 || kids[0] != "good" {
+					t.Fatalf("\t%s\tTest %d:\tShould keep the keys it had: %v", failed, testID, kids)
+				}
+				t.Logf("\t%s\tTest %d:\tShould NOT be able to add or reload the key.", success, testID)
+			}
+		}
+	}
+}
+
+func TestConcurrentRotation(t *testing.T) {
+	t.Log("Given the need to rotate keys while tokens are in use.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen keys change during token generation and validation.", testID)
+		{
+			activeKey, err := rsa.GenerateKey(rand.Reader, 2048)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to generate a private key: %v", failed, testID, err)
+			}
+			rotatedKey, err := rsa.GenerateKey(rand.Reader, 2048)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to generate a private key: %v", failed, testID, err)
+			}
+
+			a, err := auth.New("RS256", nil, auth.Keys{"active": activeKey})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create an authenticator: %v", failed, testID, err)
+			}
+			if err := a.SetActiveKID("active"); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to set the active key: %v", failed, testID, err)
+			}
+
+			claims := auth.Claims{
+				StandardClaims: jwt.StandardClaims{
+					Subject:   "5cf37266-3473-4006-984f-9325122678b7",
+					ExpiresAt: time.Now().Add(time.Hour).Unix(),
+					IssuedAt:  time.Now().Unix(),
+				},
+				Roles: []string{auth.RoleUser},
+			}
+
+			// Run with -race to detect unsynchronized access to the key store.
+			var wg sync.WaitGroup
+			errs := make(chan error, 8)
+			for g := 0; g < 8; g++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < 20; i++ {
+						token, err := a.GenerateToken("", claims)
+						if err != nil {
+							errs <- err
+							return
+						}
+						if _, err := a.ValidateToken(context.Background(), token); err != nil {
+							errs <- err
+							return
+						}
+						a.JWKS()
+					}
+				}()
+			}
+			for i := 0; i < 20; i++ {
+				if err := a.AddKey(rotatedKey, "rotated"); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to add a key: %v", failed, testID, err)
+				}
+				a.KIDs()
+				a.RemoveKey("rotated")
+				if err := a.ReplaceKeys(auth.Keys{"active": activeKey}, "active"); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to replace the keys: %v", failed, testID, err)
+				}
+			}
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to use tokens while rotating keys: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to use tokens while rotating keys.", success, testID)
+		}
+	}
+}
+
 // =============================================================================
 
 type keyStore struct {
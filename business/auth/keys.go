@@ -0,0 +1,263 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNoKeys is returned by LoadKeys when the directory holds no key files.
+var ErrNoKeys = errors.New("no key files found")
+
+// LoadKeys reads every PEM encoded private key in the specified directory.
+// The name of each file without the .pem extension is used as the key id.
+func LoadKeys(dir string) (Keys, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, errors.Wrap(err, "listing key files")
+	}
+	if len(files) == 0 {
+		return nil, errors.Wrapf(ErrNoKeys, "in %s", dir)
+	}
+
+	keys := make(Keys)
+	for _, file := range files {
+		privatePEM, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading key file %s", file)
+		}
+
+		privateKey, err := ParsePrivateKeyFromPEM(privatePEM)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing key file %s", file)
+		}
+
+		kid := strings.TrimSuffix(filepath.Base(file), ".pem")
+		keys[kid] = privateKey
+	}
+
+	return keys, nil
+}
+
+// ActiveFile is the name of the file in a keys folder that names the kid of
+// the active key. Signing is rotated to a new key by writing its kid to the
+// file and reloading the keys, without a restart.
+const ActiveFile = "active"
+
+// ActiveKID returns the kid of the key that signs new tokens. The kid in the
+// ActiveFile of the directory is used when there is one, then the configured
+// kid. When neither is set the store must hold exactly one key and that key
+// is used.
+func ActiveKID(dir string, keys Keys, kid string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, ActiveFile))
+	switch {
+	case err == nil:
+		if named := strings.TrimSpace(string(data)); named != "" {
+			return named, nil
+		}
+	case !os.IsNotExist(err):
+		return "", errors.Wrap(err, "reading active kid file")
+	}
+
+	if kid != "" {
+		return kid, nil
+	}
+	if len(keys) != 1 {
+		return "", errors.Errorf("an active kid must be configured when %d keys are loaded", len(keys))
+	}
+	for kid := range keys {
+		return kid, nil
+	}
+	return "", nil
+}
+
+// GenerateKey generates a private key for the signing algorithm. RS*
+// algorithms use RSA keys, ES256/ES384/ES512 use ECDSA keys on the matching
+// curve and EdDSA uses Ed25519 keys.
+func GenerateKey(algorithm string) (crypto.Signer, error) {
+	switch algorithm {
+	case "RS256", "RS384", "RS512":
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ES384":
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "ES512":
+		return ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case "EdDSA":
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return nil, errors.Errorf("unsupported algorithm %q", algorithm)
+}
+
+// CheckKey returns an error unless the key is of the type the signing
+// algorithm uses, as GenerateKey makes them. A key of another type would be
+// published with the wrong alg and fail to sign.
+func CheckKey(algorithm string, key crypto.Signer) error {
+	switch algorithm {
+	case "RS256", "RS384", "RS512":
+		if _, ok := key.(*rsa.PrivateKey); ok {
+			return nil
+		}
+		return errors.Errorf("%s needs an RSA key, got %T", algorithm, key)
+	case "ES256":
+		return checkCurve(algorithm, key, elliptic.P256())
+	case "ES384":
+		return checkCurve(algorithm, key, elliptic.P384())
+	case "ES512":
+		return checkCurve(algorithm, key, elliptic.P521())
+	case "EdDSA":
+		if _, ok := key.(ed25519.PrivateKey); ok {
+			return nil
+		}
+		return errors.Errorf("%s needs an Ed25519 key, got %T", algorithm, key)
+	}
+	return errors.Errorf("unsupported algorithm %q", algorithm)
+}
+
+// checkCurve returns an error unless the key is an ECDSA key on the curve.
+func checkCurve(algorithm string, key crypto.Signer, curve elliptic.Curve) error {
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return errors.Errorf("%s needs an ECDSA key, got %T", algorithm, key)
+	}
+	if ecKey.Curve != curve {
+		return errors.Errorf("%s needs a key on %s, got %s", algorithm, curve.Params().Name, ecKey.Curve.Params().Name)
+	}
+	return nil
+}
+
+// ParsePrivateKeyFromPEM parses an RSA, ECDSA or Ed25519 private key. PKCS1
+// RSA keys, SEC1 EC keys and PKCS8 keys of any of those types are supported.
+func ParsePrivateKeyFromPEM(privatePEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(privatePEM)
+	if block == nil {
+		return nil, errors.New("key must be PEM encoded")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, errors.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	}
+
+	return nil, errors.Errorf("unsupported PEM block type %q", block.Type)
+}
+
+// ReloadKeys replaces the key store with the keys found in the specified
+// directory. The active key is picked as ActiveKID does. The store is left
+// untouched if the directory cannot be read or no longer holds the active
+// key.
+func (a *Auth) ReloadKeys(dir string, activeKID string) error {
+	keys, err := LoadKeys(dir)
+	if err != nil {
+		return err
+	}
+
+	kid, err := ActiveKID(dir, keys, activeKID)
+	if err != nil {
+		return err
+	}
+
+	return a.ReplaceKeys(keys, kid)
+}
+
+// JWK represents a single public key in JSON Web Key format.
+// See https://tools.ietf.org/html/rfc7517 and https://tools.ietf.org/html/rfc8037.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	Modulus   string `json:"n,omitempty"`
+	Exponent  string `json:"e,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// JWKS represents a set of public keys in JSON Web Key format.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of every key in the store so clients can
+// verify tokens signed by any of them.
+func (a *Auth) JWKS() JWKS {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	kids := make([]string, 0, len(a.keys))
+	for kid := range a.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	jwks := JWKS{
+		Keys: make([]JWK, 0, len(kids)),
+	}
+	for _, kid := range kids {
+		jwk := JWK{
+			KeyID:     kid,
+			Use:       "sig",
+			Algorithm: a.algorithm,
+		}
+
+		enc := base64.RawURLEncoding
+		switch pub := a.keys[kid].Public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.Modulus = enc.EncodeToString(pub.N.Bytes())
+			jwk.Exponent = enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+
+		case *ecdsa.PublicKey:
+
+			// Coordinates are padded to the full size of the curve.
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			jwk.KeyType = "EC"
+			jwk.Curve = pub.Curve.Params().Name
+			jwk.X = enc.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+			jwk.Y = enc.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = enc.EncodeToString(pub)
+
+		default:
+			continue
+		}
+
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	return jwks
+}
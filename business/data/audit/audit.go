@@ -0,0 +1,136 @@
+// Package audit records who changed what and provides the history back.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/dapperauteur/go-base-service/foundation/database"
+	"github.com/dapperauteur/go-base-service/foundation/logger"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Set of actions recorded for an entity.
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionVerify  = "verify"
+	ActionPurge   = "purge"
+)
+
+// Store declares the storage behavior Audit relies on. Query returns the
+// newest events first.
+type Store interface {
+	Create(ctx context.Context, traceID string, ev Event) error
+	Query(ctx context.Context, traceID string, filter QueryFilter, limit int) ([]Event, error)
+}
+
+// Audit manages the set of API's for audit access.
+type Audit struct {
+	log   *logger.Logger
+	store Store
+}
+
+// New constructs an Audit backed by Postgres. The db can be a *sqlx.DB or a
+// *sqlx.Tx. Events are only recorded in the same transaction as the change
+// when both are written through the same *sqlx.Tx.
+func New(log *logger.Logger, db database.Executor) Audit {
+	return NewWithStore(log, NewPostgresStore(log, db))
+}
+
+// NewWithStore constructs an Audit backed by the provided store.
+func NewWithStore(log *logger.Logger, store Store) Audit {
+	return Audit{
+		log:   log,
+		store: store,
+	}
+}
+
+// Record stores an event along with the field level difference between the
+// before and after values. Fields that are not marshalled to JSON, like
+// password hashes, are never recorded.
+func (a Audit) Record(ctx context.Context, traceID string, ne NewEvent, now time.Time) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.audit.record")
+	defer span.End()
+
+	changes, err := Diff(ne.Before, ne.After)
+	if err != nil {
+		return errors.Wrap(err, "diffing values")
+	}
+
+	ev := Event{
+		ID:          uuid.New().String(),
+		Actor:       ne.Actor,
+		Action:      ne.Action,
+		Entity:      ne.Entity,
+		EntityID:    ne.EntityID,
+		Changes:     changes,
+		TraceID:     traceID,
+		DateCreated: now.UTC(),
+	}
+
+	return a.store.Create(ctx, traceID, ev)
+}
+
+// Query retrieves up to limit events matching the filter, newest first.
+func (a Audit) Query(ctx context.Context, traceID string, filter QueryFilter, limit int) ([]Event, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.audit.query")
+	defer span.End()
+
+	return a.store.Query(ctx, traceID, filter, limit)
+}
+
+// Diff compares the JSON form of two values and returns every field whose
+// value differs. Either value can be nil to record a whole entity being
+// created or removed.
+func Diff(before interface{}, after interface{}) (Changes, error) {
+	b, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := Changes{}
+	for name, bv := range b {
+		if av, ok := a[name]; !ok || !reflect.DeepEqual(bv, av) {
+			changes[name] = Change{Before: bv, After: a[name]}
+		}
+	}
+	for name, av := range a {
+		if _, ok := b[name]; !ok {
+			changes[name] = Change{After: av}
+		}
+	}
+
+	return changes, nil
+}
+
+// fields returns the JSON fields of a value.
+func fields(v interface{}) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	if v == nil {
+		return m, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
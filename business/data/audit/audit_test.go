@@ -0,0 +1,116 @@
+package audit_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dapperauteur/go-base-service/business/data/audit"
+	"github.com/dapperauteur/go-base-service/business/tests"
+	"github.com/dapperauteur/go-base-service/foundation/logger"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAudit(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	testAudit(t, audit.New(log, db))
+}
+
+func TestAuditMemory(t *testing.T) {
+	log := logger.New(os.Stdout, "TEST", logger.LevelDebug)
+
+	testAudit(t, audit.NewWithStore(log, audit.NewMemoryStore()))
+}
+
+// testAudit runs the Audit API against a store that starts out empty.
+func testAudit(t *testing.T, a audit.Audit) {
+	t.Log("Given the need to work with the audit log.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen recording changes to an entity.", testID)
+		{
+			ctx := tests.Context()
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			type entity struct {
+				Name         string `json:"name"`
+				PasswordHash []byte `json:"-"`
+			}
+
+			events := []audit.NewEvent{
+				{
+					Actor:    "admin",
+					Action:   audit.ActionCreate,
+					Entity:   "user",
+					EntityID: "1",
+					After:    entity{Name: "Bill", PasswordHash: []byte("one")},
+				},
+				{
+					Actor:    "bill",
+					Action:   audit.ActionUpdate,
+					Entity:   "user",
+					EntityID: "1",
+					Before:   entity{Name: "Bill", PasswordHash: []byte("one")},
+					After:    entity{Name: "William", PasswordHash: []byte("two")},
+				},
+				{
+					Actor:    "admin",
+					Action:   audit.ActionCreate,
+					Entity:   "user",
+					EntityID: "2",
+					After:    entity{Name: "Jill"},
+				},
+			}
+			for i, ne := range events {
+				if err := a.Record(ctx, traceID, ne, now.Add(time.Duration(i)*time.Hour)); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to record event %d : %s.", tests.Failed, testID, i, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to record events.", tests.Success, testID)
+
+			got, err := a.Query(ctx, traceID, audit.QueryFilter{Entity: "user", EntityID: "1"}, 10)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to query the history of an entity : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to query the history of an entity.", tests.Success, testID)
+
+			if len(got) != 2 || got[0].Action != audit.ActionUpdate || got[1].Action != audit.ActionCreate {
+				t.Fatalf("\t%s\tTest %d:\tShould get the history newest first : %+v.", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the history newest first.", tests.Success, testID)
+
+			exp := audit.Changes{"name": {Before: "Bill", After: "William"}}
+			if diff := cmp.Diff(got[0].Changes, exp); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould only record the changed fields. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only record the changed fields.", tests.Success, testID)
+
+			if got[0].TraceID != traceID || got[0].Actor != "bill" {
+				t.Fatalf("\t%s\tTest %d:\tShould record the actor and trace : %+v.", tests.Failed, testID, got[0])
+			}
+			t.Logf("\t%s\tTest %d:\tShould record the actor and trace.", tests.Success, testID)
+
+			filter := audit.QueryFilter{Actor: "admin", Since: now.Add(time.Hour)}
+			got, err = a.Query(ctx, traceID, filter, 10)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to filter by actor and time : %s.", tests.Failed, testID, err)
+			}
+			if len(got) != 1 || got[0].EntityID != "2" {
+				t.Fatalf("\t%s\tTest %d:\tShould only get the later events of the actor : %+v.", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only get the later events of the actor.", tests.Success, testID)
+
+			got, err = a.Query(ctx, traceID, audit.QueryFilter{}, 1)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to limit the events : %s.", tests.Failed, testID, err)
+			}
+			if len(got) != 1 || got[0].EntityID != "2" {
+				t.Fatalf("\t%s\tTest %d:\tShould only get the newest event : %+v.", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only get the newest event.", tests.Success, testID)
+		}
+	}
+}
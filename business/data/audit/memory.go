@@ -0,0 +1,64 @@
+package audit
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// memoryStore keeps events in a slice. It filters and orders events the same
+// way the Postgres store does so tests can run without a database.
+type memoryStore struct {
+	mu     sync.RWMutex
+	events []Event
+}
+
+// NewMemoryStore constructs an empty Store held in memory.
+func NewMemoryStore() Store {
+	return &memoryStore{}
+}
+
+// Create adds a new event to the store.
+func (s *memoryStore) Create(ctx context.Context, traceID string, ev Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, ev)
+	return nil
+}
+
+// Query retrieves up to limit events matching the filter, newest first.
+func (s *memoryStore) Query(ctx context.Context, traceID string, filter QueryFilter, limit int) ([]Event, error) {
+	if limit < 0 {
+		return nil, errors.New("selecting events: limit must not be negative")
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := []Event{}
+	for _, ev := range s.events {
+		switch {
+		case filter.Entity != "" && ev.Entity != filter.Entity:
+		case filter.EntityID != "" && ev.EntityID != filter.EntityID:
+		case filter.Actor != "" && ev.Actor != filter.Actor:
+		case !filter.Since.IsZero() && ev.DateCreated.Before(filter.Since):
+		default:
+			events = append(events, ev)
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].DateCreated.Equal(events[j].DateCreated) {
+			return events[i].DateCreated.After(events[j].DateCreated)
+		}
+		return events[i].ID < events[j].ID
+	})
+
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
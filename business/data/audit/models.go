@@ -0,0 +1,73 @@
+package audit
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Event represents a single change made to an entity.
+type Event struct {
+	ID          string    `db:"event_id" json:"id"`
+	Actor       string    `db:"actor" json:"actor"`
+	Action      string    `db:"action" json:"action"`
+	Entity      string    `db:"entity" json:"entity"`
+	EntityID    string    `db:"entity_id" json:"entity_id"`
+	Changes     Changes   `db:"changes" json:"changes"`
+	TraceID     string    `db:"trace_id" json:"trace_id"`
+	DateCreated time.Time `db:"date_created" json:"date_created"`
+}
+
+// NewEvent contains the information needed to record an event. Before and
+// After are the entity as it was and as it is now. Before is nil for a
+// create and After is nil for a removal.
+type NewEvent struct {
+	Actor    string
+	Action   string
+	Entity   string
+	EntityID string
+	Before   interface{}
+	After    interface{}
+}
+
+// Change holds the value of a field before and after an event.
+type Change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Changes maps the JSON name of every field that changed to its values.
+type Changes map[string]Change
+
+// Value implements the driver.Valuer interface so Changes is stored as JSON.
+func (c Changes) Value() (driver.Value, error) {
+	if c == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(c)
+}
+
+// Scan implements the sql.Scanner interface so Changes is read from JSON.
+func (c *Changes) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*c = Changes{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	}
+	return errors.Errorf("unsupported type %T for changes", src)
+}
+
+// QueryFilter holds the available fields an events query can be filtered on.
+// Zero value fields are not applied to the query.
+type QueryFilter struct {
+	Entity   string
+	EntityID string
+	Actor    string
+	Since    time.Time
+}
@@ -0,0 +1,82 @@
+package audit
+
+import (
+	"context"
+
+	"github.com/dapperauteur/go-base-service/foundation/database"
+	"github.com/dapperauteur/go-base-service/foundation/logger"
+	"github.com/pkg/errors"
+)
+
+// postgresStore keeps events in the audit_events table.
+type postgresStore struct {
+	log *logger.Logger
+	db  database.Executor
+}
+
+// NewPostgresStore constructs a Store backed by Postgres. The db can be a
+// *sqlx.DB or a *sqlx.Tx.
+func NewPostgresStore(log *logger.Logger, db database.Executor) Store {
+	return postgresStore{
+		log: log,
+		db:  db,
+	}
+}
+
+// Create inserts a new event into the database.
+func (s postgresStore) Create(ctx context.Context, traceID string, ev Event) error {
+	const q = `
+	INSERT INTO audit_events
+		(event_id, actor, action, entity, entity_id, changes, trace_id, date_created)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	s.log.Debug(ctx, "query", "trace_id", traceID, "op", "audit.Create", "query",
+		database.Log(q, ev.ID, ev.Actor, ev.Action, ev.Entity, ev.EntityID, ev.Changes, ev.TraceID, ev.DateCreated),
+	)
+
+	if _, err := s.db.ExecContext(ctx, q, ev.ID, ev.Actor, ev.Action, ev.Entity, ev.EntityID, ev.Changes, ev.TraceID, ev.DateCreated); err != nil {
+		return errors.Wrap(err, "inserting event")
+	}
+
+	return nil
+}
+
+// Query retrieves up to limit events matching the filter, newest first.
+func (s postgresStore) Query(ctx context.Context, traceID string, filter QueryFilter, limit int) ([]Event, error) {
+	var b database.Builder
+	if filter.Entity != "" {
+		b.Where("entity = ?", filter.Entity)
+	}
+	if filter.EntityID != "" {
+		b.Where("entity_id = ?", filter.EntityID)
+	}
+	if filter.Actor != "" {
+		b.Where("actor = ?", filter.Actor)
+	}
+	if !filter.Since.IsZero() {
+		b.Where("date_created >= ?", filter.Since.UTC())
+	}
+	b.OrderBy(database.OrderBy{Field: "date_created", Direction: database.DESC})
+	b.OrderBy(database.OrderBy{Field: "event_id", Direction: database.ASC})
+
+	q := `
+	SELECT
+		*
+	FROM
+		audit_events
+	` + b.WhereClause() + `
+	` + b.OrderByClause() + `
+	FETCH FIRST ` + b.Arg(limit) + ` ROWS ONLY`
+
+	s.log.Debug(ctx, "query", "trace_id", traceID, "op", "audit.Query", "query",
+		database.Log(q, b.Args()...),
+	)
+
+	events := []Event{}
+	if err := s.db.SelectContext(ctx, &events, q, b.Args()...); err != nil {
+		return nil, errors.Wrap(err, "selecting events")
+	}
+
+	return events, nil
+}
@@ -0,0 +1,344 @@
+// Package product contains product related CRUD functionality.
+package product
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/dapperauteur/go-base-service/business/auth"
+	"github.com/dapperauteur/go-base-service/business/data/audit"
+	"github.com/dapperauteur/go-base-service/foundation/database"
+	"github.com/dapperauteur/go-base-service/foundation/logger"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Set of error variables for CRUD operations.
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrInvalidID = errors.New("ID is not in its proper form")
+	ErrForbidden = errors.New("attempted action is not allowed")
+)
+
+// entity names products in the audit log.
+const entity = "product"
+
+// Product manages the set of API's for product access.
+type Product struct {
+	log   *logger.Logger
+	db    database.Executor
+	audit audit.Audit
+}
+
+// New constructs a Product for api access. The db can be a *sqlx.DB or a
+// *sqlx.Tx so product writes can take part in a larger transaction. Changes
+// are recorded in the audit log through the same db.
+func New(log *logger.Logger, db database.Executor) Product {
+	return Product{
+		log:   log,
+		db:    db,
+		audit: audit.New(log, db),
+	}
+}
+
+// Create adds a Product to the database. It returns the created Product with
+// fields like ID and DateCreated populated. The product is owned by the
+// user identified by the claims subject.
+func (p Product) Create(ctx context.Context, traceID string, claims auth.Claims, np NewProduct, now time.Time) (Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.product.create")
+	defer span.End()
+
+	prd := Info{
+		ID:          uuid.New().String(),
+		Name:        np.Name,
+		Cost:        np.Cost,
+		Quantity:    np.Quantity,
+		UserID:      claims.Subject,
+		DateCreated: now.UTC(),
+		DateUpdated: now.UTC(),
+	}
+
+	const q = `
+	INSERT INTO products
+		(product_id, user_id, name, cost, quantity, date_created, date_updated)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7)`
+
+	p.log.Debug(ctx, "query", "trace_id", traceID, "op", "product.Create", "query",
+		database.Log(q, prd.ID, prd.UserID, prd.Name, prd.Cost, prd.Quantity, prd.DateCreated, prd.DateUpdated),
+	)
+
+	if _, err := p.db.ExecContext(ctx, q, prd.ID, prd.UserID, prd.Name, prd.Cost, prd.Quantity, prd.DateCreated, prd.DateUpdated); err != nil {
+		return Info{}, errors.Wrap(err, "inserting product")
+	}
+
+	if err := p.record(ctx, traceID, claims.Subject, audit.ActionCreate, prd.ID, nil, prd, now); err != nil {
+		return Info{}, err
+	}
+
+	return prd, nil
+}
+
+// Update modifies data about a Product. It will error if the specified ID is
+// invalid or does not reference an existing Product. Only the owner of the
+// product and callers granted products:write may change it.
+func (p Product) Update(ctx context.Context, traceID string, claims auth.Claims, productID string, up UpdateProduct, now time.Time) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.product.update")
+	defer span.End()
+
+	prd, err := p.QueryByID(ctx, traceID, productID)
+	if err != nil {
+		return err
+	}
+
+	// If you can't write products and are looking to change someone else's.
+	if !claims.HasPermission(auth.PermProductsWrite) && prd.UserID != claims.Subject {
+		return ErrForbidden
+	}
+	before := prd
+
+	if up.Name != nil {
+		prd.Name = *up.Name
+	}
+	if up.Cost != nil {
+		prd.Cost = *up.Cost
+	}
+	if up.Quantity != nil {
+		prd.Quantity = *up.Quantity
+	}
+	prd.DateUpdated = now
+
+	const q = `
+	UPDATE
+		products
+	SET
+		"name" = $2,
+		"cost" = $3,
+		"quantity" = $4,
+		"date_updated" = $5
+	WHERE
+		product_id = $1`
+
+	p.log.Debug(ctx, "query", "trace_id", traceID, "op", "product.Update", "query",
+		database.Log(q, prd.ID, prd.Name, prd.Cost, prd.Quantity, prd.DateUpdated),
+	)
+
+	if _, err := p.db.ExecContext(ctx, q, prd.ID, prd.Name, prd.Cost, prd.Quantity, prd.DateUpdated); err != nil {
+		return errors.Wrapf(err, "updating product %s", prd.ID)
+	}
+
+	return p.record(ctx, traceID, claims.Subject, audit.ActionUpdate, prd.ID, before, prd, now)
+}
+
+// Delete removes the product identified by a given ID. Only the owner of the
+// product and callers granted products:write may delete it.
+func (p Product) Delete(ctx context.Context, traceID string, claims auth.Claims, productID string, now time.Time) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.product.delete")
+	defer span.End()
+
+	prd, err := p.QueryByID(ctx, traceID, productID)
+	if err != nil {
+		return err
+	}
+
+	// If you can't write products and are looking to delete someone else's.
+	if !claims.HasPermission(auth.PermProductsWrite) && prd.UserID != claims.Subject {
+		return ErrForbidden
+	}
+
+	const q = `
+	DELETE FROM
+		products
+	WHERE
+		product_id = $1`
+
+	p.log.Debug(ctx, "query", "trace_id", traceID, "op", "product.Delete", "query",
+		database.Log(q, productID),
+	)
+
+	if _, err := p.db.ExecContext(ctx, q, productID); err != nil {
+		return errors.Wrapf(err, "deleting product %s", productID)
+	}
+
+	return p.record(ctx, traceID, claims.Subject, audit.ActionDelete, prd.ID, prd, nil, now)
+}
+
+// DeleteByOwner removes every product owned by a user along with their sales
+// on behalf of the actor. It returns the number of products removed.
+func (p Product) DeleteByOwner(ctx context.Context, traceID string, actor string, userID string, now time.Time) (int, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.product.deleteByOwner")
+	defer span.End()
+
+	if _, err := uuid.Parse(userID); err != nil {
+		return 0, ErrInvalidID
+	}
+
+	const q = `
+	DELETE FROM
+		products
+	WHERE
+		user_id = $1
+	RETURNING
+		product_id, user_id, name, cost, quantity, date_created, date_updated`
+
+	p.log.Debug(ctx, "query", "trace_id", traceID, "op", "product.DeleteByOwner", "query",
+		database.Log(q, userID),
+	)
+
+	var products []Info
+	if err := p.db.SelectContext(ctx, &products, q, userID); err != nil {
+		return 0, errors.Wrapf(err, "deleting products of user %s", userID)
+	}
+
+	for _, prd := range products {
+		if err := p.record(ctx, traceID, actor, audit.ActionDelete, prd.ID, prd, nil, now); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(products), nil
+}
+
+// Reassign moves every product owned by one user to another on behalf of the
+// actor. It returns the number of products moved.
+func (p Product) Reassign(ctx context.Context, traceID string, actor string, fromUserID string, toUserID string, now time.Time) (int, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.product.reassign")
+	defer span.End()
+
+	if _, err := uuid.Parse(fromUserID); err != nil {
+		return 0, ErrInvalidID
+	}
+	if _, err := uuid.Parse(toUserID); err != nil {
+		return 0, ErrInvalidID
+	}
+
+	const q = `
+	UPDATE
+		products
+	SET
+		"user_id" = $2,
+		"date_updated" = $3
+	WHERE
+		user_id = $1
+	RETURNING
+		product_id, user_id, name, cost, quantity, date_created, date_updated`
+
+	p.log.Debug(ctx, "query", "trace_id", traceID, "op", "product.Reassign", "query",
+		database.Log(q, fromUserID, toUserID, now.UTC()),
+	)
+
+	var products []Info
+	if err := p.db.SelectContext(ctx, &products, q, fromUserID, toUserID, now.UTC()); err != nil {
+		return 0, errors.Wrapf(err, "reassigning products of user %s", fromUserID)
+	}
+
+	// Only the owner is recorded as changed since the previous update date
+	// isn't returned.
+	for _, prd := range products {
+		before := prd
+		before.UserID = fromUserID
+		if err := p.record(ctx, traceID, actor, audit.ActionUpdate, prd.ID, before, prd, now); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(products), nil
+}
+
+// record adds a change made by the actor to the audit log.
+func (p Product) record(ctx context.Context, traceID string, actor string, action string, productID string, before interface{}, after interface{}, now time.Time) error {
+	ne := audit.NewEvent{
+		Actor:    actor,
+		Action:   action,
+		Entity:   entity,
+		EntityID: productID,
+		Before:   before,
+		After:    after,
+	}
+	if err := p.audit.Record(ctx, traceID, ne, now); err != nil {
+		return errors.Wrapf(err, "auditing %s of product %s", action, productID)
+	}
+	return nil
+}
+
+// Query gets all Products from the database.
+func (p Product) Query(ctx context.Context, traceID string, pageNumber int, rowsPerPage int) ([]Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.product.query")
+	defer span.End()
+
+	const q = `
+	SELECT
+		p.*,
+		COALESCE(SUM(s.quantity), 0) AS sold,
+		COALESCE(SUM(s.paid), 0) AS revenue
+	FROM
+		products AS p
+	LEFT JOIN
+		sales AS s ON p.product_id = s.product_id
+	GROUP BY
+		p.product_id
+	ORDER BY
+		p.product_id
+	OFFSET $1
+	ROWS FETCH NEXT $2 ROWS ONLY`
+	offset := (pageNumber - 1) * rowsPerPage
+
+	p.log.Debug(ctx, "query", "trace_id", traceID, "op", "product.Query", "query",
+		database.Log(q, offset, rowsPerPage),
+	)
+
+	products := []Info{}
+	if err := p.db.SelectContext(ctx, &products, q, offset, rowsPerPage); err != nil {
+		return nil, errors.Wrap(err, "selecting products")
+	}
+
+	return products, nil
+}
+
+// QueryByID finds the product identified by a given ID.
+func (p Product) QueryByID(ctx context.Context, traceID string, productID string) (Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.product.queryByID")
+	defer span.End()
+
+	if _, err := uuid.Parse(productID); err != nil {
+		return Info{}, ErrInvalidID
+	}
+
+	const q = `
+	SELECT
+		p.*,
+		COALESCE(SUM(s.quantity), 0) AS sold,
+		COALESCE(SUM(s.paid), 0) AS revenue
+	FROM
+		products AS p
+	LEFT JOIN
+		sales AS s ON p.product_id = s.product_id
+	WHERE
+		p.product_id = $1
+	GROUP BY
+		p.product_id`
+
+	p.log.Debug(ctx, "query", "trace_id", traceID, "op", "product.QueryByID", "query",
+		database.Log(q, productID),
+	)
+
+	var prd Info
+	if err := p.db.GetContext(ctx, &prd, q, productID); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "selecting product %q", productID)
+	}
+
+	return prd, nil
+}
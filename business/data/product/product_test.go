@@ -0,0 +1,305 @@
+package product_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dapperauteur/go-base-service/business/auth"
+	"github.com/dapperauteur/go-base-service/business/data/audit"
+	"github.com/dapperauteur/go-base-service/business/data/product"
+	"github.com/dapperauteur/go-base-service/business/data/sale"
+	"github.com/dapperauteur/go-base-service/business/data/user"
+	"github.com/dapperauteur/go-base-service/business/tests"
+	"github.com/dapperauteur/go-base-service/foundation/database"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/go-cmp/cmp"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+func TestProduct(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	p := product.New(log, db)
+
+	t.Log("Given the need to work with Product records.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen handling a single Product.", testID)
+		{
+			ctx := tests.Context()
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			claims := auth.Claims{
+				StandardClaims: jwt.StandardClaims{
+					Issuer:    "service project",
+					Subject:   tests.UserID,
+					ExpiresAt: now.Add(time.Hour).Unix(),
+					IssuedAt:  now.Unix(),
+				},
+				Roles: []string{auth.RoleUser},
+			}
+
+			np := product.NewProduct{
+				Name:     "Comic Books",
+				Cost:     10,
+				Quantity: 55,
+			}
+
+			prd, err := p.Create(ctx, traceID, claims, np, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a product : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create a product.", tests.Success, testID)
+
+			saved, err := p.QueryByID(ctx, traceID, prd.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve product by ID: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to retrieve product by ID.", tests.Success, testID)
+
+			if diff := cmp.Diff(prd, saved); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the same product. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the same product.", tests.Success, testID)
+
+			upd := product.UpdateProduct{
+				Name:     tests.StringPointer("Comics"),
+				Cost:     tests.IntPointer(50),
+				Quantity: tests.IntPointer(40),
+			}
+			updatedTime := time.Date(2019, time.January, 1, 1, 1, 1, 0, time.UTC)
+
+			other := claims
+			other.Subject = "5cf37266-3473-4006-984f-9325122678b7"
+			if err := p.Update(ctx, traceID, other, prd.ID, upd, updatedTime); errors.Cause(err) != product.ErrForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to update a product owned by another user : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to update a product owned by another user.", tests.Success, testID)
+
+			if err := p.Update(ctx, traceID, claims, prd.ID, upd, updatedTime); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to update product : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to update product.", tests.Success, testID)
+
+			products, err := p.Query(ctx, traceID, 1, 3)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve updated product : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to retrieve updated product.", tests.Success, testID)
+
+			// Check specified fields were updated. Make a copy of the original product
+			// and change just the fields we expect then diff it with what was saved.
+			want := prd
+			want.Name = *upd.Name
+			want.Cost = *upd.Cost
+			want.Quantity = *upd.Quantity
+			want.DateUpdated = updatedTime
+
+			var idx int
+			for i, pr := range products {
+				if pr.ID == want.ID {
+					idx = i
+				}
+			}
+			if diff := cmp.Diff(want, products[idx]); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the same product. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the same product.", tests.Success, testID)
+
+			if err := p.Delete(ctx, traceID, claims, prd.ID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to delete product : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to delete product.", tests.Success, testID)
+
+			_, err = p.QueryByID(ctx, traceID, prd.ID)
+			if errors.Cause(err) != product.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to retrieve deleted product : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to retrieve deleted product.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen handling the products of a purged user.", testID)
+		{
+			ctx := tests.Context()
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			owner := auth.Claims{
+				StandardClaims: jwt.StandardClaims{Subject: "8b5f1c2e-3d4a-4e6f-9a7b-0c1d2e3f4a51"},
+				Roles:          []string{auth.RoleUser},
+			}
+			other := auth.Claims{
+				StandardClaims: jwt.StandardClaims{Subject: "8b5f1c2e-3d4a-4e6f-9a7b-0c1d2e3f4a52"},
+				Roles:          []string{auth.RoleUser},
+			}
+			heir := "8b5f1c2e-3d4a-4e6f-9a7b-0c1d2e3f4a53"
+			actor := "service-admin"
+
+			var owned []product.Info
+			for _, name := range []string{"Puzzles", "Kites"} {
+				prd, err := p.Create(ctx, traceID, owner, product.NewProduct{Name: name, Cost: 5, Quantity: 10}, now)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to create a product : %s.", tests.Failed, testID, err)
+				}
+				owned = append(owned, prd)
+			}
+			kept, err := p.Create(ctx, traceID, other, product.NewProduct{Name: "Marbles", Cost: 1, Quantity: 100}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a product : %s.", tests.Failed, testID, err)
+			}
+
+			s := sale.New(log, db)
+			if _, err := s.Create(ctx, traceID, owner, owned[0].ID, sale.NewSale{Quantity: 1, Paid: 5}, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a sale : %s.", tests.Failed, testID, err)
+			}
+
+			later := now.Add(time.Hour)
+			n, err := p.Reassign(ctx, traceID, actor, owner.Subject, heir, later)
+			if err != nil || n != len(owned) {
+				t.Fatalf("\t%s\tTest %d:\tShould reassign every product of the user : got %d : %v.", tests.Failed, testID, n, err)
+			}
+			for _, prd := range owned {
+				saved, err := p.QueryByID(ctx, traceID, prd.ID)
+				if err != nil || saved.UserID != heir || !saved.DateUpdated.Equal(later) {
+					t.Fatalf("\t%s\tTest %d:\tShould see the product owned by the new user : %+v : %v.", tests.Failed, testID, saved, err)
+				}
+			}
+			if sales, err := s.QueryByProduct(ctx, traceID, owned[0].ID); err != nil || len(sales) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the sales of a reassigned product : %+v : %v.", tests.Failed, testID, sales, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reassign the products and keep their sales.", tests.Success, testID)
+
+			n, err = p.DeleteByOwner(ctx, traceID, actor, heir, later)
+			if err != nil || n != len(owned) {
+				t.Fatalf("\t%s\tTest %d:\tShould delete every product of the user : got %d : %v.", tests.Failed, testID, n, err)
+			}
+			for _, prd := range owned {
+				if _, err := p.QueryByID(ctx, traceID, prd.ID); errors.Cause(err) != product.ErrNotFound {
+					t.Fatalf("\t%s\tTest %d:\tShould NOT be able to retrieve a deleted product : %v.", tests.Failed, testID, err)
+				}
+			}
+			if sales, err := s.QueryByProduct(ctx, traceID, owned[0].ID); err != nil || len(sales) != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould delete the sales of a deleted product : %+v : %v.", tests.Failed, testID, sales, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould delete the products along with their sales.", tests.Success, testID)
+
+			events, err := audit.New(log, db).Query(ctx, traceID, audit.QueryFilter{Entity: "product", EntityID: owned[0].ID}, 10)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to query the history of a product : %s.", tests.Failed, testID, err)
+			}
+			actions := map[string]int{}
+			for _, ev := range events {
+				if ev.Action == audit.ActionDelete && ev.Actor != actor {
+					t.Fatalf("\t%s\tTest %d:\tShould record who deleted the product : %+v.", tests.Failed, testID, ev)
+				}
+				actions[ev.Action]++
+			}
+			exp := map[string]int{audit.ActionCreate: 1, audit.ActionUpdate: 2, audit.ActionDelete: 1}
+			if diff := cmp.Diff(exp, actions); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould audit the sale, the reassignment and the deletion. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould audit the sale, the reassignment and the deletion.", tests.Success, testID)
+
+			if saved, err := p.QueryByID(ctx, traceID, kept.ID); err != nil || saved.UserID != other.Subject {
+				t.Fatalf("\t%s\tTest %d:\tShould leave the products of other users alone : %+v : %v.", tests.Failed, testID, saved, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould leave the products of other users alone.", tests.Success, testID)
+
+			if _, err := p.DeleteByOwner(ctx, traceID, actor, "nope", later); err != product.ErrInvalidID {
+				t.Fatalf("\t%s\tTest %d:\tShould reject an invalid user id : %v.", tests.Failed, testID, err)
+			}
+			if _, err := p.Reassign(ctx, traceID, actor, other.Subject, "nope", later); err != product.ErrInvalidID {
+				t.Fatalf("\t%s\tTest %d:\tShould reject an invalid new owner : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject invalid user ids.", tests.Success, testID)
+		}
+	}
+}
+
+func TestProductTx(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	t.Log("Given the need to write users and products in one transaction.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen creating a user and their first product.", testID)
+		{
+			ctx := tests.Context()
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			nu := user.NewUser{
+				Name:            "Jill Seller",
+				Email:           "jill@example.com",
+				Roles:           []string{auth.RoleUser},
+				Password:        "gophers",
+				PasswordConfirm: "gophers",
+			}
+			np := product.NewProduct{
+				Name:     "Board Games",
+				Cost:     25,
+				Quantity: 10,
+			}
+
+			create := func(tx *sqlx.Tx) (product.Info, error) {
+				admin := auth.Claims{
+					Roles:  []string{auth.RoleAdmin},
+					Scopes: auth.Permissions,
+				}
+				usr, err := user.New(log, tx).Create(ctx, traceID, admin, nu, now)
+				if err != nil {
+					return product.Info{}, err
+				}
+				claims := auth.Claims{
+					StandardClaims: jwt.StandardClaims{Subject: usr.ID},
+					Roles:          usr.Roles,
+				}
+				return product.New(log, tx).Create(ctx, traceID, claims, np, now)
+			}
+
+			var rolledBack product.Info
+			errAbort := errors.New("abort")
+			err := database.WithTx(ctx, db, func(tx *sqlx.Tx) error {
+				var err error
+				if rolledBack, err = create(tx); err != nil {
+					return err
+				}
+				return errAbort
+			})
+			if err != errAbort {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the error that aborted the transaction : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the error that aborted the transaction.", tests.Success, testID)
+
+			if _, err := product.New(log, db).QueryByID(ctx, traceID, rolledBack.ID); errors.Cause(err) != product.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to retrieve a rolled back product : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to retrieve a rolled back product.", tests.Success, testID)
+
+			var prd product.Info
+			err = database.WithTx(ctx, db, func(tx *sqlx.Tx) error {
+				var err error
+				prd, err = create(tx)
+				return err
+			})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to commit the transaction : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to commit the transaction.", tests.Success, testID)
+
+			saved, err := product.New(log, db).QueryByID(ctx, traceID, prd.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve the committed product : %s.", tests.Failed, testID, err)
+			}
+			if saved.UserID != prd.UserID {
+				t.Fatalf("\t%s\tTest %d:\tShould see the product owned by the new user : got %s exp %s.", tests.Failed, testID, saved.UserID, prd.UserID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to retrieve the committed product.", tests.Success, testID)
+		}
+	}
+}
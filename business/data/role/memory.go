@@ -0,0 +1,123 @@
+package role
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/dapperauteur/go-base-service/business/auth"
+)
+
+// memoryStore keeps roles in a map. It starts out with the built-in roles
+// the migration inserts so tests can run without a database.
+type memoryStore struct {
+	mu    sync.RWMutex
+	roles map[string]Info
+}
+
+// NewMemoryStore constructs a Store held in memory holding the built-in
+// roles.
+func NewMemoryStore() Store {
+	s := memoryStore{
+		roles: make(map[string]Info),
+	}
+	for _, r := range builtins() {
+		s.roles[r.Name] = r
+	}
+	return &s
+}
+
+// Create adds a new role to the store.
+func (s *memoryStore) Create(ctx context.Context, traceID string, r Info) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.roles[r.Name]; exists {
+		return ErrExists
+	}
+
+	s.roles[r.Name] = clone(r)
+	return nil
+}
+
+// Update replaces the description and permissions of a role.
+func (s *memoryStore) Update(ctx context.Context, traceID string, r Info) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved, exists := s.roles[r.Name]
+	if !exists {
+		return ErrNotFound
+	}
+
+	saved.Description = r.Description
+	saved.Permissions = r.Permissions
+	saved.DateUpdated = r.DateUpdated
+
+	s.roles[r.Name] = clone(saved)
+	return nil
+}
+
+// Delete removes a role from the store.
+func (s *memoryStore) Delete(ctx context.Context, traceID string, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.roles[name]; !exists {
+		return ErrNotFound
+	}
+
+	delete(s.roles, name)
+	return nil
+}
+
+// Query retrieves every role ordered by name.
+func (s *memoryStore) Query(ctx context.Context, traceID string) ([]Info, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	roles := make([]Info, 0, len(s.roles))
+	for _, r := range s.roles {
+		roles = append(roles, clone(r))
+	}
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].Name < roles[j].Name
+	})
+
+	return roles, nil
+}
+
+// QueryByName gets the specified role from the store.
+func (s *memoryStore) QueryByName(ctx context.Context, traceID string, name string) (Info, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	r, exists := s.roles[name]
+	if !exists {
+		return Info{}, ErrNotFound
+	}
+
+	return clone(r), nil
+}
+
+// builtins mirrors the roles inserted by the migration creating the roles
+// table, along with the permissions later migrations granted them.
+func builtins() []Info {
+	return []Info{
+		{
+			Name:        auth.RoleAdmin,
+			Description: "Manages users, roles and the audit log.",
+			Permissions: []string{auth.PermAuditRead, auth.PermKeysRead, auth.PermProductsWrite, auth.PermReportsRead, auth.PermRolesRead, auth.PermRolesWrite, auth.PermTestingRead, auth.PermUsersRead, auth.PermUsersWrite},
+		},
+		{
+			Name:        auth.RoleUser,
+			Description: "A regular account.",
+			Permissions: []string{},
+		},
+	}
+}
+
+func clone(r Info) Info {
+	r.Permissions = append(r.Permissions[:0:0], r.Permissions...)
+	return r
+}
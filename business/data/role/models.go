@@ -0,0 +1,31 @@
+package role
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Info represents a role and the permissions it grants.
+type Info struct {
+	Name        string         `db:"name" json:"name"`
+	Description string         `db:"description" json:"description"`
+	Permissions pq.StringArray `db:"permissions" json:"permissions"`
+	DateCreated time.Time      `db:"date_created" json:"date_created"`
+	DateUpdated time.Time      `db:"date_updated" json:"date_updated"`
+}
+
+// NewRole contains information needed to create a new Role.
+type NewRole struct {
+	Name        string   `json:"name" validate:"required"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// UpdateRole defines what information may be provided to modify an existing
+// Role. All fields are optional so clients can send just the fields they want
+// changed. A role can't be renamed.
+type UpdateRole struct {
+	Description *string  `json:"description"`
+	Permissions []string `json:"permissions"`
+}
@@ -0,0 +1,158 @@
+package role
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/dapperauteur/go-base-service/foundation/database"
+	"github.com/dapperauteur/go-base-service/foundation/logger"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// uniqueViolation is the Postgres error code for a unique constraint failure.
+const uniqueViolation = "23505"
+
+// postgresStore keeps roles in the roles table.
+type postgresStore struct {
+	log *logger.Logger
+	db  database.Executor
+}
+
+// NewPostgresStore constructs a Store backed by Postgres. The db can be a
+// *sqlx.DB or a *sqlx.Tx.
+func NewPostgresStore(log *logger.Logger, db database.Executor) Store {
+	return postgresStore{
+		log: log,
+		db:  db,
+	}
+}
+
+// Create inserts a new role into the database.
+func (s postgresStore) Create(ctx context.Context, traceID string, r Info) error {
+	const q = `
+	INSERT INTO roles
+		(name, description, permissions, date_created, date_updated)
+	VALUES
+		($1, $2, $3, $4, $5)`
+
+	s.log.Debug(ctx, "query", "trace_id", traceID, "op", "role.Create", "query",
+		database.Log(q, r.Name, r.Description, r.Permissions, r.DateCreated, r.DateUpdated),
+	)
+
+	if _, err := s.db.ExecContext(ctx, q, r.Name, r.Description, r.Permissions, r.DateCreated, r.DateUpdated); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolation {
+			return ErrExists
+		}
+		return errors.Wrap(err, "inserting role")
+	}
+
+	return nil
+}
+
+// Update replaces the description and permissions of a role.
+func (s postgresStore) Update(ctx context.Context, traceID string, r Info) error {
+	const q = `
+	UPDATE
+		roles
+	SET
+		"description" = $2,
+		"permissions" = $3,
+		"date_updated" = $4
+	WHERE
+		name = $1`
+
+	s.log.Debug(ctx, "query", "trace_id", traceID, "op", "role.Update", "query",
+		database.Log(q, r.Name, r.Description, r.Permissions, r.DateUpdated),
+	)
+
+	res, err := s.db.ExecContext(ctx, q, r.Name, r.Description, r.Permissions, r.DateUpdated)
+	if err != nil {
+		return errors.Wrapf(err, "updating role %s", r.Name)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrapf(err, "updating role %s", r.Name)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Delete removes a role from the database.
+func (s postgresStore) Delete(ctx context.Context, traceID string, name string) error {
+	const q = `
+	DELETE FROM
+		roles
+	WHERE
+		name = $1`
+
+	s.log.Debug(ctx, "query", "trace_id", traceID, "op", "role.Delete", "query",
+		database.Log(q, name),
+	)
+
+	res, err := s.db.ExecContext(ctx, q, name)
+	if err != nil {
+		return errors.Wrapf(err, "deleting role %s", name)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrapf(err, "deleting role %s", name)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Query retrieves every role ordered by name.
+func (s postgresStore) Query(ctx context.Context, traceID string) ([]Info, error) {
+	const q = `
+	SELECT
+		*
+	FROM
+		roles
+	ORDER BY
+		name`
+
+	s.log.Debug(ctx, "query", "trace_id", traceID, "op", "role.Query", "query",
+		database.Log(q),
+	)
+
+	roles := []Info{}
+	if err := s.db.SelectContext(ctx, &roles, q); err != nil {
+		return nil, errors.Wrap(err, "selecting roles")
+	}
+
+	return roles, nil
+}
+
+// QueryByName gets the specified role from the database.
+func (s postgresStore) QueryByName(ctx context.Context, traceID string, name string) (Info, error) {
+	const q = `
+	SELECT
+		*
+	FROM
+		roles
+	WHERE
+		name = $1`
+
+	s.log.Debug(ctx, "query", "trace_id", traceID, "op", "role.QueryByName", "query",
+		database.Log(q, name),
+	)
+
+	var r Info
+	if err := s.db.GetContext(ctx, &r, q, name); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "selecting role %q", name)
+	}
+
+	return r, nil
+}
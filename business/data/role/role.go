@@ -0,0 +1,274 @@
+// Package role contains the roles users hold and the permissions they grant.
+package role
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/dapperauteur/go-base-service/business/auth"
+	"github.com/dapperauteur/go-base-service/business/data/audit"
+	"github.com/dapperauteur/go-base-service/foundation/database"
+	"github.com/dapperauteur/go-base-service/foundation/logger"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/pkg/errors"
+)
+
+// Set of error variables for CRUD operations.
+var (
+	ErrNotFound          = errors.New("role not found")
+	ErrExists            = errors.New("role already exists")
+	ErrBuiltIn           = errors.New("built-in roles can't be deleted")
+	ErrAdminPermissions  = errors.New("the permissions of the ADMIN role can't be changed")
+	ErrInUse             = errors.New("role is held by users")
+	ErrUnknownPermission = errors.New("permission does not exist")
+)
+
+// Store declares the storage behavior Role relies on. Implementations return
+// ErrNotFound for a missing role and ErrExists when the name is taken. Query
+// returns the roles ordered by name.
+//
+// The built-in ADMIN and USER roles always exist.
+type Store interface {
+	Create(ctx context.Context, traceID string, r Info) error
+	Update(ctx context.Context, traceID string, r Info) error
+	Delete(ctx context.Context, traceID string, name string) error
+	Query(ctx context.Context, traceID string) ([]Info, error)
+	QueryByName(ctx context.Context, traceID string, name string) (Info, error)
+}
+
+// entity names roles in the audit log.
+const entity = "role"
+
+// Role manages the set of API's for role access.
+type Role struct {
+	log   *logger.Logger
+	store Store
+	audit audit.Audit
+}
+
+// New constructs a Role for api access backed by Postgres. The db can be a
+// *sqlx.DB or a *sqlx.Tx so a change and its audit event can be committed
+// together.
+func New(log *logger.Logger, db database.Executor) Role {
+	return NewWithStore(log, NewPostgresStore(log, db), audit.NewPostgresStore(log, db))
+}
+
+// NewWithStore constructs a Role for api access backed by the provided
+// stores. Changes are recorded in the events store.
+func NewWithStore(log *logger.Logger, store Store, events audit.Store) Role {
+	return Role{
+		log:   log,
+		store: store,
+		audit: audit.NewWithStore(log, events),
+	}
+}
+
+// Create inserts a new role on behalf of the caller.
+func (r Role) Create(ctx context.Context, traceID string, claims auth.Claims, nr NewRole, now time.Time) (Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.role.create")
+	defer span.End()
+
+	perms, err := normalize(nr.Permissions)
+	if err != nil {
+		return Info{}, err
+	}
+
+	rl := Info{
+		Name:        nr.Name,
+		Description: nr.Description,
+		Permissions: perms,
+		DateCreated: now.UTC(),
+		DateUpdated: now.UTC(),
+	}
+
+	if err := r.store.Create(ctx, traceID, rl); err != nil {
+		return Info{}, err
+	}
+
+	if err := r.record(ctx, traceID, claims.Subject, audit.ActionCreate, rl.Name, nil, rl, now); err != nil {
+		return Info{}, err
+	}
+
+	return rl, nil
+}
+
+// Update modifies the description and permissions of a role. The new
+// permissions only reach users once they get a new token. The permissions of
+// the ADMIN role are fixed so admins can never lock themselves out.
+func (r Role) Update(ctx context.Context, traceID string, claims auth.Claims, name string, ur UpdateRole, now time.Time) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.role.update")
+	defer span.End()
+
+	rl, err := r.store.QueryByName(ctx, traceID, name)
+	if err != nil {
+		return err
+	}
+	before := rl
+
+	if ur.Description != nil {
+		rl.Description = *ur.Description
+	}
+	if ur.Permissions != nil {
+		perms, err := normalize(ur.Permissions)
+		if err != nil {
+			return err
+		}
+		if rl.Name == auth.RoleAdmin && !equal(perms, rl.Permissions) {
+			return ErrAdminPermissions
+		}
+		rl.Permissions = perms
+	}
+	rl.DateUpdated = now.UTC()
+
+	if err := r.store.Update(ctx, traceID, rl); err != nil {
+		return err
+	}
+
+	return r.record(ctx, traceID, claims.Subject, audit.ActionUpdate, rl.Name, before, rl, now)
+}
+
+// Delete removes a role. The built-in roles can't be deleted. Whether users
+// still hold the role is up to the caller; see user.DeleteRole.
+func (r Role) Delete(ctx context.Context, traceID string, claims auth.Claims, name string, now time.Time) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.role.delete")
+	defer span.End()
+
+	if IsBuiltIn(name) {
+		return ErrBuiltIn
+	}
+
+	before, err := r.store.QueryByName(ctx, traceID, name)
+	if err != nil {
+		return err
+	}
+
+	if err := r.store.Delete(ctx, traceID, name); err != nil {
+		return err
+	}
+
+	return r.record(ctx, traceID, claims.Subject, audit.ActionDelete, name, before, nil, now)
+}
+
+// Query retrieves every role ordered by name.
+func (r Role) Query(ctx context.Context, traceID string) ([]Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.role.query")
+	defer span.End()
+
+	return r.store.Query(ctx, traceID)
+}
+
+// QueryByName gets the specified role.
+func (r Role) QueryByName(ctx context.Context, traceID string, name string) (Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.role.queryByName")
+	defer span.End()
+
+	return r.store.QueryByName(ctx, traceID, name)
+}
+
+// Permissions resolves the set of permissions granted by the roles, sorted
+// by name. It returns ErrNotFound if any of the roles does not exist.
+func (r Role) Permissions(ctx context.Context, traceID string, roles []string) ([]string, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.role.permissions")
+	defer span.End()
+
+	all, err := r.store.Query(ctx, traceID)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]Info, len(all))
+	for _, rl := range all {
+		byName[rl.Name] = rl
+	}
+
+	set := map[string]bool{}
+	for _, name := range roles {
+		rl, ok := byName[name]
+		if !ok {
+			return nil, ErrNotFound
+		}
+		for _, perm := range rl.Permissions {
+			set[perm] = true
+		}
+	}
+
+	perms := make([]string, 0, len(set))
+	for perm := range set {
+		perms = append(perms, perm)
+	}
+	sort.Strings(perms)
+
+	return perms, nil
+}
+
+// record adds a change made by the actor to the audit log.
+func (r Role) record(ctx context.Context, traceID string, actor string, action string, name string, before interface{}, after interface{}, now time.Time) error {
+	ne := audit.NewEvent{
+		Actor:    actor,
+		Action:   action,
+		Entity:   entity,
+		EntityID: name,
+		Before:   before,
+		After:    after,
+	}
+	if err := r.audit.Record(ctx, traceID, ne, now); err != nil {
+		return errors.Wrapf(err, "auditing %s of role %s", action, name)
+	}
+	return nil
+}
+
+// IsBuiltIn reports whether the role is one of the roles the service can't
+// work without.
+func IsBuiltIn(name string) bool {
+	return name == auth.RoleAdmin || name == auth.RoleUser
+}
+
+// equal reports whether two sets of permissions without duplicates are the
+// same.
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[string]bool, len(a))
+	for _, perm := range a {
+		set[perm] = true
+	}
+	for _, perm := range b {
+		if !set[perm] {
+			return false
+		}
+	}
+	return true
+}
+
+// normalize checks every permission is known and returns them sorted without
+// duplicates.
+func normalize(perms []string) ([]string, error) {
+	known := make(map[string]bool, len(auth.Permissions))
+	for _, perm := range auth.Permissions {
+		known[perm] = true
+	}
+
+	set := map[string]bool{}
+	for _, perm := range perms {
+		if !known[perm] {
+			return nil, ErrUnknownPermission
+		}
+		set[perm] = true
+	}
+
+	out := make([]string, 0, len(set))
+	for perm := range set {
+		out = append(out, perm)
+	}
+	sort.Strings(out)
+
+	return out, nil
+}
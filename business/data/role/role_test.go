@@ -0,0 +1,148 @@
+package role_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dapperauteur/go-base-service/business/auth"
+	"github.com/dapperauteur/go-base-service/business/data/audit"
+	"github.com/dapperauteur/go-base-service/business/data/role"
+	"github.com/dapperauteur/go-base-service/business/tests"
+	"github.com/dapperauteur/go-base-service/foundation/logger"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRole(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	testRole(t, role.New(log, db), audit.New(log, db))
+}
+
+func TestRoleMemory(t *testing.T) {
+	log := logger.New(os.Stdout, "TEST", logger.LevelDebug)
+
+	events := audit.NewMemoryStore()
+	testRole(t, role.NewWithStore(log, role.NewMemoryStore(), events), audit.NewWithStore(log, events))
+}
+
+// testRole runs the Role API against a store holding only the built-in roles.
+// The changes must show up in the audit log read through a.
+func testRole(t *testing.T, r role.Role, a audit.Audit) {
+	t.Log("Given the need to work with Role records.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen handling a single Role.", testID)
+		{
+			ctx := tests.Context()
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+			admin := auth.Claims{
+				StandardClaims: jwt.StandardClaims{Subject: "5cf37266-3473-4006-984f-9325122678b7"},
+				Roles:          []string{auth.RoleAdmin},
+			}
+
+			nr := role.NewRole{
+				Name:        "AUDITOR",
+				Description: "Reads the audit log.",
+				Permissions: []string{auth.PermAuditRead, auth.PermUsersRead, auth.PermAuditRead},
+			}
+
+			rl, err := r.Create(ctx, traceID, admin, nr, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create role : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create role.", tests.Success, testID)
+
+			saved, err := r.QueryByName(ctx, traceID, rl.Name)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve role by name : %s.", tests.Failed, testID, err)
+			}
+			if diff := cmp.Diff(rl, saved); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the same role. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the same role.", tests.Success, testID)
+
+			if _, err := r.Create(ctx, traceID, admin, nr, now); err != role.ErrExists {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to create the role twice : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to create the role twice.", tests.Success, testID)
+
+			bad := role.NewRole{Name: "BAD", Permissions: []string{"users:fly"}}
+			if _, err := r.Create(ctx, traceID, admin, bad, now); err != role.ErrUnknownPermission {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to grant an unknown permission : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to grant an unknown permission.", tests.Success, testID)
+
+			ur := role.UpdateRole{
+				Permissions: []string{auth.PermAuditRead},
+			}
+			if err := r.Update(ctx, traceID, admin, rl.Name, ur, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to update role : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to update role.", tests.Success, testID)
+
+			perms, err := r.Permissions(ctx, traceID, []string{rl.Name, auth.RoleUser})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to resolve permissions : %s.", tests.Failed, testID, err)
+			}
+			if diff := cmp.Diff([]string{auth.PermAuditRead}, perms); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get the updated permissions. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the updated permissions.", tests.Success, testID)
+
+			perms, err = r.Permissions(ctx, traceID, []string{auth.RoleAdmin})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to resolve the admin permissions : %s.", tests.Failed, testID, err)
+			}
+			if len(perms) != len(auth.Permissions) {
+				t.Fatalf("\t%s\tTest %d:\tShould grant admins every permission : %v.", tests.Failed, testID, perms)
+			}
+			t.Logf("\t%s\tTest %d:\tShould grant admins every permission.", tests.Success, testID)
+
+			strip := role.UpdateRole{Permissions: []string{auth.PermUsersRead}}
+			if err := r.Update(ctx, traceID, admin, auth.RoleAdmin, strip, now); err != role.ErrAdminPermissions {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to change the admin permissions : %v.", tests.Failed, testID, err)
+			}
+			desc := role.UpdateRole{Description: tests.StringPointer("Runs the place."), Permissions: auth.Permissions}
+			if err := r.Update(ctx, traceID, admin, auth.RoleAdmin, desc, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to describe the admin role : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only be able to change the description of the admin role.", tests.Success, testID)
+
+			if err := r.Delete(ctx, traceID, admin, auth.RoleAdmin, now); err != role.ErrBuiltIn {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to delete a built-in role : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to delete a built-in role.", tests.Success, testID)
+
+			if err := r.Delete(ctx, traceID, admin, rl.Name, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to delete role : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to delete role.", tests.Success, testID)
+
+			if _, err := r.Permissions(ctx, traceID, []string{rl.Name}); err != role.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould not resolve a deleted role : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not resolve a deleted role.", tests.Success, testID)
+
+			events, err := a.Query(ctx, traceID, audit.QueryFilter{Entity: "role", EntityID: rl.Name}, 10)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to query the history of the role : %s.", tests.Failed, testID, err)
+			}
+			actions := map[string]int{}
+			for _, ev := range events {
+				if ev.Actor != admin.Subject {
+					t.Fatalf("\t%s\tTest %d:\tShould record the admin as the actor : %+v.", tests.Failed, testID, ev)
+				}
+				actions[ev.Action]++
+			}
+			exp := map[string]int{audit.ActionCreate: 1, audit.ActionUpdate: 1, audit.ActionDelete: 1}
+			if diff := cmp.Diff(exp, actions); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould audit every change to the role. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould audit every change to the role.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package sale
+
+import (
+	"time"
+)
+
+// Info represents an individual sale of a product.
+type Info struct {
+	ID          string    `db:"sale_id" json:"id"`
+	ProductID   string    `db:"product_id" json:"product_id"`
+	Quantity    int       `db:"quantity" json:"quantity"`
+	Paid        int       `db:"paid" json:"paid"`
+	DateCreated time.Time `db:"date_created" json:"date_created"`
+}
+
+// NewSale contains information needed to record a new Sale.
+type NewSale struct {
+	Quantity int `json:"quantity" validate:"gte=1"`
+	Paid     int `json:"paid" validate:"gte=0"`
+}
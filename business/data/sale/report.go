@@ -0,0 +1,111 @@
+package sale
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/dapperauteur/go-base-service/business/auth"
+	"github.com/dapperauteur/go-base-service/foundation/database"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Total represents the units sold and amount paid for a single report group.
+type Total struct {
+	Key   string `db:"key" json:"key"`
+	Units int    `db:"units" json:"units"`
+	Paid  int    `db:"paid" json:"paid"`
+}
+
+// Report represents sales totals over a date range grouped by product, by
+// owning user and by day.
+type Report struct {
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	ByProduct []Total   `json:"by_product"`
+	ByOwner   []Total   `json:"by_owner"`
+	ByDay     []Total   `json:"by_day"`
+}
+
+// MarshalCSV flattens the report into rows so it can be served as text/csv.
+// The first column names the grouping each row belongs to.
+func (r Report) MarshalCSV() ([][]string, error) {
+	rows := [][]string{{"group", "key", "units", "paid"}}
+
+	groups := []struct {
+		name   string
+		totals []Total
+	}{
+		{"product", r.ByProduct},
+		{"owner", r.ByOwner},
+		{"day", r.ByDay},
+	}
+	for _, g := range groups {
+		for _, t := range g.totals {
+			rows = append(rows, []string{g.name, t.Key, strconv.Itoa(t.Units), strconv.Itoa(t.Paid)})
+		}
+	}
+
+	return rows, nil
+}
+
+// Report aggregates the sales recorded in the range [from, to). Callers
+// granted reports:read see every sale, other users only see sales of the
+// products they own.
+func (s Sale) Report(ctx context.Context, traceID string, claims auth.Claims, from time.Time, to time.Time) (Report, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.sale.report")
+	defer span.End()
+
+	// An empty owner disables the ownership filter in the queries below.
+	var owner string
+	if !claims.HasPermission(auth.PermReportsRead) {
+		owner = claims.Subject
+	}
+
+	rpt := Report{
+		From: from.UTC(),
+		To:   to.UTC(),
+	}
+
+	groups := []struct {
+		key    string
+		totals *[]Total
+	}{
+		{"p.product_id::text", &rpt.ByProduct},
+		{"p.user_id::text", &rpt.ByOwner},
+		{"to_char(date_trunc('day', s.date_created), 'YYYY-MM-DD')", &rpt.ByDay},
+	}
+
+	for _, g := range groups {
+		q := `
+	SELECT
+		` + g.key + ` AS key,
+		SUM(s.quantity) AS units,
+		SUM(s.paid) AS paid
+	FROM
+		sales AS s
+	JOIN
+		products AS p ON p.product_id = s.product_id
+	WHERE
+		s.date_created >= $1 AND s.date_created < $2 AND
+		($3 = '' OR p.user_id::text = $3)
+	GROUP BY
+		key
+	ORDER BY
+		key`
+
+		s.log.Debug(ctx, "query", "trace_id", traceID, "op", "sale.Report", "query",
+			database.Log(q, rpt.From, rpt.To, owner),
+		)
+
+		totals := []Total{}
+		if err := s.db.SelectContext(ctx, &totals, q, rpt.From, rpt.To, owner); err != nil {
+			return Report{}, errors.Wrap(err, "selecting sales totals")
+		}
+		*g.totals = totals
+	}
+
+	return rpt, nil
+}
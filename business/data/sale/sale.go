@@ -0,0 +1,186 @@
+// Package sale contains sale related CRUD functionality.
+package sale
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/dapperauteur/go-base-service/business/auth"
+	"github.com/dapperauteur/go-base-service/business/data/audit"
+	"github.com/dapperauteur/go-base-service/foundation/database"
+	"github.com/dapperauteur/go-base-service/foundation/logger"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Set of error variables for CRUD operations.
+var (
+	ErrNotFound          = errors.New("not found")
+	ErrInvalidID         = errors.New("ID is not in its proper form")
+	ErrInsufficientStock = errors.New("not enough product in stock")
+)
+
+// Sale manages the set of API's for sale access.
+type Sale struct {
+	log *logger.Logger
+	db  *sqlx.DB
+}
+
+// New constructs a Sale for api access.
+func New(log *logger.Logger, db *sqlx.DB) Sale {
+	return Sale{
+		log: log,
+		db:  db,
+	}
+}
+
+// Create records a sale for the specified product on behalf of the caller.
+// The sale is inserted and the product quantity is decremented inside a
+// single transaction so stock can never go negative. Both changes are
+// recorded in the audit log in that transaction as well.
+func (s Sale) Create(ctx context.Context, traceID string, claims auth.Claims, productID string, ns NewSale, now time.Time) (Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.sale.create")
+	defer span.End()
+
+	if _, err := uuid.Parse(productID); err != nil {
+		return Info{}, ErrInvalidID
+	}
+
+	sl := Info{
+		ID:          uuid.New().String(),
+		ProductID:   productID,
+		Quantity:    ns.Quantity,
+		Paid:        ns.Paid,
+		DateCreated: now.UTC(),
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return Info{}, errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	// Lock the product row so concurrent sales see the decremented quantity.
+	const qStock = `
+	SELECT
+		quantity
+	FROM
+		products
+	WHERE
+		product_id = $1
+	FOR UPDATE`
+
+	s.log.Debug(ctx, "query", "trace_id", traceID, "op", "sale.Create", "query",
+		database.Log(qStock, productID),
+	)
+
+	var stock int
+	if err := tx.GetContext(ctx, &stock, qStock, productID); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "selecting product %q", productID)
+	}
+
+	if stock < sl.Quantity {
+		return Info{}, ErrInsufficientStock
+	}
+
+	const qProduct = `
+	UPDATE
+		products
+	SET
+		"quantity" = quantity - $2,
+		"date_updated" = $3
+	WHERE
+		product_id = $1`
+
+	s.log.Debug(ctx, "query", "trace_id", traceID, "op", "sale.Create", "query",
+		database.Log(qProduct, productID, sl.Quantity, sl.DateCreated),
+	)
+
+	if _, err := tx.ExecContext(ctx, qProduct, productID, sl.Quantity, sl.DateCreated); err != nil {
+		return Info{}, errors.Wrapf(err, "updating product %s quantity", productID)
+	}
+
+	const qSale = `
+	INSERT INTO sales
+		(sale_id, product_id, quantity, paid, date_created)
+	VALUES
+		($1, $2, $3, $4, $5)`
+
+	s.log.Debug(ctx, "query", "trace_id", traceID, "op", "sale.Create", "query",
+		database.Log(qSale, sl.ID, sl.ProductID, sl.Quantity, sl.Paid, sl.DateCreated),
+	)
+
+	if _, err := tx.ExecContext(ctx, qSale, sl.ID, sl.ProductID, sl.Quantity, sl.Paid, sl.DateCreated); err != nil {
+		return Info{}, errors.Wrap(err, "inserting sale")
+	}
+
+	a := audit.New(s.log, tx)
+	events := []audit.NewEvent{
+		{
+			Actor:    claims.Subject,
+			Action:   audit.ActionCreate,
+			Entity:   "sale",
+			EntityID: sl.ID,
+			After:    sl,
+		},
+		{
+			Actor:    claims.Subject,
+			Action:   audit.ActionUpdate,
+			Entity:   "product",
+			EntityID: productID,
+			Before:   map[string]int{"quantity": stock},
+			After:    map[string]int{"quantity": stock - sl.Quantity},
+		},
+	}
+	for _, ne := range events {
+		if err := a.Record(ctx, traceID, ne, now); err != nil {
+			return Info{}, errors.Wrapf(err, "auditing %s of %s %s", ne.Action, ne.Entity, ne.EntityID)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Info{}, errors.Wrap(err, "committing sale")
+	}
+
+	return sl, nil
+}
+
+// QueryByProduct gets all Sales recorded for the specified product.
+func (s Sale) QueryByProduct(ctx context.Context, traceID string, productID string) ([]Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.sale.queryByProduct")
+	defer span.End()
+
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	const q = `
+	SELECT
+		*
+	FROM
+		sales
+	WHERE
+		product_id = $1
+	ORDER BY
+		date_created`
+
+	s.log.Debug(ctx, "query", "trace_id", traceID, "op", "sale.QueryByProduct", "query",
+		database.Log(q, productID),
+	)
+
+	sales := []Info{}
+	if err := s.db.SelectContext(ctx, &sales, q, productID); err != nil {
+		return nil, errors.Wrapf(err, "selecting sales for product %q", productID)
+	}
+
+	return sales, nil
+}
@@ -0,0 +1,196 @@
+package sale_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dapperauteur/go-base-service/business/auth"
+	"github.com/dapperauteur/go-base-service/business/data/product"
+	"github.com/dapperauteur/go-base-service/business/data/sale"
+	"github.com/dapperauteur/go-base-service/business/tests"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+func TestSale(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	p := product.New(log, db)
+	s := sale.New(log, db)
+
+	t.Log("Given the need to record Sales of a Product.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen selling a single Product.", testID)
+		{
+			ctx := tests.Context()
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			claims := auth.Claims{
+				StandardClaims: jwt.StandardClaims{
+					Issuer:    "service project",
+					Subject:   tests.UserID,
+					ExpiresAt: now.Add(time.Hour).Unix(),
+					IssuedAt:  now.Unix(),
+				},
+				Roles: []string{auth.RoleUser},
+			}
+
+			np := product.NewProduct{
+				Name:     "Comic Books",
+				Cost:     10,
+				Quantity: 5,
+			}
+
+			prd, err := p.Create(ctx, traceID, claims, np, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a product : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create a product.", tests.Success, testID)
+
+			ns := sale.NewSale{
+				Quantity: 3,
+				Paid:     30,
+			}
+
+			if _, err := s.Create(ctx, traceID, claims, prd.ID, ns, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to record a sale : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to record a sale.", tests.Success, testID)
+
+			saved, err := p.QueryByID(ctx, traceID, prd.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve product by ID: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to retrieve product by ID.", tests.Success, testID)
+
+			if saved.Quantity != 2 || saved.Sold != 3 || saved.Revenue != 30 {
+				t.Fatalf("\t%s\tTest %d:\tShould see stock decremented by the sale : got quantity %d sold %d revenue %d.", tests.Failed, testID, saved.Quantity, saved.Sold, saved.Revenue)
+			}
+			t.Logf("\t%s\tTest %d:\tShould see stock decremented by the sale.", tests.Success, testID)
+
+			if _, err := s.Create(ctx, traceID, claims, prd.ID, ns, now); errors.Cause(err) != sale.ErrInsufficientStock {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to sell more than is in stock : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to sell more than is in stock.", tests.Success, testID)
+
+			sales, err := s.QueryByProduct(ctx, traceID, prd.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve sales for the product : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to retrieve sales for the product.", tests.Success, testID)
+
+			if len(sales) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould have exactly one sale recorded : got %d.", tests.Failed, testID, len(sales))
+			}
+			t.Logf("\t%s\tTest %d:\tShould have exactly one sale recorded.", tests.Success, testID)
+
+			rpt, err := s.Report(ctx, traceID, claims, now, now.AddDate(0, 0, 1))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to build a sales report : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to build a sales report.", tests.Success, testID)
+
+			if len(rpt.ByProduct) != 1 || rpt.ByProduct[0].Units != 3 || rpt.ByProduct[0].Paid != 30 {
+				t.Fatalf("\t%s\tTest %d:\tShould see the sale in the product totals : got %+v.", tests.Failed, testID, rpt.ByProduct)
+			}
+			t.Logf("\t%s\tTest %d:\tShould see the sale in the product totals.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen reporting on Products owned by different users.", testID)
+		{
+			ctx := tests.Context()
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			admin := auth.Claims{
+				StandardClaims: jwt.StandardClaims{
+					Issuer:    "service project",
+					Subject:   "5cf37266-3473-4006-984f-9325122678b7",
+					ExpiresAt: now.Add(time.Hour).Unix(),
+					IssuedAt:  now.Unix(),
+				},
+				Roles:  []string{auth.RoleAdmin},
+				Scopes: auth.Permissions,
+			}
+			user := admin
+			user.Subject = tests.UserID
+			user.Roles = []string{auth.RoleUser}
+			user.Scopes = nil
+
+			np := product.NewProduct{
+				Name:     "Puzzles",
+				Cost:     20,
+				Quantity: 5,
+			}
+			prd, err := p.Create(ctx, traceID, admin, np, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a product : %s.", tests.Failed, testID, err)
+			}
+			if _, err := s.Create(ctx, traceID, user, prd.ID, sale.NewSale{Quantity: 1, Paid: 20}, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to record a sale : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to sell a product owned by the admin.", tests.Success, testID)
+
+			rpt, err := s.Report(ctx, traceID, user, now, now.AddDate(0, 0, 1))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to build a sales report : %s.", tests.Failed, testID, err)
+			}
+			if len(rpt.ByProduct) != 1 || len(rpt.ByOwner) != 1 || rpt.ByOwner[0].Key != tests.UserID {
+				t.Fatalf("\t%s\tTest %d:\tShould only see the sales of their own products : got %+v.", tests.Failed, testID, rpt)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only see the sales of their own products.", tests.Success, testID)
+
+			rpt, err = s.Report(ctx, traceID, admin, now, now.AddDate(0, 0, 1))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to build a sales report : %s.", tests.Failed, testID, err)
+			}
+			if len(rpt.ByProduct) != 2 || len(rpt.ByOwner) != 2 || len(rpt.ByDay) != 1 || rpt.ByDay[0].Paid != 50 {
+				t.Fatalf("\t%s\tTest %d:\tShould see the sales of every product as an admin : got %+v.", tests.Failed, testID, rpt)
+			}
+			t.Logf("\t%s\tTest %d:\tShould see the sales of every product as an admin.", tests.Success, testID)
+		}
+	}
+}
+
+func TestReportCSV(t *testing.T) {
+	t.Log("Given the need to serve a sales report as CSV.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen flattening a report with every grouping.", testID)
+		{
+			rpt := sale.Report{
+				ByProduct: []sale.Total{{Key: "a8b0e8bf", Units: 3, Paid: 30}},
+				ByOwner:   []sale.Total{{Key: tests.UserID, Units: 3, Paid: 30}},
+				ByDay:     []sale.Total{{Key: "2019-01-01", Units: 3, Paid: 30}},
+			}
+
+			rows, err := rpt.MarshalCSV()
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to marshal the report : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to marshal the report.", tests.Success, testID)
+
+			exp := [][]string{
+				{"group", "key", "units", "paid"},
+				{"product", "a8b0e8bf", "3", "30"},
+				{"owner", tests.UserID, "3", "30"},
+				{"day", "2019-01-01", "3", "30"},
+			}
+			if diff := cmp.Diff(exp, rows); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get a header and a row per total. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get a header and a row per total.", tests.Success, testID)
+
+			rows, err = sale.Report{}.MarshalCSV()
+			if err != nil || len(rows) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould only get the header for an empty report : %v %v.", tests.Failed, testID, rows, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only get the header for an empty report.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/pkg/errors"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	file := func(script string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(script)}
+	}
+
+	tt := []struct {
+		name  string
+		files fstest.MapFS
+		err   string
+	}{
+		{"valid", fstest.MapFS{
+			"m/0001_create_a.up.sql":   file("CREATE TABLE a ();"),
+			"m/0001_create_a.down.sql": file("DROP TABLE a;"),
+			"m/0002_create_b.up.sql":   file("CREATE TABLE b ();"),
+		}, ""},
+		{"gap", fstest.MapFS{
+			"m/0001_create_a.up.sql": file("CREATE TABLE a ();"),
+			"m/0003_create_c.up.sql": file("CREATE TABLE c ();"),
+		}, "missing version 2"},
+		{"duplicate", fstest.MapFS{
+			"m/0001_create_a.up.sql": file("CREATE TABLE a ();"),
+			"m/0001_create_b.up.sql": file("CREATE TABLE b ();"),
+		}, "duplicate version 1"},
+		{"down only", fstest.MapFS{
+			"m/0001_create_a.down.sql": file("DROP TABLE a;"),
+		}, "down script without up script"},
+		{"bad name", fstest.MapFS{
+			"m/1_create_a.sql": file("CREATE TABLE a ();"),
+		}, "name must match"},
+	}
+
+	t.Log("Given the need to load migrations from .sql files.")
+	{
+		for testID, tst := range tt {
+			t.Logf("\tTest %d:\tWhen loading the %q set of files.", testID, tst.name)
+			{
+				ms, err := loadMigrations(tst.files, "m")
+				if tst.err == "" {
+					if err != nil {
+						t.Fatalf("\t%s\tTest %d:\tShould be able to load the migrations : %s.", failed, testID, err)
+					}
+					if len(ms) != 2 || ms[0].Down == "" || ms[1].Version != 2 || ms[1].Description != "create b" {
+						t.Fatalf("\t%s\tTest %d:\tShould get the migrations in order : %+v.", failed, testID, ms)
+					}
+					t.Logf("\t%s\tTest %d:\tShould get the migrations in order.", success, testID)
+					continue
+				}
+
+				if err == nil || !strings.Contains(err.Error(), tst.err) {
+					t.Fatalf("\t%s\tTest %d:\tShould fail with %q : %v.", failed, testID, tst.err, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould fail with %q.", success, testID, tst.err)
+			}
+		}
+	}
+
+	t.Log("Given the embedded migrations and seed sets.")
+	{
+		testID := 0
+		if err := Validate(); err != nil {
+			t.Fatalf("\t%s\tTest %d:\tShould be valid : %s.", failed, testID, err)
+		}
+		t.Logf("\t%s\tTest %d:\tShould be valid.", success, testID)
+	}
+}
+
+func TestLegacyRecord(t *testing.T) {
+	m4, _ := find(4)
+
+	tt := []struct {
+		name     string
+		version  float64
+		checksum string
+		exp      int
+		sum      string
+		err      error
+	}{
+		{"legacy", 2.1, "db3f69aeab451df5865e8b9856c5c18d", 4, m4.Checksum(), nil},
+		{"legacy read as a REAL", float64(float32(2.1)), "db3f69aeab451df5865e8b9856c5c18d", 4, m4.Checksum(), nil},
+		{"modified legacy", 2.1, "00000000000000000000000000000000", 0, "", ErrChecksumMismatch},
+		{"current", 4, "abc", 4, "abc", nil},
+	}
+
+	t.Log("Given the need to renumber records written by earlier releases.")
+	{
+		for testID, tst := range tt {
+			t.Logf("	Test %d:	When reading a %s record.", testID, tst.name)
+			{
+				version, sum, err := legacyRecord(tst.version, tst.checksum)
+				if tst.err != nil {
+					if errors.Cause(err) != tst.err {
+						t.Fatalf("	%s	Test %d:	Should fail with %v : %v.", failed, testID, tst.err, err)
+					}
+					t.Logf("	%s	Test %d:	Should fail with %v.", success, testID, tst.err)
+					continue
+				}
+
+				if err != nil || version != tst.exp || sum != tst.sum {
+					t.Fatalf("	%s	Test %d:	Should get version %d : got %d %q %v.", failed, testID, tst.exp, version, sum, err)
+				}
+				t.Logf("	%s	Test %d:	Should get version %d.", success, testID, tst.exp)
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package schema
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// ErrVersionBehind is returned by CheckVersion when the database is missing
+// migrations the binary expects.
+var ErrVersionBehind = errors.New("schema version is behind")
+
+// lockID identifies the advisory lock held while migrating. Every replica of
+// the service uses the same id so only one of them migrates at a time.
+const lockID = 6020331187542813
+
+// MigrateLocked brings the schema up to date while holding a Postgres
+// advisory lock. Replicas starting at the same time wait for the lock and
+// then find nothing left to apply. Both the wait and the migration are bounded
+// by ctx.
+func MigrateLocked(ctx context.Context, db *sqlx.DB) error {
+
+	// Session level locks belong to a connection so one is held for the
+	// duration instead of going through the pool.
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return errors.Wrap(err, "getting connection")
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return errors.Wrap(err, "acquiring migration lock")
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID)
+
+	return Migrate(ctx, db)
+}
+
+// Version returns the newest migration version applied to db. Zero means no
+// migration has been applied yet.
+func Version(ctx context.Context, db *sqlx.DB) (int, error) {
+	const q = `
+	SELECT
+		COALESCE(MAX(version), 0)
+	FROM
+		darwin_migrations`
+
+	var version float64
+	if err := db.QueryRowContext(ctx, q).Scan(&version); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "42P01" {
+			return 0, nil
+		}
+		return 0, errors.Wrap(err, "selecting schema version")
+	}
+
+	return int(version), nil
+}
+
+// CheckVersion returns ErrVersionBehind until db holds every migration this
+// binary knows about. A newer schema is accepted so replicas still running
+// the previous release stay ready while a new one rolls out.
+func CheckVersion(ctx context.Context, db *sqlx.DB) error {
+	version, err := Version(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	if version < LatestVersion() {
+		return errors.Wrapf(ErrVersionBehind, "have %d, want %d", version, LatestVersion())
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package schema_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dapperauteur/go-base-service/business/data/schema"
+	"github.com/dapperauteur/go-base-service/business/tests"
+	"github.com/pkg/errors"
+)
+
+// lockID is the advisory lock MigrateLocked takes.
+const lockID = 6020331187542813
+
+func TestMigrateLocked(t *testing.T) {
+	_, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	ctx := context.Background()
+
+	t.Log("Given the need to migrate replicas one at a time.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the database has never been migrated.", testID)
+		{
+			if _, err := schema.Down(ctx, db, schema.Options{}); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to roll back : %s.", tests.Failed, testID, err)
+			}
+			if _, err := db.Exec(`DROP TABLE darwin_migrations`); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to drop the migrations table : %s.", tests.Failed, testID, err)
+			}
+
+			version, err := schema.Version(ctx, db)
+			if err != nil || version != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould get version 0 without a migrations table : got %d, %v.", tests.Failed, testID, version, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get version 0 without a migrations table.", tests.Success, testID)
+
+			if err := schema.CheckVersion(ctx, db); errors.Cause(err) != schema.ErrVersionBehind {
+				t.Fatalf("\t%s\tTest %d:\tShould report the schema behind : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould report the schema behind.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen another replica holds the lock.", testID)
+		{
+			conn, err := db.Connx(ctx)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to get a connection : %s.", tests.Failed, testID, err)
+			}
+			defer conn.Close()
+
+			if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to take the lock : %s.", tests.Failed, testID, err)
+			}
+
+			waitCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+			err = schema.MigrateLocked(waitCtx, db)
+			cancel()
+			if err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould give up waiting for the lock.", tests.Failed, testID)
+			}
+			if version, _ := schema.Version(ctx, db); version != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould not migrate without the lock : got version %d.", tests.Failed, testID, version)
+			}
+			t.Logf("\t%s\tTest %d:\tShould give up waiting for the lock : %s.", tests.Success, testID, err)
+
+			if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, lockID); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to release the lock : %s.", tests.Failed, testID, err)
+			}
+
+			if err := schema.MigrateLocked(ctx, db); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould migrate once the lock is free : %s.", tests.Failed, testID, err)
+			}
+			if err := schema.CheckVersion(ctx, db); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould report the schema current : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould migrate once the lock is free.", tests.Success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen a newer release already migrated the database.", testID)
+		{
+			const q = `INSERT INTO darwin_migrations (version, description, checksum, applied_at, execution_time) VALUES ($1, 'newer', '', 0, 0)`
+			if _, err := db.Exec(q, schema.LatestVersion()+1); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to record a newer migration : %s.", tests.Failed, testID, err)
+			}
+
+			if err := schema.CheckVersion(ctx, db); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould accept a newer schema : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould accept a newer schema.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dimiro1/darwin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// Set of error variables for running migrations.
+var (
+	ErrChecksumMismatch = errors.New("applied migration was modified")
+	ErrIrreversible     = errors.New("migration has no down script")
+	ErrUnknownVersion   = errors.New("unknown migration version")
+)
+
+// Migration is a single change to the database schema. Down holds the script
+// that reverts the change; a migration without one can't be rolled back.
+type Migration struct {
+	Version     int
+	Description string
+	Script      string
+	Down        string
+}
+
+// Checksum returns the md5 of the up script. It is calculated the same way
+// darwin does so records written by earlier releases still match.
+func (m Migration) Checksum() string {
+	return darwin.Migration{Script: m.Script}.Checksum()
+}
+
+// MigrationStatus describes the state of a single migration in a database.
+type MigrationStatus struct {
+	Version          int
+	Description      string
+	Applied          bool
+	AppliedAt        time.Time
+	ChecksumMismatch bool
+	Unknown          bool
+}
+
+// Options controls how migrations are run. A zero To migrates up to the
+// latest version or down to an empty schema. In DryRun mode the scripts that
+// would run are written to Out instead of being executed.
+type Options struct {
+	To     int
+	DryRun bool
+	Out    io.Writer
+}
+
+// record is a row of the darwin_migrations table. The table darwin created
+// is kept so databases migrated by earlier releases carry on from where they
+// are.
+type record struct {
+	Version     int
+	Description string
+	Checksum    string
+	AppliedAt   time.Time
+}
+
+// Up applies every pending migration up to and including opts.To. It returns
+// the migrations that were applied, or would be in DryRun mode. A migration
+// still running when ctx is done is rolled back.
+func Up(ctx context.Context, db *sqlx.DB, opts Options) ([]Migration, error) {
+	if migrationsErr != nil {
+		return nil, migrationsErr
+	}
+	if opts.To != 0 {
+		if _, ok := find(opts.To); !ok {
+			return nil, errors.Wrapf(ErrUnknownVersion, "version %d", opts.To)
+		}
+	}
+
+	applied, err := appliedRecords(ctx, db, !opts.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkChecksums(applied); err != nil {
+		return nil, err
+	}
+
+	var planned []Migration
+	for _, m := range migrations {
+		if opts.To != 0 && m.Version > opts.To {
+			break
+		}
+		if _, ok := applied[m.Version]; !ok {
+			planned = append(planned, m)
+		}
+	}
+
+	out := output(opts)
+	for _, m := range planned {
+		if opts.DryRun {
+			fmt.Fprintf(out, "-- up %d: %s\n%s\n\n", m.Version, m.Description, strings.TrimSpace(m.Script))
+			continue
+		}
+
+		start := time.Now()
+		err := inTx(ctx, db, func(tx *sqlx.Tx) error {
+			if _, err := tx.ExecContext(ctx, m.Script); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, darwin.PostgresDialect{}.InsertSQL(),
+				m.Version, m.Description, m.Checksum(), start.Unix(), time.Since(start),
+			)
+			return err
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "applying migration %d", m.Version)
+		}
+	}
+
+	return planned, nil
+}
+
+// Down reverts every applied migration newer than opts.To, newest first. It
+// returns the migrations that were reverted, or would be in DryRun mode.
+// Nothing is reverted unless every one of them has a down script.
+func Down(ctx context.Context, db *sqlx.DB, opts Options) ([]Migration, error) {
+	if migrationsErr != nil {
+		return nil, migrationsErr
+	}
+	if opts.To != 0 {
+		if _, ok := find(opts.To); !ok {
+			return nil, errors.Wrapf(ErrUnknownVersion, "version %d", opts.To)
+		}
+	}
+
+	applied, err := appliedRecords(ctx, db, !opts.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkChecksums(applied); err != nil {
+		return nil, err
+	}
+
+	versions := make([]int, 0, len(applied))
+	for version := range applied {
+		if version > opts.To {
+			versions = append(versions, version)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+	planned := make([]Migration, 0, len(versions))
+	for _, version := range versions {
+		m, ok := find(version)
+		if !ok {
+			return nil, errors.Wrapf(ErrUnknownVersion, "applied version %d", version)
+		}
+		if m.Down == "" {
+			return nil, errors.Wrapf(ErrIrreversible, "version %d", version)
+		}
+		planned = append(planned, m)
+	}
+
+	out := output(opts)
+	for _, m := range planned {
+		if opts.DryRun {
+			fmt.Fprintf(out, "-- down %d: %s\n%s\n\n", m.Version, m.Description, strings.TrimSpace(m.Down))
+			continue
+		}
+
+		err := inTx(ctx, db, func(tx *sqlx.Tx) error {
+			if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, `DELETE FROM darwin_migrations WHERE version = $1`, m.Version)
+			return err
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "reverting migration %d", m.Version)
+		}
+	}
+
+	return planned, nil
+}
+
+// Status reports the state of every known migration followed by any applied
+// migration this binary doesn't know about.
+func Status(ctx context.Context, db *sqlx.DB) ([]MigrationStatus, error) {
+	if migrationsErr != nil {
+		return nil, migrationsErr
+	}
+
+	applied, err := appliedRecords(ctx, db, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	for _, m := range migrations {
+		ms := MigrationStatus{
+			Version:     m.Version,
+			Description: m.Description,
+		}
+		if r, ok := applied[m.Version]; ok {
+			ms.Applied = true
+			ms.AppliedAt = r.AppliedAt
+			ms.ChecksumMismatch = r.Checksum != m.Checksum()
+			delete(applied, m.Version)
+		}
+		statuses = append(statuses, ms)
+	}
+
+	unknown := make([]MigrationStatus, 0, len(applied))
+	for _, r := range applied {
+		unknown = append(unknown, MigrationStatus{
+			Version:     r.Version,
+			Description: r.Description,
+			Applied:     true,
+			AppliedAt:   r.AppliedAt,
+			Unknown:     true,
+		})
+	}
+	sort.Slice(unknown, func(i, j int) bool { return unknown[i].Version < unknown[j].Version })
+
+	return append(statuses, unknown...), nil
+}
+
+// =============================================================================
+
+// appliedRecords returns the migrations recorded in the database keyed by
+// version. When write is set the table is created on first use and legacy
+// records are renumbered in place. Otherwise the database is left untouched
+// and legacy records are only renumbered in the result.
+func appliedRecords(ctx context.Context, db *sqlx.DB, write bool) (map[int]record, error) {
+	dialect := darwin.PostgresDialect{}
+
+	if write {
+		if _, err := db.ExecContext(ctx, dialect.CreateTableSQL()); err != nil {
+			return nil, errors.Wrap(err, "creating migrations table")
+		}
+		if err := renumberLegacy(ctx, db); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := db.QueryContext(ctx, dialect.AllSQL())
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "42P01" && !write {
+			return map[int]record{}, nil
+		}
+		return nil, errors.Wrap(err, "selecting applied migrations")
+	}
+	defer rows.Close()
+
+	applied := make(map[int]record)
+	for rows.Next() {
+		var r record
+		var version float64
+		var appliedAt int64
+		var executionTime float64
+		if err := rows.Scan(&version, &r.Description, &r.Checksum, &appliedAt, &executionTime); err != nil {
+			return nil, errors.Wrap(err, "scanning applied migration")
+		}
+		if r.Version, r.Checksum, err = legacyRecord(version, r.Checksum); err != nil {
+			return nil, err
+		}
+		r.AppliedAt = time.Unix(appliedAt, 0).UTC()
+		applied[r.Version] = r
+	}
+
+	return applied, rows.Err()
+}
+
+// checkChecksums fails when any applied migration was edited afterwards.
+func checkChecksums(applied map[int]record) error {
+	var modified []string
+	for _, m := range migrations {
+		if r, ok := applied[m.Version]; ok && r.Checksum != m.Checksum() {
+			modified = append(modified, fmt.Sprint(m.Version))
+		}
+	}
+
+	if len(modified) > 0 {
+		return errors.Wrapf(ErrChecksumMismatch, "versions %s", strings.Join(modified, ", "))
+	}
+	return nil
+}
+
+// legacyVersions maps the float versions migrations had when they were Go
+// string literals to the numbers of the .sql files that replaced them. The
+// checksum is the one the Go string literal had.
+var legacyVersions = []struct {
+	from     float64
+	to       int
+	checksum string
+}{
+	{1.1, 1, "e20a5436aa0782f46913e8a6b4a27a43"},
+	{1.2, 2, "d43e91094a93e5211a07cc5c26fe7907"},
+	{1.3, 3, "c3820977d460583f78b4065f3e05e4cc"},
+	{2.1, 4, "db3f69aeab451df5865e8b9856c5c18d"},
+	{2.2, 5, "cbf01d54d0bf8207eb427f545eb6cec4"},
+	{2.3, 6, "299de7aaa9d16e12b38fe8a571879b1a"},
+}
+
+// legacyRecord returns the version and checksum a record has once legacy
+// versions are renumbered. The scripts were only reformatted so a legacy
+// record takes the checksum of its .sql file, but only when the recorded
+// checksum shows the script that ran was the released one.
+func legacyRecord(version float64, checksum string) (int, string, error) {
+	for _, lv := range legacyVersions {
+
+		// The version column is a REAL so compare at that precision.
+		if float32(version) != float32(lv.from) {
+			continue
+		}
+		if checksum != lv.checksum {
+			return 0, "", errors.Wrapf(ErrChecksumMismatch, "legacy version %v", lv.from)
+		}
+		m, ok := find(lv.to)
+		if !ok {
+			return 0, "", errors.Wrapf(ErrUnknownVersion, "legacy version %v", lv.from)
+		}
+		return m.Version, m.Checksum(), nil
+	}
+
+	return int(version), checksum, nil
+}
+
+// renumberLegacy moves records written before the migrations became .sql
+// files to their new versions. Nothing is moved unless every legacy record
+// has the checksum of its released script.
+func renumberLegacy(ctx context.Context, db *sqlx.DB) error {
+	const q = `
+	UPDATE darwin_migrations SET
+		version = $1,
+		checksum = $2
+	WHERE
+		version = $3::REAL`
+
+	return inTx(ctx, db, func(tx *sqlx.Tx) error {
+		for _, lv := range legacyVersions {
+			var checksum string
+			err := tx.QueryRowContext(ctx, `SELECT checksum FROM darwin_migrations WHERE version = $1::REAL`, lv.from).Scan(&checksum)
+			switch {
+			case err == sql.ErrNoRows:
+				continue
+			case err != nil:
+				return errors.Wrapf(err, "selecting migration %v", lv.from)
+			}
+
+			version, checksum, err := legacyRecord(lv.from, checksum)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, q, version, checksum, lv.from); err != nil {
+				return errors.Wrapf(err, "renumbering migration %v", lv.from)
+			}
+		}
+		return nil
+	})
+}
+
+// find returns the migration with the specified version.
+func find(version int) (Migration, bool) {
+	for _, m := range migrations {
+		if m.Version == version {
+			return m, true
+		}
+	}
+	return Migration{}, false
+}
+
+// output returns where dry run scripts are written.
+func output(opts Options) io.Writer {
+	if opts.Out == nil {
+		return ioutil.Discard
+	}
+	return opts.Out
+}
+
+// inTx runs f in a transaction that is committed when f succeeds.
+func inTx(ctx context.Context, db *sqlx.DB, f func(tx *sqlx.Tx) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := f(tx); err != nil {
+		if rerr := tx.Rollback(); rerr != nil && rerr != sql.ErrTxDone {
+			return errors.Wrapf(err, "rolling back: %v", rerr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
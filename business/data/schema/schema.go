@@ -2,89 +2,152 @@
 package schema
 
 import (
-	"github.com/dimiro1/darwin"
+	"context"
+	"embed"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
 	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// The migrations and seed data are kept as .sql files embedded into the
+// binary so they get syntax highlighting and review like any other SQL while
+// avoiding pathing issues with the working directory.
+var (
+	//go:embed sql
+	sqlFS embed.FS
+
+	//go:embed sql/delete.sql
+	deleteDoc string
+)
+
+// Migrations are named NNNN_description.up.sql with an optional matching
+// NNNN_description.down.sql. Seed files are named NNNN_description.sql and
+// grouped into one directory per named set.
+var (
+	migrationFile = regexp.MustCompile(`^(\d{4})_([a-z0-9_]+)\.(up|down)\.sql$`)
+	seedFile      = regexp.MustCompile(`^(\d{4})_([a-z0-9_]+)\.sql$`)
 )
 
-// var (
-// 	//go:embed sql/schema.sql
-// 	schemaDoc string
+// migrations contains the queries needed to construct the database schema,
+// loaded from sql/migrations. Files should never be removed or edited once
+// they have been run in production.
+var migrations, migrationsErr = loadMigrations(sqlFS, "sql/migrations")
+
+// Validate reports whether the embedded migrations and seed sets are well
+// formed: every file is correctly named and versions start at 1 with no gaps
+// or duplicates. It should be called at startup.
+func Validate() error {
+	if migrationsErr != nil {
+		return migrationsErr
+	}
 
-// 	//go:embed sql/seed.sql
-// 	seedDoc string
+	sets, err := SeedSets()
+	if err != nil {
+		return err
+	}
+	for _, name := range sets {
+		if _, err := loadSeeds(sqlFS, path.Join("sql/seeds", name)); err != nil {
+			return err
+		}
+	}
 
-// 	//go:embed sql/delete.sql
-// 	deleteDoc string
-// )
+	return nil
+}
 
 // Migrate attempts to bring the schema for db up to date with the migrations
 // defined in this package.
-func Migrate(db *sqlx.DB) error {
+func Migrate(ctx context.Context, db *sqlx.DB) error {
+	_, err := Up(ctx, db, Options{})
+	return err
+}
+
+// LatestVersion returns the version of the newest migration.
+func LatestVersion() int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// =============================================================================
+
+// loadMigrations reads the migration files in dir. The result is sorted by
+// version.
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading migrations")
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		match := migrationFile.FindStringSubmatch(name)
+		if entry.IsDir() || match == nil {
+			return nil, errors.Errorf("migration %s: name must match NNNN_description.up.sql or NNNN_description.down.sql", name)
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading migration %s", name)
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		description := strings.ReplaceAll(match[2], "_", " ")
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Description: description}
+			byVersion[version] = m
+		}
+		if m.Description != description {
+			return nil, errors.Errorf("migration %s: duplicate version %d", name, version)
+		}
+
+		switch match[3] {
+		case "up":
+			m.Script = string(data)
+		case "down":
+			m.Down = string(data)
+		}
+	}
+
+	ms := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Script == "" {
+			return nil, errors.Errorf("migration %04d: down script without up script", m.Version)
+		}
+		ms = append(ms, *m)
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+
+	vs := make([]int, len(ms))
+	for i, m := range ms {
+		vs[i] = m.Version
+	}
+	if err := checkSequence(dir, vs); err != nil {
+		return nil, err
+	}
 
-	driver := darwin.NewGenericDriver(db.DB, darwin.PostgresDialect{})
-	d := darwin.New(driver, migrations, nil)
-	return d.Migrate()
+	return ms, nil
 }
 
-// migrations contains the queries needed to construct the database schema.
-// Entries should never be removed once they have been run in production.
-
-// Using constants in a .go file is an easy way to ensure the schema is part of the compiled executable and avoids pathing issues with the working directory.
-// It has the downside that it lacks syntax highlighting and may be harder to read for some cases compared to using .sql files.
-// You may also consider a combied approach using a tool like packr or go-bindata.
-var migrations = []darwin.Migration{
-	{
-		Version:     1.1,
-		Description: "Create table users",
-		Script: `
-		CREATE TABLE users (
-			user_id       UUID,
-			name          TEXT,
-			email         TEXT UNIQUE,
-			roles         TEXT[],
-			password_hash TEXT,
-			date_created  TIMESTAMP,
-			date_updated  TIMESTAMP,
-		
-			PRIMARY KEY (user_id)
-		);`,
-	},
-	{
-		Version:     1.2,
-		Description: "Create table products",
-		Script: `
-		CREATE TABLE products (
-			product_id   UUID,
-			name         TEXT,
-			cost         INT,
-			quantity     INT,
-			date_created TIMESTAMP,
-			date_updated TIMESTAMP,
-		
-			PRIMARY KEY (product_id)
-		);`,
-	},
-	{
-		Version:     1.3,
-		Description: "Create table sales",
-		Script: `
-		CREATE TABLE sales (
-			sale_id      UUID,
-			product_id   UUID,
-			quantity     INT,
-			paid         INT,
-			date_created TIMESTAMP,
-		
-			PRIMARY KEY (sale_id),
-			FOREIGN KEY (product_id) REFERENCES products(product_id) ON DELETE CASCADE
-		);`,
-	},
-	{
-		Version:     2.1,
-		Description: "Alter table products with user column",
-		Script: `
-		ALTER TABLE products
-	ADD COLUMN user_id UUID DEFAULT '00000000-0000-0000-0000-000000000000'
-	`,
-	},
+// checkSequence makes sure the sorted versions start at 1 and have no gaps or
+// duplicates.
+func checkSequence(dir string, vs []int) error {
+	for i, v := range vs {
+		switch {
+		case v < i+1:
+			return errors.Errorf("%s: duplicate version %d", dir, v)
+		case v > i+1:
+			return errors.Errorf("%s: missing version %d", dir, i+1)
+		}
+	}
+	return nil
 }
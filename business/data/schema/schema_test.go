@@ -0,0 +1,117 @@
+package schema_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dapperauteur/go-base-service/business/data/schema"
+	"github.com/dapperauteur/go-base-service/business/tests"
+	"github.com/pkg/errors"
+)
+
+func TestMigrations(t *testing.T) {
+	_, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	ctx := context.Background()
+
+	t.Log("Given the need to move the schema between versions.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen handling a fully migrated database.", testID)
+		{
+			statuses, err := schema.Status(ctx, db)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to get the status : %s.", tests.Failed, testID, err)
+			}
+			for _, ms := range statuses {
+				if !ms.Applied || ms.ChecksumMismatch || ms.Unknown {
+					t.Fatalf("\t%s\tTest %d:\tShould see every migration applied : %+v.", tests.Failed, testID, ms)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould see every migration applied.", tests.Success, testID)
+
+			var out bytes.Buffer
+			planned, err := schema.Down(ctx, db, schema.Options{To: 3, DryRun: true, Out: &out})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to plan a rollback : %s.", tests.Failed, testID, err)
+			}
+			if len(planned) != schema.LatestVersion()-3 || !strings.Contains(out.String(), "DROP TABLE revoked_tokens") {
+				t.Fatalf("\t%s\tTest %d:\tShould print the rollback SQL : %d planned\n%s", tests.Failed, testID, len(planned), out.String())
+			}
+			t.Logf("\t%s\tTest %d:\tShould print the rollback SQL.", tests.Success, testID)
+
+			reverted, err := schema.Down(ctx, db, schema.Options{To: 3})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to roll back : %s.", tests.Failed, testID, err)
+			}
+			if len(reverted) != len(planned) {
+				t.Fatalf("\t%s\tTest %d:\tShould revert what was planned : got %d exp %d.", tests.Failed, testID, len(reverted), len(planned))
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to roll back.", tests.Success, testID)
+
+			if _, err := db.Exec(`SELECT 1 FROM refresh_tokens`); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould have dropped the reverted tables.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould have dropped the reverted tables.", tests.Success, testID)
+
+			applied, err := schema.Up(ctx, db, schema.Options{To: 5})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to migrate to a version : %s.", tests.Failed, testID, err)
+			}
+			if len(applied) != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould stop at the target version : applied %d.", tests.Failed, testID, len(applied))
+			}
+			t.Logf("\t%s\tTest %d:\tShould stop at the target version.", tests.Success, testID)
+
+			if err := schema.Migrate(ctx, db); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to migrate to the latest version : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to migrate to the latest version.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen handling records written by an earlier release.", testID)
+		{
+			const legacy = `UPDATE darwin_migrations SET version = 1.1, checksum = $1 WHERE version = 1`
+			legacyVersion := func() float64 {
+				var version float64
+				if err := db.QueryRow(`SELECT MIN(version) FROM darwin_migrations`).Scan(&version); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to select the versions : %s.", tests.Failed, testID, err)
+				}
+				return version
+			}
+
+			if _, err := db.Exec(legacy, "e20a5436aa0782f46913e8a6b4a27a43"); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to write a legacy record : %s.", tests.Failed, testID, err)
+			}
+
+			statuses, err := schema.Status(ctx, db)
+			if err != nil || !statuses[0].Applied || statuses[0].ChecksumMismatch || statuses[len(statuses)-1].Unknown {
+				t.Fatalf("\t%s\tTest %d:\tShould see the legacy record as migration 1 : %+v %v.", tests.Failed, testID, statuses, err)
+			}
+			if v := legacyVersion(); v == 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould not renumber the record for a status.", tests.Failed, testID)
+			}
+			if _, err := schema.Up(ctx, db, schema.Options{DryRun: true}); err != nil || legacyVersion() == 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould not renumber the record for a dry run : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould see the legacy record without renumbering it.", tests.Success, testID)
+
+			if err := schema.Migrate(ctx, db); err != nil || legacyVersion() != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould renumber the record when migrating : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould renumber the record when migrating.", tests.Success, testID)
+
+			if _, err := db.Exec(legacy, "00000000000000000000000000000000"); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to write a legacy record : %s.", tests.Failed, testID, err)
+			}
+			if err := schema.Migrate(ctx, db); errors.Cause(err) != schema.ErrChecksumMismatch || legacyVersion() == 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse to renumber a modified legacy record : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse to renumber a modified legacy record.", tests.Success, testID)
+		}
+	}
+}
@@ -1,46 +1,107 @@
 package schema
 
 import (
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
 	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Names of the seed sets every environment can rely on.
+const (
+	SeedDev  = "dev"
+	SeedDemo = "demo"
+	SeedTest = "test"
 )
 
-// Seed runs the set of seed-data queries against db.
+// SeedSets returns the sorted names of the seed sets under sql/seeds.
+func SeedSets() ([]string, error) {
+	entries, err := fs.ReadDir(sqlFS, "sql/seeds")
+	if err != nil {
+		return nil, errors.Wrap(err, "reading seed sets")
+	}
+
+	var sets []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			sets = append(sets, entry.Name())
+		}
+	}
+	sort.Strings(sets)
+
+	return sets, nil
+}
+
+// Seed runs the named set of seed-data queries against db.
 // The queries are ran in a transaction and rolled back if any fail.
-func Seed(db *sqlx.DB) error {
+func Seed(db *sqlx.DB, name string) error {
+	sets, err := SeedSets()
+	if err != nil {
+		return err
+	}
+	i := sort.SearchStrings(sets, name)
+	if i == len(sets) || sets[i] != name {
+		return errors.Errorf("unknown seed set %q, expected one of %s", name, strings.Join(sets, ", "))
+	}
+
+	scripts, err := loadSeeds(sqlFS, path.Join("sql/seeds", name))
+	if err != nil {
+		return err
+	}
+
 	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
 
-	if _, err := tx.Exec(seeds); err != nil {
-		if err := tx.Rollback(); err != nil {
+	for _, script := range scripts {
+		if _, err := tx.Exec(script); err != nil {
+			if err := tx.Rollback(); err != nil {
+				return err
+			}
 			return err
 		}
-		return err
 	}
 	return tx.Commit()
 }
 
-// seeds is a string constant containing all of the queries needed to get the db seeded to a useful state for development.
+// loadSeeds reads the seed files of a set in order.
+func loadSeeds(fsys fs.FS, dir string) ([]string, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading seed set %s", path.Base(dir))
+	}
+
+	// ReadDir returns the entries sorted by name, which is version order.
+	scripts := make([]string, 0, len(entries))
+	vs := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		match := seedFile.FindStringSubmatch(name)
+		if entry.IsDir() || match == nil {
+			return nil, errors.Errorf("seed %s/%s: name must match NNNN_description.sql", path.Base(dir), name)
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading seed %s/%s", path.Base(dir), name)
+		}
 
-// Note that database servers besides PostgreSQL may not support running multiple queries as part of the same execution so this single large constant may need to be broken up.
-const seeds = `
-INSERT INTO users (user_id, name, email, roles, password_hash, date_created, date_updated) VALUES
-	('5cf37266-3473-4006-984f-9325122678b7', 'Admin Gopher', 'admin@example.com', '{ADMIN,USER}', '$2a$10$1ggfMVZV6Js0ybvJufLRUOWHS5f6KneuP0XwwHpJ8L8ipdry9f2/a', '2019-03-24 00:00:00', '2019-03-24 00:00:00'),
-	('45b5fbd3-755f-4379-8f07-a58d4a30fa2f', 'User Gopher', 'user@example.com', '{USER}', '$2a$10$9/XASPKBbJKVfCAZKDH.UuhsuALDr5vVm6VrYA9VFR8rccK86C1hW', '2019-03-24 00:00:00', '2019-03-24 00:00:00')
-	ON CONFLICT DO NOTHING;
+		version, _ := strconv.Atoi(match[1])
+		vs = append(vs, version)
+		scripts = append(scripts, string(data))
+	}
 
-INSERT INTO products (product_id, user_id, name, cost, quantity, date_created, date_updated) VALUES
-	('a2b0639f-2cc6-44b8-b97b-15d69dbb511e', '45b5fbd3-755f-4379-8f07-a58d4a30fa2f', 'Comic Books', 50, 42, '2019-01-01 00:00:01.000001+00', '2019-01-01 00:00:01.000001+00'),
-	('72f8b983-3eb4-48db-9ed0-e45cc6bd716b', '45b5fbd3-755f-4379-8f07-a58d4a30fa2f', 'McDonalds Toys', 75, 120, '2019-01-01 00:00:02.000001+00', '2019-01-01 00:00:02.000001+00')
-	ON CONFLICT DO NOTHING;
+	if err := checkSequence(dir, vs); err != nil {
+		return nil, err
+	}
 
-INSERT INTO sales (sale_id, product_id, quantity, paid, date_created) VALUES
-	('98b6d4b8-f04b-4c79-8c2e-a0aef46854b7', 'a2b0639f-2cc6-44b8-b97b-15d69dbb511e', 2, 100, '2019-01-01 00:00:03.000001+00'),
-	('85f6fb09-eb05-4874-ae39-82d1a30fe0d7', 'a2b0639f-2cc6-44b8-b97b-15d69dbb511e', 5, 250, '2019-01-01 00:00:04.000001+00'),
-	('a235be9e-ab5d-44e6-a987-fa1c749264c7', '72f8b983-3eb4-48db-9ed0-e45cc6bd716b', 3, 225, '2019-01-01 00:00:05.000001+00')
-	ON CONFLICT DO NOTHING;
-`
+	return scripts, nil
+}
 
 // DeleteAll runs the set of Drop-table queries against db.
 // The queries are ran in a transaction and rolled back if any fail.
@@ -50,7 +111,7 @@ func DeleteAll(db *sqlx.DB) error {
 		return err
 	}
 
-	if _, err := tx.Exec(deleteAll); err != nil {
+	if _, err := tx.Exec(deleteDoc); err != nil {
 		if err := tx.Rollback(); err != nil {
 			return err
 		}
@@ -59,10 +120,3 @@ func DeleteAll(db *sqlx.DB) error {
 
 	return tx.Commit()
 }
-
-// deleteAll is used to clean the database between tests.
-const deleteAll = `
-DELETE FROM sales;
-DELETE FROM products;
-DELETE FROM users;
-`
@@ -0,0 +1,8 @@
+DELETE FROM roles WHERE name NOT IN ('ADMIN', 'USER');
+DELETE FROM audit_events;
+DELETE FROM password_resets;
+DELETE FROM revoked_tokens;
+DELETE FROM refresh_tokens;
+DELETE FROM sales;
+DELETE FROM products;
+DELETE FROM users;
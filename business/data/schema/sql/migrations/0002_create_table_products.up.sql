@@ -0,0 +1,10 @@
+CREATE TABLE products (
+	product_id   UUID,
+	name         TEXT,
+	cost         INT,
+	quantity     INT,
+	date_created TIMESTAMP,
+	date_updated TIMESTAMP,
+
+	PRIMARY KEY (product_id)
+);
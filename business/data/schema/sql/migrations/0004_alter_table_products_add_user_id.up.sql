@@ -0,0 +1,2 @@
+ALTER TABLE products
+	ADD COLUMN user_id UUID DEFAULT '00000000-0000-0000-0000-000000000000';
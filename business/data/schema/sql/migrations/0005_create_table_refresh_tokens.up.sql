@@ -0,0 +1,11 @@
+CREATE TABLE refresh_tokens (
+	token_hash   TEXT,
+	user_id      UUID,
+	access_jti   TEXT,
+	date_created TIMESTAMP,
+	date_expires TIMESTAMP,
+	date_revoked TIMESTAMP,
+
+	PRIMARY KEY (token_hash),
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
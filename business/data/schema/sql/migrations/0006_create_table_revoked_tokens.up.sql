@@ -0,0 +1,6 @@
+CREATE TABLE revoked_tokens (
+	jti          TEXT,
+	date_expires TIMESTAMP,
+
+	PRIMARY KEY (jti)
+);
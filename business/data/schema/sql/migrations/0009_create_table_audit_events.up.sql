@@ -0,0 +1,14 @@
+CREATE TABLE audit_events (
+	event_id     UUID,
+	actor        TEXT,
+	action       TEXT,
+	entity       TEXT,
+	entity_id    TEXT,
+	changes      JSONB,
+	trace_id     TEXT,
+	date_created TIMESTAMP,
+
+	PRIMARY KEY (event_id)
+);
+CREATE INDEX audit_events_entity_idx ON audit_events (entity, entity_id, date_created);
+CREATE INDEX audit_events_actor_idx ON audit_events (actor, date_created);
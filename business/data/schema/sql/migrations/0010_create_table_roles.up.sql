@@ -0,0 +1,12 @@
+CREATE TABLE roles (
+	name         TEXT,
+	description  TEXT,
+	permissions  TEXT[],
+	date_created TIMESTAMP,
+	date_updated TIMESTAMP,
+
+	PRIMARY KEY (name)
+);
+INSERT INTO roles (name, description, permissions, date_created, date_updated) VALUES
+	('ADMIN', 'Manages users, roles and the audit log.', '{audit:read,roles:read,roles:write,users:read,users:write}', NOW(), NOW()),
+	('USER', 'A regular account.', '{}', NOW(), NOW());
@@ -0,0 +1,3 @@
+ALTER TABLE users
+	ADD COLUMN date_verified TIMESTAMP;
+UPDATE users SET date_verified = date_created;
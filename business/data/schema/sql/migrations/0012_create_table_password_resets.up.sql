@@ -0,0 +1,10 @@
+CREATE TABLE password_resets (
+	token_hash   TEXT,
+	user_id      UUID,
+	date_created TIMESTAMP,
+	date_expires TIMESTAMP,
+	date_used    TIMESTAMP,
+
+	PRIMARY KEY (token_hash),
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+ALTER TABLE refresh_tokens
+	ADD COLUMN access_expires TIMESTAMP;
@@ -0,0 +1,3 @@
+UPDATE roles
+	SET permissions = '{audit:read,roles:read,roles:write,users:read,users:write}'
+	WHERE name = 'ADMIN';
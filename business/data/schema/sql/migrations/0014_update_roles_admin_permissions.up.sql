@@ -0,0 +1,3 @@
+UPDATE roles
+	SET permissions = '{audit:read,keys:read,products:write,reports:read,roles:read,roles:write,testing:read,users:read,users:write}'
+	WHERE name = 'ADMIN';
@@ -0,0 +1,16 @@
+INSERT INTO users (user_id, name, email, roles, password_hash, date_created, date_updated) VALUES
+	('b1c3a9d2-6f0e-4a57-9c8b-2d4e6f8a0b1c', 'Shop Gopher', 'shop@example.com', '{USER}', '$2a$10$9/XASPKBbJKVfCAZKDH.UuhsuALDr5vVm6VrYA9VFR8rccK86C1hW', '2019-04-01 00:00:00', '2019-04-01 00:00:00')
+	ON CONFLICT DO NOTHING;
+
+INSERT INTO products (product_id, user_id, name, cost, quantity, date_created, date_updated) VALUES
+	('0f6f7c1e-3b2a-4d5e-8f90-1a2b3c4d5e6f', 'b1c3a9d2-6f0e-4a57-9c8b-2d4e6f8a0b1c', 'Trading Cards', 20, 300, '2019-04-02 00:00:01.000001+00', '2019-04-02 00:00:01.000001+00'),
+	('1e2d3c4b-5a69-4788-97a6-b5c4d3e2f1a0', 'b1c3a9d2-6f0e-4a57-9c8b-2d4e6f8a0b1c', 'Board Games', 120, 15, '2019-04-02 00:00:02.000001+00', '2019-04-02 00:00:02.000001+00'),
+	('2a3b4c5d-6e7f-4081-9293-a4b5c6d7e8f9', '45b5fbd3-755f-4379-8f07-a58d4a30fa2f', 'Action Figures', 35, 60, '2019-04-02 00:00:03.000001+00', '2019-04-02 00:00:03.000001+00')
+	ON CONFLICT DO NOTHING;
+
+INSERT INTO sales (sale_id, product_id, quantity, paid, date_created) VALUES
+	('3c4d5e6f-7081-4293-a4b5-c6d7e8f90a1b', '0f6f7c1e-3b2a-4d5e-8f90-1a2b3c4d5e6f', 10, 200, '2019-04-03 00:00:01.000001+00'),
+	('4d5e6f70-8192-43a4-b5c6-d7e8f90a1b2c', '0f6f7c1e-3b2a-4d5e-8f90-1a2b3c4d5e6f', 4, 80, '2019-04-04 00:00:01.000001+00'),
+	('5e6f7081-92a3-44b5-86d7-e8f90a1b2c3d', '1e2d3c4b-5a69-4788-97a6-b5c4d3e2f1a0', 1, 120, '2019-04-05 00:00:01.000001+00'),
+	('6f708192-a3b4-45c6-97e8-f90a1b2c3d4e', '2a3b4c5d-6e7f-4081-9293-a4b5c6d7e8f9', 6, 210, '2019-04-06 00:00:01.000001+00')
+	ON CONFLICT DO NOTHING;
@@ -0,0 +1,62 @@
+package token
+
+import (
+	"testing"
+	"time"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestDeniedCache(t *testing.T) {
+	t.Log("Given the need to cache denylist answers.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen answers are cached, expire and are forgotten.", testID)
+		{
+			c := deniedCache{entries: make(map[string]deniedEntry)}
+			now := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+			if _, ok := c.get("jti", now); ok {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT have an answer before one is cached.", failed, testID)
+			}
+
+			c.set("jti", true, now.Add(time.Minute), now)
+			if denied, ok := c.get("jti", now.Add(time.Second)); !ok || !denied {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the cached answer : %v, %v.", failed, testID, denied, ok)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the cached answer.", success, testID)
+
+			if _, ok := c.get("jti", now.Add(2*time.Minute)); ok {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT use an answer past its time.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT use an answer past its time.", success, testID)
+
+			c.set("jti", false, now.Add(deniedCacheTTL), now)
+			c.forget("jti")
+			if _, ok := c.get("jti", now); ok {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT use a forgotten answer.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT use a forgotten answer.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen the cache has grown.", testID)
+		{
+			c := deniedCache{entries: make(map[string]deniedEntry)}
+			now := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+			for i := 0; i < deniedCacheSize; i++ {
+				c.set(string(rune(i)), false, now, now)
+			}
+			c.set("live", true, now.Add(time.Hour), now.Add(time.Second))
+			if len(c.entries) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould drop the answers no longer in use : %d left.", failed, testID, len(c.entries))
+			}
+			t.Logf("\t%s\tTest %d:\tShould drop the answers no longer in use.", success, testID)
+		}
+	}
+}
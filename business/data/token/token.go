@@ -0,0 +1,637 @@
+// Package token contains refresh token, token revocation and password reset
+// token functionality.
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/dapperauteur/go-base-service/foundation/database"
+	"github.com/dapperauteur/go-base-service/foundation/logger"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Set of error variables for token operations.
+var (
+	ErrNotFound = errors.New("not found")
+	ErrExpired  = errors.New("refresh token has expired")
+	ErrRevoked  = errors.New("refresh token has been revoked")
+
+	ErrResetUsed    = errors.New("reset token has already been used")
+	ErrResetExpired = errors.New("reset token has expired")
+)
+
+// RefreshTTL is how long a refresh token can be used before it expires.
+const RefreshTTL = 30 * 24 * time.Hour
+
+// ResetTTL is how long a password reset token can be used before it expires.
+const ResetTTL = time.Hour
+
+// deniedCacheTTL is how long a token found missing from the denylist is
+// trusted without looking again. A revocation made by another instance of the
+// service can take this long to be seen.
+const deniedCacheTTL = 5 * time.Second
+
+// deniedCacheSize is the number of cached denylist answers after which the
+// ones no longer in use are dropped.
+const deniedCacheSize = 10000
+
+// Token manages the set of API's for refresh tokens and revoked access tokens.
+type Token struct {
+	log *logger.Logger
+	db  *sqlx.DB
+}
+
+// New constructs a Token for api access.
+func New(log *logger.Logger, db *sqlx.DB) Token {
+	return Token{
+		log: log,
+		db:  db,
+	}
+}
+
+// Create issues a new refresh token for the user. Only a hash of the token is
+// stored. The jti and expiry of the access token issued alongside it are
+// recorded so the access token can be revoked together with the refresh token.
+func (t Token) Create(ctx context.Context, traceID string, userID string, accessJTI string, accessExpires time.Time, now time.Time) (string, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.token.create")
+	defer span.End()
+
+	return t.create(ctx, t.db, traceID, userID, accessJTI, accessExpires, now)
+}
+
+// Rotate exchanges a refresh token for a new one. The presented token is
+// revoked so it can only be used once. Presenting a token that was already
+// revoked indicates it was stolen, so every session of its user is revoked.
+// It returns the id of the user the token belongs to.
+func (t Token) Rotate(ctx context.Context, traceID string, refresh string, accessJTI string, accessExpires time.Time, now time.Time) (string, string, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.token.rotate")
+	defer span.End()
+
+	tx, err := t.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", "", errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	const q = `
+	SELECT
+		user_id, date_expires, date_revoked
+	FROM
+		refresh_tokens
+	WHERE
+		token_hash = $1
+	FOR UPDATE`
+
+	hash := hashToken(refresh)
+
+	t.log.Debug(ctx, "query", "trace_id", traceID, "op", "token.Rotate", "query",
+		database.Log(q, hash),
+	)
+
+	var row struct {
+		UserID      string       `db:"user_id"`
+		DateExpires time.Time    `db:"date_expires"`
+		DateRevoked sql.NullTime `db:"date_revoked"`
+	}
+	if err := tx.GetContext(ctx, &row, q, hash); err != nil {
+		if err == sql.ErrNoRows {
+			return "", "", ErrNotFound
+		}
+		return "", "", errors.Wrap(err, "selecting refresh token")
+	}
+
+	if row.DateRevoked.Valid {
+		if err := t.revokeUser(ctx, tx, traceID, row.UserID, "", now); err != nil {
+			return "", "", err
+		}
+		if err := tx.Commit(); err != nil {
+			return "", "", errors.Wrap(err, "committing revocation")
+		}
+		return "", "", ErrRevoked
+	}
+
+	if now.After(row.DateExpires) {
+		return "", "", ErrExpired
+	}
+
+	const qRevoke = `
+	UPDATE
+		refresh_tokens
+	SET
+		"date_revoked" = $2
+	WHERE
+		token_hash = $1`
+
+	t.log.Debug(ctx, "query", "trace_id", traceID, "op", "token.Rotate", "query",
+		database.Log(qRevoke, hash, now.UTC()),
+	)
+
+	if _, err := tx.ExecContext(ctx, qRevoke, hash, now.UTC()); err != nil {
+		return "", "", errors.Wrap(err, "revoking refresh token")
+	}
+
+	next, err := t.create(ctx, tx, traceID, row.UserID, accessJTI, accessExpires, now)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", "", errors.Wrap(err, "committing rotation")
+	}
+
+	return row.UserID, next, nil
+}
+
+// Revoke revokes a single refresh token along with the access token that was
+// issued with it. It returns the id of the user the token belongs to.
+func (t Token) Revoke(ctx context.Context, traceID string, refresh string, now time.Time) (string, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.token.revoke")
+	defer span.End()
+
+	tx, err := t.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	const q = `
+	UPDATE
+		refresh_tokens
+	SET
+		"date_revoked" = $2
+	WHERE
+		token_hash = $1
+	RETURNING
+		user_id, access_jti, COALESCE(access_expires, date_expires) AS access_expires`
+
+	hash := hashToken(refresh)
+
+	t.log.Debug(ctx, "query", "trace_id", traceID, "op", "token.Revoke", "query",
+		database.Log(q, hash, now.UTC()),
+	)
+
+	var row struct {
+		UserID        string    `db:"user_id"`
+		AccessJTI     string    `db:"access_jti"`
+		AccessExpires time.Time `db:"access_expires"`
+	}
+	if err := tx.GetContext(ctx, &row, q, hash, now.UTC()); err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrNotFound
+		}
+		return "", errors.Wrap(err, "revoking refresh token")
+	}
+
+	if err := t.deny(ctx, tx, traceID, row.AccessJTI, row.AccessExpires); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", errors.Wrap(err, "committing revocation")
+	}
+
+	return row.UserID, nil
+}
+
+// RevokeUser revokes every refresh token of the user and the access tokens
+// issued with them. This logs the user out of every session.
+func (t Token) RevokeUser(ctx context.Context, traceID string, userID string, now time.Time) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.token.revokeUser")
+	defer span.End()
+
+	tx, err := t.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	if err := t.revokeUser(ctx, tx, traceID, userID, "", now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing revocation")
+	}
+
+	return nil
+}
+
+// RevokeUserTx revokes every session of the user like RevokeUser, inside the
+// provided transaction so the revocation is committed together with the
+// change that called for it.
+func (t Token) RevokeUserTx(ctx context.Context, tx *sqlx.Tx, traceID string, userID string, now time.Time) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.token.revokeUserTx")
+	defer span.End()
+
+	return t.revokeUser(ctx, tx, traceID, userID, "", now)
+}
+
+// RevokeOthers revokes every session of the user except the one the access
+// token with the keepJTI id belongs to. This logs the user out everywhere
+// else.
+func (t Token) RevokeOthers(ctx context.Context, traceID string, userID string, keepJTI string, now time.Time) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.token.revokeOthers")
+	defer span.End()
+
+	tx, err := t.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	if err := t.revokeUser(ctx, tx, traceID, userID, keepJTI, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing revocation")
+	}
+
+	return nil
+}
+
+// Deny adds an access token id to the denylist until the token expires.
+func (t Token) Deny(ctx context.Context, traceID string, jti string, expires time.Time) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.token.deny")
+	defer span.End()
+
+	return t.deny(ctx, t.db, traceID, jti, expires)
+}
+
+// Denied reports whether an access token id is on the denylist. It allows a
+// Token to be used as the auth.Denylist checked when validating tokens.
+// Answers are cached as described by deniedCache.
+func (t Token) Denied(ctx context.Context, jti string) (bool, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.token.denied")
+	defer span.End()
+
+	now := time.Now()
+	if denied, ok := denials.get(jti, now); ok {
+		return denied, nil
+	}
+
+	const q = `
+	SELECT
+		date_expires
+	FROM
+		revoked_tokens
+	WHERE
+		jti = $1`
+
+	var expires time.Time
+	if err := t.db.GetContext(ctx, &expires, q, jti); err != nil {
+		if err == sql.ErrNoRows {
+			denials.set(jti, false, now.Add(deniedCacheTTL), now)
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "checking denylist for %q", jti)
+	}
+
+	denials.set(jti, true, expires, now)
+	return true, nil
+}
+
+// PurgeDenied removes the access token ids whose tokens expired before now
+// from the denylist. Expired tokens are rejected without it. It returns the
+// number of ids removed.
+func (t Token) PurgeDenied(ctx context.Context, traceID string, now time.Time) (int, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.token.purgeDenied")
+	defer span.End()
+
+	const q = `
+	DELETE FROM
+		revoked_tokens
+	WHERE
+		date_expires < $1`
+
+	t.log.Debug(ctx, "query", "trace_id", traceID, "op", "token.PurgeDenied", "query",
+		database.Log(q, now.UTC()),
+	)
+
+	res, err := t.db.ExecContext(ctx, q, now.UTC())
+	if err != nil {
+		return 0, errors.Wrap(err, "purging denylist")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "purging denylist")
+	}
+
+	return int(n), nil
+}
+
+// CreateReset issues a new password reset token for the user. Only a hash of
+// the token is stored.
+func (t Token) CreateReset(ctx context.Context, traceID string, userID string, now time.Time) (string, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.token.createReset")
+	defer span.End()
+
+	reset, err := generate()
+	if err != nil {
+		return "", errors.Wrap(err, "generating reset token")
+	}
+
+	const q = `
+	INSERT INTO password_resets
+		(token_hash, user_id, date_created, date_expires)
+	VALUES
+		($1, $2, $3, $4)`
+
+	hash := hashToken(reset)
+	created := now.UTC()
+	expires := created.Add(ResetTTL)
+
+	t.log.Debug(ctx, "query", "trace_id", traceID, "op", "token.CreateReset", "query",
+		database.Log(q, hash, userID, created, expires),
+	)
+
+	if _, err := t.db.ExecContext(ctx, q, hash, userID, created, expires); err != nil {
+		return "", errors.Wrap(err, "inserting reset token")
+	}
+
+	return reset, nil
+}
+
+// UseReset uses a password reset token by running fn with the id of the user
+// it belongs to, inside the transaction that marks the token used. The token
+// and every other unused reset token of the user are only used up when fn
+// succeeds, so a failed reset can be tried again.
+func (t Token) UseReset(ctx context.Context, traceID string, reset string, now time.Time, fn func(tx *sqlx.Tx, userID string) error) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.token.useReset")
+	defer span.End()
+
+	tx, err := t.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	const q = `
+	SELECT
+		user_id, date_expires, date_used
+	FROM
+		password_resets
+	WHERE
+		token_hash = $1
+	FOR UPDATE`
+
+	hash := hashToken(reset)
+
+	t.log.Debug(ctx, "query", "trace_id", traceID, "op", "token.UseReset", "query",
+		database.Log(q, hash),
+	)
+
+	var row struct {
+		UserID      string       `db:"user_id"`
+		DateExpires time.Time    `db:"date_expires"`
+		DateUsed    sql.NullTime `db:"date_used"`
+	}
+	if err := tx.GetContext(ctx, &row, q, hash); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return errors.Wrap(err, "selecting reset token")
+	}
+
+	if row.DateUsed.Valid {
+		return ErrResetUsed
+	}
+	if now.After(row.DateExpires) {
+		return ErrResetExpired
+	}
+
+	// Every unused token of the user is used up with this one. When another
+	// of them was used meanwhile, it has used this one up already.
+	const qUse = `
+	UPDATE
+		password_resets
+	SET
+		"date_used" = $2
+	WHERE
+		user_id = $1 AND date_used IS NULL
+	RETURNING
+		token_hash`
+
+	t.log.Debug(ctx, "query", "trace_id", traceID, "op", "token.UseReset", "query",
+		database.Log(qUse, row.UserID, now.UTC()),
+	)
+
+	var used []string
+	if err := tx.SelectContext(ctx, &used, qUse, row.UserID, now.UTC()); err != nil {
+		return errors.Wrap(err, "using reset tokens")
+	}
+	if !contains(used, hash) {
+		return ErrResetUsed
+	}
+
+	if err := fn(tx, row.UserID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing reset")
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// create inserts a new refresh token using the provided executor so it can
+// take part in a transaction.
+func (t Token) create(ctx context.Context, db sqlx.ExtContext, traceID string, userID string, accessJTI string, accessExpires time.Time, now time.Time) (string, error) {
+	refresh, err := generate()
+	if err != nil {
+		return "", errors.Wrap(err, "generating refresh token")
+	}
+
+	const q = `
+	INSERT INTO refresh_tokens
+		(token_hash, user_id, access_jti, access_expires, date_created, date_expires)
+	VALUES
+		($1, $2, $3, $4, $5, $6)`
+
+	hash := hashToken(refresh)
+	created := now.UTC()
+	expires := created.Add(RefreshTTL)
+
+	t.log.Debug(ctx, "query", "trace_id", traceID, "op", "token.Create", "query",
+		database.Log(q, hash, userID, accessJTI, accessExpires.UTC(), created, expires),
+	)
+
+	if _, err := db.ExecContext(ctx, q, hash, userID, accessJTI, accessExpires.UTC(), created, expires); err != nil {
+		return "", errors.Wrap(err, "inserting refresh token")
+	}
+
+	return refresh, nil
+}
+
+// revokeUser revokes every active refresh token of the user inside the
+// provided transaction and denies the access tokens issued with them. The
+// session of the access token with the keepJTI id is left alone; an empty
+// keepJTI revokes them all.
+func (t Token) revokeUser(ctx context.Context, tx *sqlx.Tx, traceID string, userID string, keepJTI string, now time.Time) error {
+	const q = `
+	UPDATE
+		refresh_tokens
+	SET
+		"date_revoked" = $2
+	WHERE
+		user_id = $1 AND date_revoked IS NULL AND
+		($3 = '' OR access_jti IS DISTINCT FROM $3)
+	RETURNING
+		access_jti, COALESCE(access_expires, date_expires) AS access_expires`
+
+	t.log.Debug(ctx, "query", "trace_id", traceID, "op", "token.RevokeUser", "query",
+		database.Log(q, userID, now.UTC(), keepJTI),
+	)
+
+	var rows []struct {
+		AccessJTI     string    `db:"access_jti"`
+		AccessExpires time.Time `db:"access_expires"`
+	}
+	if err := tx.SelectContext(ctx, &rows, q, userID, now.UTC(), keepJTI); err != nil {
+		return errors.Wrapf(err, "revoking refresh tokens for user %s", userID)
+	}
+
+	for _, row := range rows {
+		if err := t.deny(ctx, tx, traceID, row.AccessJTI, row.AccessExpires); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deny inserts an access token id into the denylist using the provided
+// executor so it can take part in a transaction.
+func (t Token) deny(ctx context.Context, db sqlx.ExtContext, traceID string, jti string, expires time.Time) error {
+	if jti == "" {
+		return nil
+	}
+
+	const q = `
+	INSERT INTO revoked_tokens
+		(jti, date_expires)
+	VALUES
+		($1, $2)
+	ON CONFLICT DO NOTHING`
+
+	t.log.Debug(ctx, "query", "trace_id", traceID, "op", "token.Deny", "query",
+		database.Log(q, jti, expires.UTC()),
+	)
+
+	if _, err := db.ExecContext(ctx, q, jti, expires.UTC()); err != nil {
+		return errors.Wrapf(err, "denying token %s", jti)
+	}
+
+	// The denial may still be rolled back, so it is only read back once it
+	// is committed.
+	denials.forget(jti)
+
+	return nil
+}
+
+// generate returns a new random token that is safe to use in a URL.
+func generate() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the form of a refresh or reset token that is stored.
+func hashToken(refresh string) string {
+	sum := sha256.Sum256([]byte(refresh))
+	return hex.EncodeToString(sum[:])
+}
+
+// contains reports whether the list holds the string.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// =============================================================================
+
+// denials caches the answers of Denied for every Token in the process so
+// validating a token doesn't query the database on every request.
+var denials = deniedCache{
+	entries: make(map[string]deniedEntry),
+}
+
+// deniedCache holds whether access token ids are denied. A denied id is kept
+// until its token expires and an id that is not until deniedCacheTTL passed.
+type deniedCache struct {
+	mu      sync.Mutex
+	entries map[string]deniedEntry
+}
+
+// deniedEntry is a cached answer and when it stops being used.
+type deniedEntry struct {
+	denied bool
+	until  time.Time
+}
+
+// get returns the cached answer for the id, if there is one still in use.
+func (c *deniedCache) get(jti string, now time.Time) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[jti]
+	if !ok || now.After(e.until) {
+		return false, false
+	}
+	return e.denied, true
+}
+
+// set caches the answer for the id until the specified time. Answers no
+// longer in use are dropped once the cache has grown.
+func (c *deniedCache) set(jti string, denied bool, until time.Time, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= deniedCacheSize {
+		for k, e := range c.entries {
+			if now.After(e.until) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[jti] = deniedEntry{denied: denied, until: until}
+}
+
+// forget drops the cached answer for the id.
+func (c *deniedCache) forget(jti string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, jti)
+}
@@ -0,0 +1,225 @@
+package token_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dapperauteur/go-base-service/business/data/schema"
+	"github.com/dapperauteur/go-base-service/business/data/token"
+	"github.com/dapperauteur/go-base-service/business/tests"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+func TestToken(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	if err := schema.Seed(db, schema.SeedTest); err != nil {
+		t.Fatalf("seeding error: %s", err)
+	}
+
+	tk := token.New(log, db)
+
+	t.Log("Given the need to rotate and revoke refresh tokens.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen handling a single session.", testID)
+		{
+			ctx := tests.Context()
+			now := time.Now()
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			refresh, err := tk.Create(ctx, traceID, tests.UserID, "jti-1", now.Add(time.Hour), now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a refresh token : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create a refresh token.", tests.Success, testID)
+
+			userID, next, err := tk.Rotate(ctx, traceID, refresh, "jti-2", now.Add(time.Hour), now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to rotate the refresh token : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to rotate the refresh token.", tests.Success, testID)
+
+			if userID != tests.UserID {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the token's user : got %s.", tests.Failed, testID, userID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the token's user.", tests.Success, testID)
+
+			if _, _, err := tk.Rotate(ctx, traceID, refresh, "jti-3", now.Add(time.Hour), now); errors.Cause(err) != token.ErrRevoked {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to reuse a rotated refresh token : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to reuse a rotated refresh token.", tests.Success, testID)
+
+			if _, _, err := tk.Rotate(ctx, traceID, next, "jti-4", now.Add(time.Hour), now); errors.Cause(err) != token.ErrRevoked {
+				t.Fatalf("\t%s\tTest %d:\tShould have revoked every session after reuse : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould have revoked every session after reuse.", tests.Success, testID)
+
+			denied, err := tk.Denied(ctx, "jti-2")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to check the denylist : %s.", tests.Failed, testID, err)
+			}
+			if !denied {
+				t.Fatalf("\t%s\tTest %d:\tShould see the access token of a revoked session denied.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould see the access token of a revoked session denied.", tests.Success, testID)
+
+			var expires time.Time
+			if err := db.Get(&expires, `SELECT date_expires FROM revoked_tokens WHERE jti = 'jti-2'`); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to read the denial : %s.", tests.Failed, testID, err)
+			}
+			if !expires.Equal(now.Add(time.Hour).UTC().Truncate(time.Microsecond)) {
+				t.Fatalf("\t%s\tTest %d:\tShould deny the access token until it expires : got %v.", tests.Failed, testID, expires)
+			}
+			t.Logf("\t%s\tTest %d:\tShould deny the access token until it expires.", tests.Success, testID)
+
+			if n, err := tk.PurgeDenied(ctx, traceID, now); err != nil || n != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT purge denials of tokens that have not expired : %d, %v.", tests.Failed, testID, n, err)
+			}
+			if n, err := tk.PurgeDenied(ctx, traceID, now.Add(2*time.Hour)); err != nil || n == 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould purge denials of expired tokens : %d, %v.", tests.Failed, testID, n, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould purge denials of expired tokens only.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen logging out every other session.", testID)
+		{
+			ctx := tests.Context()
+			now := time.Now()
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			kept, err := tk.Create(ctx, traceID, tests.UserID, "jti-5", now.Add(time.Hour), now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a refresh token : %s.", tests.Failed, testID, err)
+			}
+			other, err := tk.Create(ctx, traceID, tests.UserID, "jti-6", now.Add(time.Hour), now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a refresh token : %s.", tests.Failed, testID, err)
+			}
+
+			if err := tk.RevokeOthers(ctx, traceID, tests.UserID, "jti-5", now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to revoke the other sessions : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to revoke the other sessions.", tests.Success, testID)
+
+			denied, err := tk.Denied(ctx, "jti-5")
+			if err != nil || denied {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the current access token : %v.", tests.Failed, testID, err)
+			}
+			if _, _, err := tk.Rotate(ctx, traceID, kept, "jti-8", now.Add(time.Hour), now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the current session : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould keep the current session.", tests.Success, testID)
+
+			if _, _, err := tk.Rotate(ctx, traceID, other, "jti-7", now.Add(time.Hour), now); errors.Cause(err) != token.ErrRevoked {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to use another session : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to use another session.", tests.Success, testID)
+		}
+		testID = 2
+		t.Logf("\tTest %d:\tWhen handling a password reset.", testID)
+		{
+			ctx := tests.Context()
+			now := time.Now()
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			reset, err := tk.CreateReset(ctx, traceID, tests.UserID, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a reset token : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create a reset token.", tests.Success, testID)
+
+			other, err := tk.CreateReset(ctx, traceID, tests.UserID, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create another reset token : %s.", tests.Failed, testID, err)
+			}
+
+			var userID string
+			use := func(tx *sqlx.Tx, id string) error {
+				userID = id
+				return nil
+			}
+
+			if err := tk.UseReset(ctx, traceID, reset, now.Add(token.ResetTTL+time.Second), use); err != token.ErrResetExpired {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to use an expired reset token : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to use an expired reset token.", tests.Success, testID)
+
+			failed := errors.New("reset failed")
+			if err := tk.UseReset(ctx, traceID, reset, now, func(tx *sqlx.Tx, id string) error { return failed }); err != failed {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the error of a failed reset : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the error of a failed reset.", tests.Success, testID)
+
+			if err := tk.UseReset(ctx, traceID, reset, now, use); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to use the reset token after a failed reset : %s.", tests.Failed, testID, err)
+			}
+			if userID != tests.UserID {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the user of the reset token : %s.", tests.Failed, testID, userID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to use the reset token after a failed reset.", tests.Success, testID)
+
+			if err := tk.UseReset(ctx, traceID, reset, now, use); err != token.ErrResetUsed {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to use the reset token twice : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to use the reset token twice.", tests.Success, testID)
+
+			if err := tk.UseReset(ctx, traceID, other, now, use); err != token.ErrResetUsed {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to use another reset token of the user : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to use another reset token of the user.", tests.Success, testID)
+
+			if err := tk.UseReset(ctx, traceID, "bogus", now, use); err != token.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to use an unknown reset token : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to use an unknown reset token.", tests.Success, testID)
+		}
+
+		testID = 3
+		t.Logf("\tTest %d:\tWhen logging out every session with a password reset.", testID)
+		{
+			ctx := tests.Context()
+			now := time.Now()
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			if _, err := tk.Create(ctx, traceID, tests.UserID, "jti-9", now.Add(time.Hour), now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a refresh token : %s.", tests.Failed, testID, err)
+			}
+			reset, err := tk.CreateReset(ctx, traceID, tests.UserID, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a reset token : %s.", tests.Failed, testID, err)
+			}
+
+			failed := errors.New("reset failed")
+			revoke := func(tx *sqlx.Tx, id string) error {
+				return tk.RevokeUserTx(ctx, tx, traceID, id, now)
+			}
+
+			if err := tk.UseReset(ctx, traceID, reset, now, func(tx *sqlx.Tx, id string) error {
+				if err := revoke(tx, id); err != nil {
+					return err
+				}
+				return failed
+			}); err != failed {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the error of a failed reset : %v.", tests.Failed, testID, err)
+			}
+			denied, err := tk.Denied(ctx, "jti-9")
+			if err != nil || denied {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the sessions after a failed reset : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould keep the sessions after a failed reset.", tests.Success, testID)
+
+			if err := tk.UseReset(ctx, traceID, reset, now, revoke); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to use the reset token : %s.", tests.Failed, testID, err)
+			}
+			denied, err = tk.Denied(ctx, "jti-9")
+			if err != nil || !denied {
+				t.Fatalf("\t%s\tTest %d:\tShould revoke the sessions with the reset : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould revoke the sessions with the reset.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package user
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dapperauteur/go-base-service/foundation/database"
+	"github.com/google/go-cmp/cmp"
+	"github.com/lib/pq"
+)
+
+// Success and failure markers. The business tests package can't be used
+// from inside the user package since it imports it.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestQueryFilterApply(t *testing.T) {
+	created := time.Date(2019, time.March, 24, 0, 0, 0, 0, time.UTC)
+
+	tt := []struct {
+		name   string
+		filter QueryFilter
+		where  string
+		args   []interface{}
+	}{
+		{
+			"empty",
+			QueryFilter{},
+			"WHERE (deleted_at IS NULL)",
+			nil,
+		},
+		{
+			"every field",
+			QueryFilter{
+				Roles:         []string{"ADMIN"},
+				Name:          "Ann",
+				Email:         "ann@",
+				Search:        "50%_off",
+				CreatedAfter:  created,
+				CreatedBefore: created.Add(time.Hour),
+				UpdatedAfter:  created,
+				UpdatedBefore: created.Add(time.Hour),
+			},
+			"WHERE (deleted_at IS NULL) AND (roles @> $1) AND (name ILIKE $2) AND (email ILIKE $3) AND " +
+				"(name ILIKE $4 OR email ILIKE $5) AND (date_created >= $6) AND (date_created < $7) AND " +
+				"(date_updated >= $8) AND (date_updated < $9)",
+			[]interface{}{
+				pq.StringArray{"ADMIN"}, "Ann%", "ann@%", `%50\%\_off%`, `%50\%\_off%`,
+				created, created.Add(time.Hour), created, created.Add(time.Hour),
+			},
+		},
+		{
+			"deleted",
+			QueryFilter{Roles: []string{"EDITOR"}, IncludeDeleted: true},
+			"WHERE (roles @> $1)",
+			[]interface{}{pq.StringArray{"EDITOR"}},
+		},
+	}
+
+	t.Log("Given the need to turn a QueryFilter into SQL.")
+	{
+		for testID, tst := range tt {
+			t.Logf("\tTest %d:\tWhen applying the %s filter.", testID, tst.name)
+			{
+				var b database.Builder
+				tst.filter.apply(&b)
+
+				if got := b.WhereClause(); got != tst.where {
+					t.Fatalf("\t%s\tTest %d:\tShould get the expected clause : got %q, exp %q.", failed, testID, got, tst.where)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get the expected clause.", success, testID)
+
+				if diff := cmp.Diff(tst.args, b.Args()); diff != "" {
+					t.Fatalf("\t%s\tTest %d:\tShould get the escaped arguments. Diff:\n%s", failed, testID, diff)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get the escaped arguments.", success, testID)
+			}
+		}
+	}
+}
@@ -0,0 +1,379 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dapperauteur/go-base-service/foundation/database"
+	"github.com/pkg/errors"
+)
+
+// memoryStore keeps users in a map. It follows the behavior of the Postgres
+// store: emails are unique, missing and deleted users return ErrNotFound and
+// results are filtered and ordered the same way. It exists so tests can run
+// without a database.
+type memoryStore struct {
+	mu    sync.RWMutex
+	users map[string]Info
+}
+
+// NewMemoryStore constructs an empty Store held in memory.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		users: make(map[string]Info),
+	}
+}
+
+// Create adds a new user to the store.
+func (s *memoryStore) Create(ctx context.Context, traceID string, usr Info) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.users[usr.ID]; exists {
+		return errors.Errorf("inserting user: duplicate id %s", usr.ID)
+	}
+	if s.emailTaken(usr.Email, usr.ID) {
+		return ErrUniqueEmail
+	}
+
+	s.users[usr.ID] = clone(usr)
+	return nil
+}
+
+// Update replaces a user in the store as long as its version has not changed
+// since it was read. Like the Postgres store, a missing user is reported as a
+// conflict.
+func (s *memoryStore) Update(ctx context.Context, traceID string, usr Info) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved, exists := s.users[usr.ID]
+	if !exists || saved.DeletedAt != nil || saved.Version != usr.Version {
+		return ErrVersionConflict
+	}
+	if s.emailTaken(usr.Email, usr.ID) {
+		return ErrUniqueEmail
+	}
+
+	saved.Name = usr.Name
+	saved.Email = usr.Email
+	saved.Roles = usr.Roles
+	saved.PasswordHash = usr.PasswordHash
+	saved.DateUpdated = usr.DateUpdated
+	saved.DateVerified = usr.DateVerified
+	saved.Version++
+
+	s.users[usr.ID] = clone(saved)
+	return nil
+}
+
+// Delete marks a user as deleted. Deleting a user that is missing or
+// already deleted does nothing.
+func (s *memoryStore) Delete(ctx context.Context, traceID string, userID string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usr, exists := s.users[userID]
+	if !exists || usr.DeletedAt != nil {
+		return nil
+	}
+
+	usr.DeletedAt = &now
+	usr.Version++
+	s.users[userID] = usr
+	return nil
+}
+
+// Restore clears the deletion mark of a user.
+func (s *memoryStore) Restore(ctx context.Context, traceID string, userID string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usr, exists := s.users[userID]
+	if !exists || usr.DeletedAt == nil {
+		return ErrNotFound
+	}
+
+	usr.DeletedAt = nil
+	usr.DateUpdated = now
+	usr.Version++
+	s.users[userID] = usr
+	return nil
+}
+
+// Purge removes a deleted user from the store.
+func (s *memoryStore) Purge(ctx context.Context, traceID string, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usr, exists := s.users[userID]
+	if !exists || usr.DeletedAt == nil {
+		return ErrNotFound
+	}
+
+	delete(s.users, userID)
+	return nil
+}
+
+// QueryDeleted retrieves the users deleted before the specified time.
+func (s *memoryStore) QueryDeleted(ctx context.Context, traceID string, before time.Time) ([]Info, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := []Info{}
+	for _, usr := range s.users {
+		if usr.DeletedAt != nil && usr.DeletedAt.Before(before) {
+			users = append(users, clone(usr))
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if c := compareTime(*users[i].DeletedAt, *users[j].DeletedAt); c != 0 {
+			return c < 0
+		}
+		return users[i].ID < users[j].ID
+	})
+
+	return users, nil
+}
+
+// Query retrieves a page of users matching the filter sorted by orderBy.
+func (s *memoryStore) Query(ctx context.Context, traceID string, filter QueryFilter, orderBy database.OrderBy, offset int, limit int) ([]Info, error) {
+	if offset < 0 || limit < 0 {
+		return nil, errors.New("selecting users: offset and limit must not be negative")
+	}
+
+	less, err := lessFunc(orderBy)
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting users")
+	}
+
+	users := s.match(filter)
+	sort.Slice(users, func(i, j int) bool {
+		return less(users[i], users[j])
+	})
+
+	return window(users, offset, limit), nil
+}
+
+// QueryAfter retrieves up to limit users matching the filter that sort after
+// the (created, userID) key, ordered by date_created and then user_id. An
+// empty userID starts from the first user.
+func (s *memoryStore) QueryAfter(ctx context.Context, traceID string, filter QueryFilter, created time.Time, userID string, limit int) ([]Info, error) {
+	if limit < 0 {
+		return nil, errors.New("selecting users: limit must not be negative")
+	}
+
+	after := func(usr Info) bool {
+		if usr.DateCreated.Equal(created) {
+			return usr.ID > userID
+		}
+		return usr.DateCreated.After(created)
+	}
+
+	users := []Info{}
+	for _, usr := range s.match(filter) {
+		if userID == "" || after(usr) {
+			users = append(users, usr)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return byCreated(users[i], users[j])
+	})
+
+	return window(users, 0, limit), nil
+}
+
+// Count returns the number of users matching the filter.
+func (s *memoryStore) Count(ctx context.Context, traceID string, filter QueryFilter) (int, error) {
+	return len(s.match(filter)), nil
+}
+
+// LockRole returns the number of users holding the role. The store has no
+// transactions so nothing is locked.
+func (s *memoryStore) LockRole(ctx context.Context, traceID string, name string) (int, error) {
+	return len(s.match(QueryFilter{Roles: []string{name}})), nil
+}
+
+// QueryByID gets the specified user from the store.
+func (s *memoryStore) QueryByID(ctx context.Context, traceID string, userID string) (Info, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	usr, exists := s.users[userID]
+	if !exists || usr.DeletedAt != nil {
+		return Info{}, ErrNotFound
+	}
+
+	return clone(usr), nil
+}
+
+// QueryByEmail gets the specified user from the store by email.
+func (s *memoryStore) QueryByEmail(ctx context.Context, traceID string, email string) (Info, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, usr := range s.users {
+		if usr.Email == email && usr.DeletedAt == nil {
+			return clone(usr), nil
+		}
+	}
+
+	return Info{}, ErrNotFound
+}
+
+// emailTaken reports whether a user other than userID already has the email.
+// The caller must hold the lock.
+func (s *memoryStore) emailTaken(email string, userID string) bool {
+	for _, usr := range s.users {
+		if usr.Email == email && usr.ID != userID {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns a copy of every user matching the filter in no particular
+// order.
+func (s *memoryStore) match(filter QueryFilter) []Info {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := []Info{}
+	for _, usr := range s.users {
+		if filter.match(usr) {
+			users = append(users, clone(usr))
+		}
+	}
+	return users
+}
+
+// match applies the same predicates as apply does to a SQL query.
+func (f QueryFilter) match(usr Info) bool {
+	if usr.DeletedAt != nil && !f.IncludeDeleted {
+		return false
+	}
+	for _, role := range f.Roles {
+		if !contains(usr.Roles, role) {
+			return false
+		}
+	}
+	if f.Name != "" && !hasPrefixFold(usr.Name, f.Name) {
+		return false
+	}
+	if f.Email != "" && !hasPrefixFold(usr.Email, f.Email) {
+		return false
+	}
+	if f.Search != "" {
+		search := strings.ToLower(f.Search)
+		if !strings.Contains(strings.ToLower(usr.Name), search) && !strings.Contains(strings.ToLower(usr.Email), search) {
+			return false
+		}
+	}
+	if !f.CreatedAfter.IsZero() && usr.DateCreated.Before(f.CreatedAfter) {
+		return false
+	}
+	if !f.CreatedBefore.IsZero() && !usr.DateCreated.Before(f.CreatedBefore) {
+		return false
+	}
+	if !f.UpdatedAfter.IsZero() && usr.DateUpdated.Before(f.UpdatedAfter) {
+		return false
+	}
+	if !f.UpdatedBefore.IsZero() && !usr.DateUpdated.Before(f.UpdatedBefore) {
+		return false
+	}
+	return true
+}
+
+// lessFunc returns the comparison for an order by one of the OrderByFields
+// columns. Ties are broken on user_id ascending like the SQL query.
+func lessFunc(orderBy database.OrderBy) (func(a, b Info) bool, error) {
+	var cmp func(a, b Info) int
+	switch orderBy.Field {
+	case "user_id":
+		cmp = func(a, b Info) int { return strings.Compare(a.ID, b.ID) }
+	case "name":
+		cmp = func(a, b Info) int { return strings.Compare(a.Name, b.Name) }
+	case "email":
+		cmp = func(a, b Info) int { return strings.Compare(a.Email, b.Email) }
+	case "date_created":
+		cmp = func(a, b Info) int { return compareTime(a.DateCreated, b.DateCreated) }
+	case "date_updated":
+		cmp = func(a, b Info) int { return compareTime(a.DateUpdated, b.DateUpdated) }
+	default:
+		return nil, fmt.Errorf("unknown order field %q", orderBy.Field)
+	}
+
+	less := func(a, b Info) bool {
+		c := cmp(a, b)
+		if orderBy.Direction == database.DESC {
+			c = -c
+		}
+		if c != 0 {
+			return c < 0
+		}
+		return a.ID < b.ID
+	}
+	return less, nil
+}
+
+// byCreated orders users by date_created and then user_id.
+func byCreated(a, b Info) bool {
+	if c := compareTime(a.DateCreated, b.DateCreated); c != 0 {
+		return c < 0
+	}
+	return a.ID < b.ID
+}
+
+func compareTime(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+// window returns the users in [offset, offset+limit).
+func window(users []Info, offset int, limit int) []Info {
+	if offset > len(users) {
+		offset = len(users)
+	}
+	end := offset + limit
+	if end > len(users) {
+		end = len(users)
+	}
+	return users[offset:end]
+}
+
+// clone copies a user so callers cannot modify what the store holds.
+func clone(usr Info) Info {
+	usr.Roles = append(usr.Roles[:0:0], usr.Roles...)
+	usr.PasswordHash = append(usr.PasswordHash[:0:0], usr.PasswordHash...)
+	if usr.DeletedAt != nil {
+		deletedAt := *usr.DeletedAt
+		usr.DeletedAt = &deletedAt
+	}
+	if usr.DateVerified != nil {
+		dateVerified := *usr.DateVerified
+		usr.DateVerified = &dateVerified
+	}
+	return usr
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return strings.HasPrefix(strings.ToLower(s), strings.ToLower(prefix))
+}
@@ -3,6 +3,7 @@ package user
 import (
 	"time"
 
+	"github.com/dapperauteur/go-base-service/foundation/database"
 	"github.com/lib/pq"
 )
 
@@ -13,8 +14,11 @@ type Info struct {
 	Email        string         `db:"email" json:"email"`
 	Roles        pq.StringArray `db:"roles" json:"roles"`
 	PasswordHash []byte         `db:"password_hash" json:"-"`
+	Version      int            `db:"version" json:"version"`
 	DateCreated  time.Time      `db:"date_created" json:"date_created"`
 	DateUpdated  time.Time      `db:"date_updated" json:"date_updated"`
+	DeletedAt    *time.Time     `db:"deleted_at" json:"deleted_at,omitempty"`
+	DateVerified *time.Time     `db:"date_verified" json:"date_verified,omitempty"`
 }
 
 // NewUser contains information needed to create a new User.
@@ -26,16 +30,97 @@ type NewUser struct {
 	PasswordConfirm string   `json:"password_confirm" validate:"eqfield=Password"`
 }
 
+// NewSignup contains information needed for someone to sign themselves up.
+// The user is given the USER role and must verify their email before they
+// can authenticate.
+type NewSignup struct {
+	Name            string `json:"name" validate:"required"`
+	Email           string `json:"email" validate:"required,email"`
+	Password        string `json:"password" validate:"required"`
+	PasswordConfirm string `json:"password_confirm" validate:"eqfield=Password"`
+}
+
 // UpdateUser defines what information may be provided to modify an existing User.
 // All fields are optional so clients can send just the fields they want changed.
 // It uses pointer fields so we can differentiate between a field that
 // was not provided and a field that was provided as explicitly blank.
 // Normally we do not want to use pointers to basic types but we make exceptions around
 // marshalling/unmarshalling.
+//
+// Users who are not admins must send their CurrentPassword along with a new
+// Password or Email.
 type UpdateUser struct {
 	Name            *string  `json:"name"`
 	Email           *string  `json:"email" validate:"omitempty,email"`
 	Roles           []string `json:"roles"`
 	Password        *string  `json:"password"`
 	PasswordConfirm *string  `json:"password_confirm" validate:"omitempty,eqfield=Password"`
+	CurrentPassword *string  `json:"current_password"`
+}
+
+// UpdateProfile defines what users may change about themselves. It is
+// applied as an UpdateUser, so users who are not admins must send their
+// CurrentPassword along with a new Email.
+type UpdateProfile struct {
+	Name            *string `json:"name"`
+	Email           *string `json:"email" validate:"omitempty,email"`
+	CurrentPassword *string `json:"current_password"`
+}
+
+// ChangePassword contains information needed for users to change their own
+// password.
+type ChangePassword struct {
+	OldPassword     string `json:"old_password" validate:"required"`
+	Password        string `json:"password" validate:"required"`
+	PasswordConfirm string `json:"password_confirm" validate:"eqfield=Password"`
+}
+
+// ForgotPassword contains the email of a user asking for a password reset.
+type ForgotPassword struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ResetPassword contains information needed for users to set a new password
+// with the token they were sent after forgetting theirs.
+type ResetPassword struct {
+	Token           string `json:"token" validate:"required"`
+	Password        string `json:"password" validate:"required"`
+	PasswordConfirm string `json:"password_confirm" validate:"eqfield=Password"`
+}
+
+// Page is a single page of users returned by keyset pagination. NextCursor
+// is empty when there are no more users to fetch.
+type Page struct {
+	Items      []Info `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Total      int    `json:"total"`
 }
+
+// QueryFilter holds the available fields a users query can be filtered on.
+// Zero value fields are not applied to the query. Deleted users are left out
+// unless IncludeDeleted is set.
+type QueryFilter struct {
+	Roles         []string
+	Name          string
+	Email         string
+	Search        string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+
+	IncludeDeleted bool
+}
+
+// OrderByFields is the whitelist of fields users can be sorted by, mapped to
+// the column used in the query.
+var OrderByFields = map[string]string{
+	"id":           "user_id",
+	"name":         "name",
+	"email":        "email",
+	"date_created": "date_created",
+	"date_updated": "date_updated",
+}
+
+// DefaultOrderBy is the sort applied when none is requested.
+var DefaultOrderBy = database.OrderBy{Field: "user_id", Direction: database.ASC}
@@ -0,0 +1,415 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/dapperauteur/go-base-service/foundation/database"
+	"github.com/dapperauteur/go-base-service/foundation/logger"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// uniqueViolation is the Postgres error code for a unique constraint failure.
+const uniqueViolation = "23505"
+
+// postgresStore keeps users in the users table.
+type postgresStore struct {
+	log *logger.Logger
+	db  database.Executor
+}
+
+// NewPostgresStore constructs a Store backed by Postgres. The db can be a
+// *sqlx.DB or a *sqlx.Tx.
+func NewPostgresStore(log *logger.Logger, db database.Executor) Store {
+	return postgresStore{
+		log: log,
+		db:  db,
+	}
+}
+
+// Create inserts a new user into the database.
+func (s postgresStore) Create(ctx context.Context, traceID string, usr Info) error {
+	const q = `
+	INSERT INTO users
+		(user_id, name, email, password_hash, roles, version, date_created, date_updated, date_verified)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	s.log.Debug(ctx, "query", "trace_id", traceID, "op", "user.Create", "query",
+		database.Log(q, usr.ID, usr.Name, usr.Email, usr.PasswordHash, usr.Roles, usr.Version, usr.DateCreated, usr.DateUpdated, usr.DateVerified),
+	)
+
+	if _, err := s.db.ExecContext(ctx, q, usr.ID, usr.Name, usr.Email, usr.PasswordHash, usr.Roles, usr.Version, usr.DateCreated, usr.DateUpdated, usr.DateVerified); err != nil {
+		if isUniqueViolation(err) {
+			return ErrUniqueEmail
+		}
+		return errors.Wrap(err, "inserting user")
+	}
+
+	return nil
+}
+
+// Update replaces a user document in the database as long as its version
+// has not changed since it was read.
+func (s postgresStore) Update(ctx context.Context, traceID string, usr Info) error {
+	const q = `
+	UPDATE
+		users
+	SET
+		"name" = $2,
+		"email" = $3,
+		"roles" = $4,
+		"password_hash" = $5,
+		"date_updated" = $6,
+		"date_verified" = $8,
+		"version" = version + 1
+	WHERE
+		user_id = $1 AND
+		version = $7`
+
+	s.log.Debug(ctx, "query", "trace_id", traceID, "op", "user.Update", "query",
+		database.Log(q, usr.ID, usr.Name, usr.Email, usr.Roles, usr.PasswordHash, usr.DateUpdated, usr.Version, usr.DateVerified),
+	)
+
+	res, err := s.db.ExecContext(ctx, q, usr.ID, usr.Name, usr.Email, usr.Roles, usr.PasswordHash, usr.DateUpdated, usr.Version, usr.DateVerified)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrUniqueEmail
+		}
+		return errors.Wrapf(err, "updating user %s", usr.ID)
+	}
+
+	// No row means the user changed or was deleted after it was read.
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrapf(err, "updating user %s", usr.ID)
+	}
+	if n == 0 {
+		return ErrVersionConflict
+	}
+
+	return nil
+}
+
+// Delete marks a user as deleted. Deleting a user that is missing or
+// already deleted does nothing.
+func (s postgresStore) Delete(ctx context.Context, traceID string, userID string, now time.Time) error {
+	const q = `
+	UPDATE
+		users
+	SET
+		"deleted_at" = $2,
+		"version" = version + 1
+	WHERE
+		user_id = $1 AND
+		deleted_at IS NULL`
+
+	s.log.Debug(ctx, "query", "trace_id", traceID, "op", "user.Delete", "query",
+		database.Log(q, userID, now),
+	)
+
+	if _, err := s.db.ExecContext(ctx, q, userID, now); err != nil {
+		return errors.Wrapf(err, "deleting user %s", userID)
+	}
+
+	return nil
+}
+
+// Restore clears the deletion mark of a user.
+func (s postgresStore) Restore(ctx context.Context, traceID string, userID string, now time.Time) error {
+	const q = `
+	UPDATE
+		users
+	SET
+		"deleted_at" = NULL,
+		"date_updated" = $2,
+		"version" = version + 1
+	WHERE
+		user_id = $1 AND
+		deleted_at IS NOT NULL`
+
+	s.log.Debug(ctx, "query", "trace_id", traceID, "op", "user.Restore", "query",
+		database.Log(q, userID, now),
+	)
+
+	res, err := s.db.ExecContext(ctx, q, userID, now)
+	if err != nil {
+		return errors.Wrapf(err, "restoring user %s", userID)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrapf(err, "restoring user %s", userID)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Purge removes a deleted user from the database.
+func (s postgresStore) Purge(ctx context.Context, traceID string, userID string) error {
+	const q = `
+	DELETE FROM
+		users
+	WHERE
+		user_id = $1 AND
+		deleted_at IS NOT NULL`
+
+	s.log.Debug(ctx, "query", "trace_id", traceID, "op", "user.Purge", "query",
+		database.Log(q, userID),
+	)
+
+	res, err := s.db.ExecContext(ctx, q, userID)
+	if err != nil {
+		return errors.Wrapf(err, "purging user %s", userID)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrapf(err, "purging user %s", userID)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// QueryDeleted retrieves the users deleted before the specified time.
+func (s postgresStore) QueryDeleted(ctx context.Context, traceID string, before time.Time) ([]Info, error) {
+	const q = `
+	SELECT
+		*
+	FROM
+		users
+	WHERE
+		deleted_at < $1
+	ORDER BY
+		deleted_at, user_id`
+
+	s.log.Debug(ctx, "query", "trace_id", traceID, "op", "user.QueryDeleted", "query",
+		database.Log(q, before),
+	)
+
+	users := []Info{}
+	if err := s.db.SelectContext(ctx, &users, q, before); err != nil {
+		return nil, errors.Wrap(err, "selecting deleted users")
+	}
+
+	return users, nil
+}
+
+// Query retrieves a page of users matching the filter sorted by orderBy.
+func (s postgresStore) Query(ctx context.Context, traceID string, filter QueryFilter, orderBy database.OrderBy, offset int, limit int) ([]Info, error) {
+	var b database.Builder
+	filter.apply(&b)
+
+	// Always break ties on the primary key so pages are stable.
+	b.OrderBy(orderBy)
+	if orderBy.Field != "user_id" {
+		b.OrderBy(database.OrderBy{Field: "user_id", Direction: database.ASC})
+	}
+
+	q := `
+	SELECT
+		*
+	FROM
+		users
+	` + b.WhereClause() + `
+	` + b.OrderByClause() + `
+	OFFSET ` + b.Arg(offset) + `
+	ROWS FETCH NEXT ` + b.Arg(limit) + ` ROWS ONLY`
+
+	s.log.Debug(ctx, "query", "trace_id", traceID, "op", "user.Query", "query",
+		database.Log(q, b.Args()...),
+	)
+
+	users := []Info{}
+	if err := s.db.SelectContext(ctx, &users, q, b.Args()...); err != nil {
+		return nil, errors.Wrap(err, "selecting users")
+	}
+
+	return users, nil
+}
+
+// QueryAfter retrieves up to limit users matching the filter that sort after
+// the (created, userID) key, ordered by date_created and then user_id. An
+// empty userID starts from the first user.
+func (s postgresStore) QueryAfter(ctx context.Context, traceID string, filter QueryFilter, created time.Time, userID string, limit int) ([]Info, error) {
+	var b database.Builder
+	filter.apply(&b)
+
+	if userID != "" {
+		b.Where("(date_created, user_id) > (?, ?)", created, userID)
+	}
+	b.OrderBy(database.OrderBy{Field: "date_created", Direction: database.ASC})
+	b.OrderBy(database.OrderBy{Field: "user_id", Direction: database.ASC})
+
+	q := `
+	SELECT
+		*
+	FROM
+		users
+	` + b.WhereClause() + `
+	` + b.OrderByClause() + `
+	FETCH FIRST ` + b.Arg(limit) + ` ROWS ONLY`
+
+	s.log.Debug(ctx, "query", "trace_id", traceID, "op", "user.QueryAfter", "query",
+		database.Log(q, b.Args()...),
+	)
+
+	users := []Info{}
+	if err := s.db.SelectContext(ctx, &users, q, b.Args()...); err != nil {
+		return nil, errors.Wrap(err, "selecting users")
+	}
+
+	return users, nil
+}
+
+// Count returns the number of users matching the filter.
+func (s postgresStore) Count(ctx context.Context, traceID string, filter QueryFilter) (int, error) {
+	var b database.Builder
+	filter.apply(&b)
+
+	q := `
+	SELECT
+		count(*)
+	FROM
+		users
+	` + b.WhereClause()
+
+	s.log.Debug(ctx, "query", "trace_id", traceID, "op", "user.Count", "query",
+		database.Log(q, b.Args()...),
+	)
+
+	var total int
+	if err := s.db.GetContext(ctx, &total, q, b.Args()...); err != nil {
+		return 0, errors.Wrap(err, "counting users")
+	}
+
+	return total, nil
+}
+
+// LockRole locks the rows of the users holding the role, in a fixed order
+// to avoid deadlocks, and returns how many there are. The locks are released
+// when the transaction ends, right away when s.db is not a transaction.
+func (s postgresStore) LockRole(ctx context.Context, traceID string, name string) (int, error) {
+	const q = `
+	SELECT
+		user_id
+	FROM
+		users
+	WHERE
+		deleted_at IS NULL AND roles @> $1
+	ORDER BY
+		user_id
+	FOR UPDATE`
+
+	roles := pq.StringArray{name}
+
+	s.log.Debug(ctx, "query", "trace_id", traceID, "op", "user.LockRole", "query",
+		database.Log(q, roles),
+	)
+
+	var ids []string
+	if err := s.db.SelectContext(ctx, &ids, q, roles); err != nil {
+		return 0, errors.Wrap(err, "locking users")
+	}
+
+	return len(ids), nil
+}
+
+// QueryByID gets the specified user from the database.
+func (s postgresStore) QueryByID(ctx context.Context, traceID string, userID string) (Info, error) {
+	const q = `
+	SELECT
+		*
+	FROM
+		users
+	WHERE
+		user_id = $1 AND
+		deleted_at IS NULL`
+
+	s.log.Debug(ctx, "query", "trace_id", traceID, "op", "user.QueryByID", "query",
+		database.Log(q, userID),
+	)
+
+	var usr Info
+	if err := s.db.GetContext(ctx, &usr, q, userID); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "selecting user %q", userID)
+	}
+
+	return usr, nil
+}
+
+// QueryByEmail gets the specified user from the database by email.
+func (s postgresStore) QueryByEmail(ctx context.Context, traceID string, email string) (Info, error) {
+	const q = `
+	SELECT
+		*
+	FROM
+		users
+	WHERE
+		email = $1 AND
+		deleted_at IS NULL`
+
+	s.log.Debug(ctx, "query", "trace_id", traceID, "op", "user.QueryByEmail", "query",
+		database.Log(q, email),
+	)
+
+	var usr Info
+	if err := s.db.GetContext(ctx, &usr, q, email); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "selecting user %q", email)
+	}
+
+	return usr, nil
+}
+
+// apply adds the predicates for every field set in the filter. Deleted users
+// are always left out.
+func (f QueryFilter) apply(b *database.Builder) {
+	if !f.IncludeDeleted {
+		b.Where("deleted_at IS NULL")
+	}
+	if len(f.Roles) > 0 {
+		b.Where("roles @> ?", pq.StringArray(f.Roles))
+	}
+	if f.Name != "" {
+		b.Where("name ILIKE ?", database.EscapeLike(f.Name)+"%")
+	}
+	if f.Email != "" {
+		b.Where("email ILIKE ?", database.EscapeLike(f.Email)+"%")
+	}
+	if f.Search != "" {
+		pattern := "%" + database.EscapeLike(f.Search) + "%"
+		b.Where("name ILIKE ? OR email ILIKE ?", pattern, pattern)
+	}
+	if !f.CreatedAfter.IsZero() {
+		b.Where("date_created >= ?", f.CreatedAfter.UTC())
+	}
+	if !f.CreatedBefore.IsZero() {
+		b.Where("date_created < ?", f.CreatedBefore.UTC())
+	}
+	if !f.UpdatedAfter.IsZero() {
+		b.Where("date_updated >= ?", f.UpdatedAfter.UTC())
+	}
+	if !f.UpdatedBefore.IsZero() {
+		b.Where("date_updated < ?", f.UpdatedBefore.UTC())
+	}
+}
+
+// isUniqueViolation reports whether err was caused by a unique constraint.
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == uniqueViolation
+}
@@ -3,17 +3,17 @@ package user
 
 import (
 	"context"
-	"database/sql"
-	"log"
 	"time"
 
 	"github.com/dapperauteur/go-base-service/business/auth"
+	"github.com/dapperauteur/go-base-service/business/data/audit"
+	"github.com/dapperauteur/go-base-service/business/data/role"
 	"github.com/dapperauteur/go-base-service/foundation/database"
+	"github.com/dapperauteur/go-base-service/foundation/logger"
 	"go.opentelemetry.io/otel/trace"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/google/uuid"
-	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -24,79 +24,231 @@ var (
 	ErrInvalidID             = errors.New("ID is not in its proper form")
 	ErrAuthenticationFailure = errors.New("authentication failed")
 	ErrForbidden             = errors.New("attempted action is not allowed")
+	ErrInvalidCursor         = errors.New("cursor is not in its proper form")
+	ErrUniqueEmail           = errors.New("email is already in use")
+	ErrVersionConflict       = errors.New("user was modified by another request")
+	ErrUnknownRole           = errors.New("role does not exist")
+	ErrNotVerified           = errors.New("email has not been verified")
 )
 
+// Set of reasons an update is forbidden. Each one wraps ErrForbidden so
+// errors.Cause(err) == ErrForbidden holds for all of them.
+var (
+	ErrRolesAdminOnly  = errors.Wrap(ErrForbidden, "changing roles requires the roles:write permission")
+	ErrCurrentPassword = errors.Wrap(ErrForbidden, "the current password is required to change the password or email")
+	ErrLastAdmin       = errors.Wrap(ErrForbidden, "the last admin can't be removed")
+)
+
+// Store declares the storage behavior User relies on. Implementations
+// return ErrNotFound for a missing user and ErrUniqueEmail when an email is
+// already taken, and must filter and order results the way the Postgres
+// store does. Update only writes when the stored version still matches the
+// version of the user passed in, bumping it by one, and returns
+// ErrVersionConflict otherwise.
+//
+// Deleted users are only marked with the time of deletion. Every query
+// except QueryDeleted leaves them out, but they keep their email until they
+// are purged.
+//
+// LockRole counts the users holding a role and keeps them from being changed
+// by anyone else until the transaction the store runs in ends.
+type Store interface {
+	Create(ctx context.Context, traceID string, usr Info) error
+	Update(ctx context.Context, traceID string, usr Info) error
+	Delete(ctx context.Context, traceID string, userID string, now time.Time) error
+	Restore(ctx context.Context, traceID string, userID string, now time.Time) error
+	Purge(ctx context.Context, traceID string, userID string) error
+	QueryDeleted(ctx context.Context, traceID string, before time.Time) ([]Info, error)
+	Query(ctx context.Context, traceID string, filter QueryFilter, orderBy database.OrderBy, offset int, limit int) ([]Info, error)
+	QueryAfter(ctx context.Context, traceID string, filter QueryFilter, created time.Time, userID string, limit int) ([]Info, error)
+	Count(ctx context.Context, traceID string, filter QueryFilter) (int, error)
+	LockRole(ctx context.Context, traceID string, name string) (int, error)
+	QueryByID(ctx context.Context, traceID string, userID string) (Info, error)
+	QueryByEmail(ctx context.Context, traceID string, email string) (Info, error)
+}
+
+// entity names users in the audit log.
+const entity = "user"
+
+// AccessTTL is how long the access tokens issued for a user are valid.
+const AccessTTL = time.Hour
+
 // User manages the set of API's for user access.
 type User struct {
-	log *log.Logger
-	db  *sqlx.DB
+	log   *logger.Logger
+	store Store
+	audit audit.Audit
+	roles role.Role
+}
+
+// New constructs a user for api access backed by Postgres. The db can be a
+// *sqlx.DB or a *sqlx.Tx so user writes can take part in a larger
+// transaction. Changes are recorded in the audit log and roles are looked
+// up through the same db.
+func New(log *logger.Logger, db database.Executor) User {
+	return NewWithStore(log, NewPostgresStore(log, db), audit.NewPostgresStore(log, db), role.NewPostgresStore(log, db))
 }
 
-// New constructs a user for api access.
-func New(log *log.Logger, db *sqlx.DB) User {
+// NewWithStore constructs a user for api access backed by the provided
+// stores. Every change is recorded in events and the roles of a user must
+// exist in roles.
+func NewWithStore(log *logger.Logger, store Store, events audit.Store, roles role.Store) User {
 	return User{
-		log: log,
-		db:  db,
+		log:   log,
+		store: store,
+		audit: audit.NewWithStore(log, events),
+		roles: role.NewWithStore(log, roles, events),
 	}
 }
 
-// Create inserts a new user into the database.
-func (u User) Create(ctx context.Context, traceID string, nu NewUser, now time.Time) (Info, error) {
+// Create inserts a new user into the database. Users created this way are
+// trusted to own their email, so they are verified from the start. Only
+// callers granted roles:write may give the user any role but USER.
+func (u User) Create(ctx context.Context, traceID string, claims auth.Claims, nu NewUser, now time.Time) (Info, error) {
 
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.create")
 	defer span.End()
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(nu.Password), bcrypt.DefaultCost)
+	if !claims.HasPermission(auth.PermRolesWrite) {
+		for _, name := range nu.Roles {
+			if name != auth.RoleUser {
+				return Info{}, ErrRolesAdminOnly
+			}
+		}
+	}
+
+	if _, err := u.permissions(ctx, traceID, nu.Roles); err != nil {
+		return Info{}, err
+	}
+
+	usr, err := newInfo(nu, now)
 	if err != nil {
-		return Info{}, errors.Wrap(err, "generating password hash")
+		return Info{}, err
 	}
+	verified := usr.DateCreated
+	usr.DateVerified = &verified
 
-	usr := Info{
-		ID:           uuid.New().String(),
-		Name:         nu.Name,
-		Email:        nu.Email,
-		PasswordHash: hash,
-		Roles:        nu.Roles,
-		DateCreated:  now.UTC(),
-		DateUpdated:  now.UTC(),
+	if err := u.insert(ctx, traceID, claims.Subject, usr, now); err != nil {
+		return Info{}, err
+	}
+
+	return usr, nil
+}
+
+// Signup inserts a new user who signed themselves up. The user gets the
+// USER role and can't authenticate until their email is verified. When the
+// email already belongs to a user nothing is changed and that user is
+// returned, so the caller can mail them either way without telling whoever
+// signed up that the account exists.
+func (u User) Signup(ctx context.Context, traceID string, ns NewSignup, now time.Time) (Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.signup")
+	defer span.End()
+
+	nu := NewUser{
+		Name:            ns.Name,
+		Email:           ns.Email,
+		Roles:           []string{auth.RoleUser},
+		Password:        ns.Password,
+		PasswordConfirm: ns.PasswordConfirm,
 	}
 
-	const q = `
-	INSERT INTO users
-		(user_id, name, email, password_hash, roles, date_created, date_updated)
-	VALUES
-		($1, $2, $3, $4, $5, $6, $7)`
+	// The password is hashed even for a known email so both take as long.
+	usr, err := newInfo(nu, now)
+	if err != nil {
+		return Info{}, err
+	}
 
-	u.log.Printf("%s : %s : QUERY : %s", traceID, "user.Create",
-		database.Log(q, usr.ID, usr.Name, usr.Email, usr.PasswordHash, usr.Roles, usr.DateCreated, usr.DateUpdated),
-	)
+	existing, err := u.store.QueryByEmail(ctx, traceID, usr.Email)
+	switch err {
+	case nil:
+		return existing, nil
+	case ErrNotFound:
+	default:
+		return Info{}, err
+	}
 
-	if _, err := u.db.ExecContext(ctx, q, usr.ID, usr.Name, usr.Email, usr.PasswordHash, usr.Roles, usr.DateCreated, usr.DateUpdated); err != nil {
-		return Info{}, errors.Wrap(err, "inserting user")
+	if err := u.insert(ctx, traceID, usr.ID, usr, now); err != nil {
+		return Info{}, err
 	}
 
 	return usr, nil
 }
 
-// Update replaces a user document in the database.
-func (u User) Update(ctx context.Context, traceID string, claims auth.Claims, userID string, uu UpdateUser, now time.Time) error {
+// Verify marks the email of a user as verified so they can authenticate.
+// Verifying a user twice does nothing.
+func (u User) Verify(ctx context.Context, traceID string, userID string, now time.Time) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.verify")
+	defer span.End()
+
+	if _, err := uuid.Parse(userID); err != nil {
+		return ErrInvalidID
+	}
+
+	usr, err := u.store.QueryByID(ctx, traceID, userID)
+	if err != nil {
+		return err
+	}
+	if usr.DateVerified != nil {
+		return nil
+	}
+
+	before := usr
+	now = now.UTC()
+	usr.DateVerified = &now
+	usr.DateUpdated = now
+
+	if err := u.store.Update(ctx, traceID, usr); err != nil {
+		return err
+	}
+
+	after := usr
+	after.Version++
+
+	return u.record(ctx, traceID, userID, audit.ActionVerify, userID, before, after, now)
+}
+
+// Update replaces a user document in the database. The version is the one
+// the caller last read and the update fails with ErrVersionConflict when the
+// user has changed since. A zero version skips that check, but the write is
+// still rejected if the user changes while this update is in progress.
+//
+// Only callers granted roles:write can change roles, and never in a way that
+// leaves no admin. Callers without users:write have to confirm their current
+// password to change their password or email.
+//
+// A new email is unverified, so the user can't authenticate again until they
+// verify it.
+func (u User) Update(ctx context.Context, traceID string, claims auth.Claims, userID string, uu UpdateUser, version int, now time.Time) error {
 
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.update")
 	defer span.End()
 
 	usr, err := u.QueryByID(ctx, traceID, claims, userID)
 	if err != nil {
-		// return errors.Wrap(err, "updating user")
 		return err
 	}
 
+	if version != 0 && version != usr.Version {
+		return ErrVersionConflict
+	}
+	if err := u.authorizeUpdate(ctx, traceID, claims, usr, uu); err != nil {
+		return err
+	}
+	before := usr
+
 	if uu.Name != nil {
 		usr.Name = *uu.Name
 	}
-	if uu.Email != nil {
+	if uu.Email != nil && *uu.Email != usr.Email {
 		usr.Email = *uu.Email
+		usr.DateVerified = nil
 	}
 	if uu.Roles != nil {
+		if _, err := u.permissions(ctx, traceID, uu.Roles); err != nil {
+			return err
+		}
 		usr.Roles = uu.Roles
 	}
 	if uu.Password != nil {
@@ -108,31 +260,80 @@ func (u User) Update(ctx context.Context, traceID string, claims auth.Claims, us
 	}
 	usr.DateUpdated = now
 
-	const q = `
-	UPDATE
-		users
-	SET 
-		"name" = $2,
-		"email" = $3,
-		"roles" = $4,
-		"password_hash" = $5,
-		"date_updated" = $6
-	WHERE
-		user_id = $1`
+	if err := u.store.Update(ctx, traceID, usr); err != nil {
+		return err
+	}
+
+	after := usr
+	after.Version++
+
+	return u.record(ctx, traceID, claims.Subject, audit.ActionUpdate, usr.ID, before, after, now)
+}
+
+// ChangePassword sets a new password for the subject of the claims. The old
+// password is required even from admins and ErrCurrentPassword is returned
+// when it does not match.
+func (u User) ChangePassword(ctx context.Context, traceID string, claims auth.Claims, cp ChangePassword, now time.Time) error {
 
-	u.log.Printf("%s : %s : QUERY : %s", traceID, "user.Update",
-		database.Log(q, usr.ID, usr.Name, usr.Email, usr.PasswordHash, usr.Roles, usr.DateCreated, usr.DateUpdated),
-	)
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.changePassword")
+	defer span.End()
 
-	if _, err := u.db.ExecContext(ctx, q, usr.ID, usr.Name, usr.Email, usr.PasswordHash, usr.Roles, usr.DateUpdated); err != nil {
-		return errors.Wrapf(err, "updating user %s", usr.ID)
+	usr, err := u.QueryByID(ctx, traceID, claims, claims.Subject)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	if err := bcrypt.CompareHashAndPassword(usr.PasswordHash, []byte(cp.OldPassword)); err != nil {
+		return ErrCurrentPassword
+	}
+
+	uu := UpdateUser{
+		Password:        &cp.Password,
+		PasswordConfirm: &cp.PasswordConfirm,
+		CurrentPassword: &cp.OldPassword,
+	}
+	return u.Update(ctx, traceID, claims, usr.ID, uu, usr.Version, now)
+}
+
+// ResetPassword sets a new password for a user who proved they own their
+// email by following a reset link. The caller is responsible for checking
+// the token in the link belongs to the user.
+func (u User) ResetPassword(ctx context.Context, traceID string, userID string, rp ResetPassword, now time.Time) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.resetPassword")
+	defer span.End()
+
+	if _, err := uuid.Parse(userID); err != nil {
+		return ErrInvalidID
+	}
+
+	usr, err := u.store.QueryByID(ctx, traceID, userID)
+	if err != nil {
+		return err
+	}
+	before := usr
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(rp.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return errors.Wrap(err, "generating password hash")
+	}
+	usr.PasswordHash = hash
+	usr.DateUpdated = now
+
+	if err := u.store.Update(ctx, traceID, usr); err != nil {
+		return err
+	}
+
+	after := usr
+	after.Version++
+
+	return u.record(ctx, traceID, userID, audit.ActionUpdate, userID, before, after, now)
 }
 
-// Delete removes a user from the database.
-func (u User) Delete(ctx context.Context, traceID string, userID string) error {
+// Delete marks a user as deleted. The user can no longer sign in or be
+// found but can be brought back with Restore until it is purged. Deleting a
+// user that does not exist does nothing. The last admin can't be deleted.
+func (u User) Delete(ctx context.Context, traceID string, claims auth.Claims, userID string, now time.Time) error {
 
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.delete")
 	defer span.End()
@@ -141,50 +342,137 @@ func (u User) Delete(ctx context.Context, traceID string, userID string) error {
 		return ErrInvalidID
 	}
 
-	const q = `
-	DELETE FROM
-		users
-	WHERE
-		user_id = $1`
+	before, err := u.store.QueryByID(ctx, traceID, userID)
+	if err != nil {
+		if err == ErrNotFound {
+			return nil
+		}
+		return err
+	}
 
-	u.log.Printf("%s: %s : QUERY : %s", traceID, "user.Delete",
-		database.Log(q, userID),
-	)
+	if contains(before.Roles, auth.RoleAdmin) {
+		if err := u.keepAnAdmin(ctx, traceID); err != nil {
+			return err
+		}
+	}
 
-	if _, err := u.db.ExecContext(ctx, q, userID); err != nil {
-		return errors.Wrapf(err, "deleting user %s", userID)
+	now = now.UTC()
+	if err := u.store.Delete(ctx, traceID, userID, now); err != nil {
+		return err
 	}
 
-	return nil
+	after := before
+	after.DeletedAt = &now
+	after.Version++
+
+	return u.record(ctx, traceID, claims.Subject, audit.ActionDelete, userID, before, after, now)
+}
+
+// Restore brings back a deleted user. It returns ErrNotFound when no deleted
+// user has the ID.
+func (u User) Restore(ctx context.Context, traceID string, claims auth.Claims, userID string, now time.Time) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.restore")
+	defer span.End()
+
+	if _, err := uuid.Parse(userID); err != nil {
+		return ErrInvalidID
+	}
+
+	if err := u.store.Restore(ctx, traceID, userID, now.UTC()); err != nil {
+		return err
+	}
+
+	return u.record(ctx, traceID, claims.Subject, audit.ActionRestore, userID, nil, nil, now)
+}
+
+// QueryDeleted retrieves the users deleted before the specified time, oldest
+// deletion first.
+func (u User) QueryDeleted(ctx context.Context, traceID string, before time.Time) ([]Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.queryDeleted")
+	defer span.End()
+
+	return u.store.QueryDeleted(ctx, traceID, before.UTC())
+}
+
+// Purge permanently removes a deleted user on behalf of the actor. It
+// returns ErrNotFound when no deleted user has the ID. Anything the user owns
+// outside this package must be dealt with by the caller, ideally in the same
+// transaction.
+func (u User) Purge(ctx context.Context, traceID string, actor string, userID string, now time.Time) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.purge")
+	defer span.End()
+
+	if _, err := uuid.Parse(userID); err != nil {
+		return ErrInvalidID
+	}
+
+	if err := u.store.Purge(ctx, traceID, userID); err != nil {
+		return err
+	}
+
+	return u.record(ctx, traceID, actor, audit.ActionPurge, userID, nil, nil, now)
 }
 
-// Query retrieves a list of existing users from the database.
-func (u User) Query(ctx context.Context, traceID string, pageNumber int, rowsPerPage int) ([]Info, error) {
+// Query retrieves a list of existing users from the database. Only users
+// matching the filter are returned, sorted by the specified order.
+func (u User) Query(ctx context.Context, traceID string, filter QueryFilter, orderBy database.OrderBy, pageNumber int, rowsPerPage int) ([]Info, error) {
 
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.query")
 	defer span.End()
 
-	const q = `
-	SELECT
-		*
-	FROM
-		users
-	ORDER BY
-		user_id
-	OFFSET $1
-	ROWS FETCH NEXT $2 ROWS ONLY`
 	offset := (pageNumber - 1) * rowsPerPage
 
-	u.log.Printf("%s : %s : QUERY : %s", traceID, "user.Query",
-		database.Log(q),
-	)
+	return u.store.Query(ctx, traceID, filter, orderBy, offset, rowsPerPage)
+}
+
+// QueryCursor retrieves a page of users matching the filter using keyset
+// pagination on (date_created, user_id). An empty cursor starts from the
+// first user. Unlike Query, rows inserted while a client walks the pages are
+// never skipped or repeated.
+func (u User) QueryCursor(ctx context.Context, traceID string, filter QueryFilter, cursor string, limit int) (Page, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.queryCursor")
+	defer span.End()
 
-	users := []Info{}
-	if err := u.db.SelectContext(ctx, &users, q, offset, rowsPerPage); err != nil {
-		return nil, errors.Wrap(err, "selecting users")
+	var created time.Time
+	var userID string
+	if cursor != "" {
+		var err error
+		created, userID, err = database.DecodeCursor(cursor)
+		if err != nil {
+			return Page{}, ErrInvalidCursor
+		}
+		if _, err := uuid.Parse(userID); err != nil {
+			return Page{}, ErrInvalidCursor
+		}
 	}
 
-	return users, nil
+	// The total reflects the filter but not the position of the cursor.
+	total, err := u.store.Count(ctx, traceID, filter)
+	if err != nil {
+		return Page{}, err
+	}
+
+	// Ask for one extra row so we know if there is another page.
+	users, err := u.store.QueryAfter(ctx, traceID, filter, created, userID, limit+1)
+	if err != nil {
+		return Page{}, err
+	}
+
+	page := Page{
+		Items: users,
+		Total: total,
+	}
+	if len(users) > limit {
+		page.Items = users[:limit]
+		last := page.Items[limit-1]
+		page.NextCursor = database.EncodeCursor(last.DateCreated, last.ID)
+	}
+
+	return page, nil
 }
 
 // QueryByID gets the specified user from the database.
@@ -197,33 +485,12 @@ func (u User) QueryByID(ctx context.Context, traceID string, claims auth.Claims,
 		return Info{}, ErrInvalidID
 	}
 
-	// If you are not an admin and looking to retrieve someone other than yourself.
-	if !claims.Authorize(auth.RoleAdmin) && claims.Subject != userID {
+	// If you can't read users and are looking to retrieve someone other than yourself.
+	if !claims.HasPermission(auth.PermUsersRead) && claims.Subject != userID {
 		return Info{}, ErrForbidden
 	}
 
-	const q = `
-	SELECT
-		*
-	FROM
-		users
-	WHERE 
-		user_id = $1`
-
-	u.log.Printf("%s : %s : QUERY : %s", traceID, "user.QueryByID",
-		database.Log(q, userID),
-	)
-
-	var usr Info
-	if err := u.db.GetContext(ctx, &usr, q, userID); err != nil {
-		if err == sql.ErrNoRows {
-			return Info{}, ErrNotFound
-		}
-		return Info{}, errors.Wrapf(err, "selecting user %q", userID)
-	}
-
-	return usr, nil
-
+	return u.store.QueryByID(ctx, traceID, userID)
 }
 
 // QueryByEmail gets the specified user from the database by email.
@@ -232,34 +499,30 @@ func (u User) QueryByEmail(ctx context.Context, traceID string, claims auth.Clai
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.queryByEmail")
 	defer span.End()
 
-	const q = `
-	SELECT
-		*
-	FROM
-		users
-	WHERE
-		email = $1`
-
-	u.log.Printf("%s : %s : QUERY : %s", traceID, "user.QueryByEmail",
-		database.Log(q, email),
-	)
-
-	var usr Info
-	if err := u.db.GetContext(ctx, &usr, q, email); err != nil {
-		if err == sql.ErrNoRows {
-			return Info{}, ErrNotFound
-		}
-		return Info{}, errors.Wrapf(err, "selecting user %q", email)
+	usr, err := u.store.QueryByEmail(ctx, traceID, email)
+	if err != nil {
+		return Info{}, err
 	}
 
-	// If you are not an admin and looking to retrieve someone other than yourself.
-	if !claims.Authorize(auth.RoleAdmin) && claims.Subject != usr.ID {
+	// If you can't read users and are looking to retrieve someone other than yourself.
+	if !claims.HasPermission(auth.PermUsersRead) && claims.Subject != usr.ID {
 		return Info{}, ErrForbidden
 	}
 
 	return usr, nil
 }
 
+// QueryForMail gets the user that mail for the email, like a password reset
+// or a verification link, is sent to. The caller is not authorized, so it
+// must not reveal whether a user was found.
+func (u User) QueryForMail(ctx context.Context, traceID string, email string) (Info, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.queryForMail")
+	defer span.End()
+
+	return u.store.QueryByEmail(ctx, traceID, email)
+}
+
 // Authenticate finds a user by their email and verifies their password.
 // On success it returns a Claims User representing this user.
 // The claims can be used to generate a token for future authentication.
@@ -268,48 +531,198 @@ func (u User) Authenticate(ctx context.Context, traceID string, now time.Time, e
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.authenticate")
 	defer span.End()
 
-	data := struct {
-		Email string `db:"email"`
-	}{
-		Email: email,
-	}
-
-	const q = `
-	SELECT
-		*
-	FROM
-		users
-	WHERE
-		email = :email`
-
-	u.log.Printf("%s : %s : QUERY : %s", traceID, "user.Authenticate",
-		database.Log(q, data),
-	)
-
-	var usr Info
-	if err := database.NamedQueryStruct(ctx, u.db, q, data, &usr); err != nil {
-		if err == database.ErrNotFound {
-			return auth.Claims{}, database.ErrNotFound
+	// An unknown email fails the same way as a bad password so callers can't
+	// use this to find out which accounts exist.
+	usr, err := u.store.QueryByEmail(ctx, traceID, email)
+	if err != nil {
+		if err == ErrNotFound {
+			return auth.Claims{}, ErrAuthenticationFailure
 		}
-		return auth.Claims{}, errors.Wrapf(err, "selecting user %q", email)
+		return auth.Claims{}, err
 	}
 
 	// Compare the provided password with the saved hash. Use the bcrypt
 	// comparison function so it is cryptographically secure.
 	if err := bcrypt.CompareHashAndPassword(usr.PasswordHash, []byte(password)); err != nil {
-		return auth.Claims{}, database.ErrAuthenticationFailure
+		return auth.Claims{}, ErrAuthenticationFailure
+	}
+
+	// Only report an unverified account once the password matched, so it
+	// doesn't reveal anything about accounts the caller doesn't own.
+	if usr.DateVerified == nil {
+		return auth.Claims{}, ErrNotVerified
 	}
 
 	// If we are this far the request is valid. Create some claims for the user
 	// and generate their token.
+	return u.newClaims(ctx, traceID, usr, now)
+}
+
+// ClaimsByID returns a fresh set of Claims for the specified user without
+// checking a password. It is used when a token is issued in exchange for a
+// refresh token that has already been verified.
+func (u User) ClaimsByID(ctx context.Context, traceID string, now time.Time, userID string) (auth.Claims, error) {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.claimsByID")
+	defer span.End()
+
+	if _, err := uuid.Parse(userID); err != nil {
+		return auth.Claims{}, ErrInvalidID
+	}
+
+	usr, err := u.store.QueryByID(ctx, traceID, userID)
+	if err != nil {
+		return auth.Claims{}, err
+	}
+
+	return u.newClaims(ctx, traceID, usr, now)
+}
+
+// DeleteRole removes a role as long as no user holds it, so a token can
+// always be issued for every user. Deleted users count as well since they
+// can be restored. It returns role.ErrInUse when the role is held.
+func (u User) DeleteRole(ctx context.Context, traceID string, claims auth.Claims, name string, now time.Time) error {
+
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.deleteRole")
+	defer span.End()
+
+	if role.IsBuiltIn(name) {
+		return role.ErrBuiltIn
+	}
+
+	held, err := u.store.Count(ctx, traceID, QueryFilter{Roles: []string{name}, IncludeDeleted: true})
+	if err != nil {
+		return err
+	}
+	if held > 0 {
+		return errors.Wrapf(role.ErrInUse, "held by %d users", held)
+	}
+
+	return u.roles.Delete(ctx, traceID, claims, name, now)
+}
+
+// newInfo constructs a new user, hashing their password.
+func newInfo(nu NewUser, now time.Time) (Info, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(nu.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return Info{}, errors.Wrap(err, "generating password hash")
+	}
+
+	usr := Info{
+		ID:           uuid.New().String(),
+		Name:         nu.Name,
+		Email:        nu.Email,
+		PasswordHash: hash,
+		Roles:        nu.Roles,
+		Version:      1,
+		DateCreated:  now.UTC(),
+		DateUpdated:  now.UTC(),
+	}
+
+	return usr, nil
+}
+
+// insert stores a new user and records the actor who created it.
+func (u User) insert(ctx context.Context, traceID string, actor string, usr Info, now time.Time) error {
+	if err := u.store.Create(ctx, traceID, usr); err != nil {
+		return err
+	}
+
+	return u.record(ctx, traceID, actor, audit.ActionCreate, usr.ID, nil, usr, now)
+}
+
+// record adds a change made by the actor to the audit log.
+func (u User) record(ctx context.Context, traceID string, actor string, action string, userID string, before interface{}, after interface{}, now time.Time) error {
+	ne := audit.NewEvent{
+		Actor:    actor,
+		Action:   action,
+		Entity:   entity,
+		EntityID: userID,
+		Before:   before,
+		After:    after,
+	}
+	if err := u.audit.Record(ctx, traceID, ne, now); err != nil {
+		return errors.Wrapf(err, "auditing %s of user %s", action, userID)
+	}
+	return nil
+}
+
+// authorizeUpdate checks the caller is allowed to change every field set in
+// the update. The user is the one being updated as it is stored now. Roles
+// take roles:write, and callers granted users:write change passwords and
+// emails without the current password.
+func (u User) authorizeUpdate(ctx context.Context, traceID string, claims auth.Claims, usr Info, uu UpdateUser) error {
+	if uu.Roles != nil {
+		if !claims.HasPermission(auth.PermRolesWrite) {
+			return ErrRolesAdminOnly
+		}
+		if contains(usr.Roles, auth.RoleAdmin) && !contains(uu.Roles, auth.RoleAdmin) {
+			if err := u.keepAnAdmin(ctx, traceID); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !claims.HasPermission(auth.PermUsersWrite) && (uu.Password != nil || uu.Email != nil) {
+		if uu.CurrentPassword == nil {
+			return ErrCurrentPassword
+		}
+		if err := bcrypt.CompareHashAndPassword(usr.PasswordHash, []byte(*uu.CurrentPassword)); err != nil {
+			return ErrCurrentPassword
+		}
+	}
+
+	return nil
+}
+
+// keepAnAdmin returns ErrLastAdmin unless there is more than one admin, so
+// one of them can lose the role. The admins stay locked until the
+// transaction the store runs in ends, so concurrent requests removing two
+// different admins can't both see the other one. Without a transaction the
+// check is not safe against concurrent requests.
+func (u User) keepAnAdmin(ctx context.Context, traceID string) error {
+	admins, err := u.store.LockRole(ctx, traceID, auth.RoleAdmin)
+	if err != nil {
+		return errors.Wrap(err, "counting admins")
+	}
+	if admins <= 1 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// permissions resolves the permissions granted by a set of roles. It
+// returns ErrUnknownRole if any of the roles does not exist.
+func (u User) permissions(ctx context.Context, traceID string, roles []string) ([]string, error) {
+	perms, err := u.roles.Permissions(ctx, traceID, roles)
+	if err != nil {
+		if err == role.ErrNotFound {
+			return nil, ErrUnknownRole
+		}
+		return nil, errors.Wrap(err, "resolving permissions")
+	}
+	return perms, nil
+}
+
+// newClaims constructs the Claims for a user. Every set of claims gets a
+// unique id (jti) so the token generated from it can be revoked, and carries
+// the permissions of the user's roles as scopes.
+func (u User) newClaims(ctx context.Context, traceID string, usr Info, now time.Time) (auth.Claims, error) {
+	scopes, err := u.permissions(ctx, traceID, usr.Roles)
+	if err != nil {
+		return auth.Claims{}, err
+	}
+
 	claims := auth.Claims{
 		StandardClaims: jwt.StandardClaims{
+			Id:        uuid.New().String(),
 			Issuer:    "service project",
 			Subject:   usr.ID,
-			ExpiresAt: now.Add(time.Hour).Unix(),
+			ExpiresAt: now.Add(AccessTTL).Unix(),
 			IssuedAt:  now.Unix(),
 		},
-		Roles: usr.Roles,
+		Roles:  usr.Roles,
+		Scopes: scopes,
 	}
 
 	return claims, nil
@@ -1,14 +1,22 @@
 package user_test
 
 import (
+	"context"
+	"fmt"
+	"os"
 	"testing"
 	"time"
 
 	"github.com/dapperauteur/go-base-service/business/auth"
+	"github.com/dapperauteur/go-base-service/business/data/audit"
+	"github.com/dapperauteur/go-base-service/business/data/role"
 	"github.com/dapperauteur/go-base-service/business/data/user"
 	"github.com/dapperauteur/go-base-service/business/tests"
+	"github.com/dapperauteur/go-base-service/foundation/database"
+	"github.com/dapperauteur/go-base-service/foundation/logger"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/google/go-cmp/cmp"
+	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 )
 
@@ -16,8 +24,31 @@ func TestUser(t *testing.T) {
 	log, db, teardown := tests.NewUnit(t)
 	t.Cleanup(teardown)
 
-	u := user.New(log, db)
+	testUpdateAuthorization(t, user.New(log, db))
+	testUser(t, user.New(log, db))
+	testSignup(t, user.New(log, db))
+	testResetPassword(t, user.New(log, db))
+	testDeleteRole(t, user.New(log, db), role.New(log, db))
+	testStore(t, user.NewPostgresStore(log, db))
+	testLastAdminRace(t, log, db)
+}
+
+func TestUserMemory(t *testing.T) {
+	log := logger.New(os.Stdout, "TEST", logger.LevelDebug)
+
+	roles := role.NewMemoryStore()
+	u := user.NewWithStore(log, user.NewMemoryStore(), audit.NewMemoryStore(), roles)
+	testUpdateAuthorization(t, u)
+	testUser(t, u)
+	testSignup(t, u)
+	testResetPassword(t, u)
+	testDeleteRole(t, u, role.NewWithStore(log, roles, audit.NewMemoryStore()))
+	testStore(t, user.NewMemoryStore())
+}
 
+// testUser runs the User API against a store that already holds another
+// admin, so the user it creates isn't the last one.
+func testUser(t *testing.T, u user.User) {
 	t.Log("Given the need to work with User records.")
 	{
 		testID := 0
@@ -35,12 +66,54 @@ func TestUser(t *testing.T) {
 				PasswordConfirm: "spreadlove",
 			}
 
-			usr, err := u.Create(ctx, traceID, nu, now)
+			admin := auth.Claims{
+				StandardClaims: jwt.StandardClaims{
+					Issuer:    "service project",
+					Subject:   "5cf37266-3473-4006-984f-9325122678b7",
+					ExpiresAt: now.Add(time.Hour).Unix(),
+					IssuedAt:  now.Unix(),
+				},
+				Roles:  []string{auth.RoleAdmin},
+				Scopes: auth.Permissions,
+			}
+
+			usr, err := u.Create(ctx, traceID, admin, nu, now)
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to create user : %s.", tests.Failed, testID, err)
 			}
 			t.Logf("\t%s\tTest %d:\tShould be able to create user.", tests.Success, testID)
 
+			bad := nu
+			bad.Email = "bad@awews.com"
+			bad.Roles = []string{"OWNER"}
+			if _, err := u.Create(ctx, traceID, admin, bad, now); err != user.ErrUnknownRole {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to create a user with an unknown role : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to create a user with an unknown role.", tests.Success, testID)
+
+			manager := admin
+			manager.Roles = []string{auth.RoleUser}
+			manager.Scopes = []string{auth.PermUsersRead, auth.PermUsersWrite}
+			escalate := nu
+			escalate.Email = "escalate@awews.com"
+			if _, err := u.Create(ctx, traceID, manager, escalate, now); err != user.ErrRolesAdminOnly {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to create an admin without roles:write : %v.", tests.Failed, testID, err)
+			}
+			escalate.Roles = []string{auth.RoleUser}
+			if _, err := u.Create(ctx, traceID, manager, escalate, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a user with the USER role without roles:write : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only be able to create admins with roles:write.", tests.Success, testID)
+
+			signedIn, err := u.Authenticate(ctx, traceID, now, nu.Email, nu.Password)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to authenticate the user : %s.", tests.Failed, testID, err)
+			}
+			if !signedIn.HasPermission(auth.PermUsersWrite) {
+				t.Fatalf("\t%s\tTest %d:\tShould get the permissions of the admin role as scopes : %v.", tests.Failed, testID, signedIn.Scopes)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the permissions of the admin role as scopes.", tests.Success, testID)
+
 			claims := auth.Claims{
 				StandardClaims: jwt.StandardClaims{
 					Issuer:    "service project",
@@ -62,6 +135,17 @@ func TestUser(t *testing.T) {
 			}
 			t.Logf("\t%s\tTest %d:\tShould get back the same user.", tests.Success, testID)
 
+			page, err := u.QueryCursor(ctx, traceID, user.QueryFilter{Email: nu.Email}, "", 1)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve a page of users : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to retrieve a page of users.", tests.Success, testID)
+
+			if page.Total != 1 || len(page.Items) != 1 || page.NextCursor != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get a single page holding the user : got %+v.", tests.Failed, testID, page)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get a single page holding the user.", tests.Success, testID)
+
 			upd := user.UpdateUser{
 				Name:  tests.StringPointer("Anthony McDonald"),
 				Email: tests.StringPointer("a@awews.com"),
@@ -74,14 +158,20 @@ func TestUser(t *testing.T) {
 					ExpiresAt: now.Add(time.Hour).Unix(),
 					IssuedAt:  now.Unix(),
 				},
-				Roles: []string{auth.RoleAdmin},
+				Roles:  []string{auth.RoleAdmin},
+				Scopes: auth.Permissions,
 			}
 
-			if err := u.Update(ctx, traceID, claims, usr.ID, upd, now); err != nil {
+			if err := u.Update(ctx, traceID, claims, usr.ID, upd, usr.Version, now); err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to update user : %s.", tests.Failed, testID, err)
 			}
 			t.Logf("\t%s\tTest %d:\tShould be able to update user.", tests.Success, testID)
 
+			if err := u.Update(ctx, traceID, claims, usr.ID, upd, usr.Version, now); err != user.ErrVersionConflict {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to update from a stale version : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to update from a stale version.", tests.Success, testID)
+
 			saved, err = u.QueryByEmail(ctx, traceID, claims, *upd.Email)
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve user by Email : %s.", tests.Failed, testID, err)
@@ -96,6 +186,12 @@ func TestUser(t *testing.T) {
 				t.Logf("\t%s\tTest %d:\tShould be able to see updates to Name.", tests.Success, testID)
 			}
 
+			if saved.Version != usr.Version+1 {
+				t.Errorf("\t%s\tTest %d:\tShould see the version bumped : got %d exp %d.", tests.Failed, testID, saved.Version, usr.Version+1)
+			} else {
+				t.Logf("\t%s\tTest %d:\tShould see the version bumped.", tests.Success, testID)
+			}
+
 			if saved.Email != *upd.Email {
 				t.Errorf("\t%s\tTest %d:\tShould be able to see updates to Email.", tests.Failed, testID)
 				t.Logf("\t\tTest %d:\tGot: %v", testID, saved.Email)
@@ -104,7 +200,7 @@ func TestUser(t *testing.T) {
 				t.Logf("\t%s\tTest %d:\tShould be able to see updates to Email.", tests.Success, testID)
 			}
 
-			if err := u.Delete(ctx, traceID, usr.ID); err != nil {
+			if err := u.Delete(ctx, traceID, admin, usr.ID, now); err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to delete user : %s.", tests.Failed, testID, err)
 			}
 			t.Logf("\t%s\tTest %d:\tShould be able to delete user.", tests.Success, testID)
@@ -114,6 +210,531 @@ func TestUser(t *testing.T) {
 				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to retrieve user : %s.", tests.Failed, testID, err)
 			}
 			t.Logf("\t%s\tTest %d:\tShould NOT be able to retrieve user.", tests.Success, testID)
+
+			if _, err := u.Authenticate(ctx, traceID, now, *upd.Email, nu.Password); err != user.ErrAuthenticationFailure {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to authenticate a deleted user : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to authenticate a deleted user.", tests.Success, testID)
+
+			deleted, err := u.QueryDeleted(ctx, traceID, now.Add(time.Second))
+			if err != nil || len(deleted) != 1 || deleted[0].ID != usr.ID {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to list deleted users : %v : %+v.", tests.Failed, testID, err, deleted)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to list deleted users.", tests.Success, testID)
+
+			// Purging lists the users deleted before a cutoff so anyone deleted
+			// since must stay restorable.
+			deleted, err = u.QueryDeleted(ctx, traceID, now)
+			if err != nil || len(deleted) != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT list users deleted at or after the cutoff : %v : %+v.", tests.Failed, testID, err, deleted)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT list users deleted at or after the cutoff.", tests.Success, testID)
+
+			if err := u.Restore(ctx, traceID, admin, usr.ID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to restore user : %s.", tests.Failed, testID, err)
+			}
+			if _, err := u.QueryByID(ctx, traceID, claims, usr.ID); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve a restored user : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to restore user.", tests.Success, testID)
+
+			if err := u.Purge(ctx, traceID, admin.Subject, usr.ID, now); err != user.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to purge a user that is not deleted : %v.", tests.Failed, testID, err)
+			}
+			if err := u.Delete(ctx, traceID, admin, usr.ID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to delete user : %s.", tests.Failed, testID, err)
+			}
+			if err := u.Purge(ctx, traceID, admin.Subject, usr.ID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to purge a deleted user : %s.", tests.Failed, testID, err)
+			}
+			if err := u.Restore(ctx, traceID, admin, usr.ID, now); err != user.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to restore a purged user : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to purge a deleted user.", tests.Success, testID)
+		}
+	}
+}
+
+// testUpdateAuthorization checks which fields of a user the caller may
+// change. The store must not hold any admin and is left with one.
+func testUpdateAuthorization(t *testing.T, u user.User) {
+	t.Log("Given the need to stop users from escalating their privileges.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen updating an admin and a regular user.", testID)
+		{
+			ctx := tests.Context()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			create := func(email string, role string) (user.Info, auth.Claims) {
+				nu := user.NewUser{
+					Name:            "Jacob Walker",
+					Email:           email,
+					Roles:           []string{role},
+					Password:        "gophers",
+					PasswordConfirm: "gophers",
+				}
+				usr, err := u.Create(ctx, traceID, auth.Claims{Roles: []string{auth.RoleAdmin}, Scopes: auth.Permissions}, nu, now)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to create user %s : %s.", tests.Failed, testID, email, err)
+				}
+				claims, err := u.ClaimsByID(ctx, traceID, now, usr.ID)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to build the claims of user %s : %s.", tests.Failed, testID, email, err)
+				}
+				return usr, claims
+			}
+			adm, admClaims := create("jacob@admins.com", auth.RoleAdmin)
+			usr, usrClaims := create("jacob@users.com", auth.RoleUser)
+
+			upd := user.UpdateUser{Roles: []string{auth.RoleAdmin}}
+			if err := u.Update(ctx, traceID, usrClaims, usr.ID, upd, 0, now); err != user.ErrRolesAdminOnly {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to grant yourself a role : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to grant yourself a role.", tests.Success, testID)
+
+			upd = user.UpdateUser{
+				Password:        tests.StringPointer("hijacked"),
+				PasswordConfirm: tests.StringPointer("hijacked"),
+			}
+			if err := u.Update(ctx, traceID, usrClaims, usr.ID, upd, 0, now); errors.Cause(err) != user.ErrForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to change the password without the current one : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to change the password without the current one.", tests.Success, testID)
+
+			upd = user.UpdateUser{
+				Email:           tests.StringPointer("jacob@hijacked.com"),
+				CurrentPassword: tests.StringPointer("guessed"),
+			}
+			if err := u.Update(ctx, traceID, usrClaims, usr.ID, upd, 0, now); err != user.ErrCurrentPassword {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to change the email with a wrong password : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to change the email with a wrong password.", tests.Success, testID)
+
+			upd.CurrentPassword = tests.StringPointer("gophers")
+			if err := u.Update(ctx, traceID, usrClaims, usr.ID, upd, 0, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to change the email with the current password : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to change the email with the current password.", tests.Success, testID)
+
+			changed, err := u.QueryByID(ctx, traceID, admClaims, usr.ID)
+			if err != nil || changed.DateVerified != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould have to verify a changed email : %+v : %v.", tests.Failed, testID, changed.DateVerified, err)
+			}
+			if err := u.Verify(ctx, traceID, usr.ID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to verify the changed email : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould have to verify a changed email.", tests.Success, testID)
+
+			upd = user.UpdateUser{
+				Password:        tests.StringPointer("reset"),
+				PasswordConfirm: tests.StringPointer("reset"),
+			}
+			if err := u.Update(ctx, traceID, admClaims, usr.ID, upd, 0, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reset a password as an admin : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to reset a password as an admin.", tests.Success, testID)
+
+			upd = user.UpdateUser{Roles: []string{auth.RoleUser}}
+			if err := u.Update(ctx, traceID, admClaims, adm.ID, upd, 0, now); err != user.ErrLastAdmin {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to remove the last admin : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to remove the last admin.", tests.Success, testID)
+
+			upd = user.UpdateUser{Roles: []string{auth.RoleAdmin}}
+			if err := u.Update(ctx, traceID, admClaims, usr.ID, upd, 0, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to grant a role as an admin : %s.", tests.Failed, testID, err)
+			}
+			upd = user.UpdateUser{Roles: []string{auth.RoleUser}}
+			if err := u.Update(ctx, traceID, admClaims, adm.ID, upd, 0, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to step down once there is another admin : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to step down once there is another admin.", tests.Success, testID)
+
+			if err := u.Delete(ctx, traceID, admClaims, usr.ID, now); err != user.ErrLastAdmin {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to delete the last admin : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to delete the last admin.", tests.Success, testID)
+
+			cp := user.ChangePassword{
+				OldPassword:     "guessed",
+				Password:        "changed",
+				PasswordConfirm: "changed",
+			}
+			if err := u.ChangePassword(ctx, traceID, admClaims, cp, now); err != user.ErrCurrentPassword {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to change a password with a wrong old one : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to change a password with a wrong old one.", tests.Success, testID)
+
+			cp.OldPassword = "reset"
+			if err := u.ChangePassword(ctx, traceID, usrClaims, cp, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to change a password with the old one : %s.", tests.Failed, testID, err)
+			}
+			if _, err := u.Authenticate(ctx, traceID, now, "jacob@hijacked.com", "changed"); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to sign in with the new password : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to sign in with the new password.", tests.Success, testID)
+		}
+	}
+}
+
+// testSignup checks a user who signed themselves up can only authenticate
+// once their email is verified.
+func testSignup(t *testing.T, u user.User) {
+	t.Log("Given the need to verify the email of users who sign up.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen handling a signup.", testID)
+		{
+			ctx := tests.Context()
+			now := time.Date(2018, time.November, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			ns := user.NewSignup{
+				Name:            "Ann Signup",
+				Email:           "ann@signup.com",
+				Password:        "gophers",
+				PasswordConfirm: "gophers",
+			}
+
+			usr, err := u.Signup(ctx, traceID, ns, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to sign up : %s.", tests.Failed, testID, err)
+			}
+			if diff := cmp.Diff([]string(usr.Roles), []string{auth.RoleUser}); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould only get the user role. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to sign up.", tests.Success, testID)
+
+			again := ns
+			again.Password, again.PasswordConfirm = "hijacked", "hijacked"
+			dup, err := u.Signup(ctx, traceID, again, now)
+			if err != nil || dup.ID != usr.ID {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the user signed up with the email : %v : %+v.", tests.Failed, testID, err, dup)
+			}
+			if _, err := u.Authenticate(ctx, traceID, now, ns.Email, again.Password); err != user.ErrAuthenticationFailure {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT change the password of the user : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the user signed up with the email, unchanged.", tests.Success, testID)
+
+			if _, err := u.Authenticate(ctx, traceID, now, ns.Email, "wrong"); err != user.ErrAuthenticationFailure {
+				t.Fatalf("\t%s\tTest %d:\tShould fail a bad password before checking verification : %v.", tests.Failed, testID, err)
+			}
+			if _, err := u.Authenticate(ctx, traceID, now, ns.Email, ns.Password); err != user.ErrNotVerified {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to authenticate before verifying : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to authenticate before verifying.", tests.Success, testID)
+
+			if err := u.Verify(ctx, traceID, usr.ID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to verify : %s.", tests.Failed, testID, err)
+			}
+			if err := u.Verify(ctx, traceID, usr.ID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to verify twice : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to verify.", tests.Success, testID)
+
+			if _, err := u.Authenticate(ctx, traceID, now, ns.Email, ns.Password); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to authenticate once verified : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to authenticate once verified.", tests.Success, testID)
+
+			if err := u.Verify(ctx, traceID, "45b5fbd3-755f-4379-8f07-000000000000", now); err != user.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to verify an unknown user : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to verify an unknown user.", tests.Success, testID)
+		}
+	}
+}
+
+// testResetPassword checks a user who forgot their password can set a new
+// one.
+func testResetPassword(t *testing.T, u user.User) {
+	t.Log("Given the need to reset forgotten passwords.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen handling a password reset.", testID)
+		{
+			ctx := tests.Context()
+			now := time.Date(2018, time.December, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			nu := user.NewUser{
+				Name:            "Rita Reset",
+				Email:           "rita@reset.com",
+				Roles:           []string{auth.RoleUser},
+				Password:        "forgotten",
+				PasswordConfirm: "forgotten",
+			}
+			if _, err := u.Create(ctx, traceID, auth.Claims{Roles: []string{auth.RoleAdmin}, Scopes: auth.Permissions}, nu, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create user : %s.", tests.Failed, testID, err)
+			}
+
+			if _, err := u.QueryForMail(ctx, traceID, "nobody@reset.com"); err != user.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT find an unknown email : %v.", tests.Failed, testID, err)
+			}
+			usr, err := u.QueryForMail(ctx, traceID, nu.Email)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to find the user by email : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to find the user by email.", tests.Success, testID)
+
+			rp := user.ResetPassword{
+				Token:           "checked by the caller",
+				Password:        "remembered",
+				PasswordConfirm: "remembered",
+			}
+			if err := u.ResetPassword(ctx, traceID, usr.ID, rp, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reset the password : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to reset the password.", tests.Success, testID)
+
+			if _, err := u.Authenticate(ctx, traceID, now, nu.Email, nu.Password); err != user.ErrAuthenticationFailure {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to sign in with the old password : %v.", tests.Failed, testID, err)
+			}
+			if _, err := u.Authenticate(ctx, traceID, now, nu.Email, rp.Password); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to sign in with the new password : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to sign in with the new password.", tests.Success, testID)
+		}
+	}
+}
+
+// testStore checks the behavior every Store must share, so the memory store
+// can stand in for Postgres. The store must start out empty.
+// testLastAdminRace removes two admins at the same time from separate
+// transactions. Only one of them may go so an admin is always left.
+func testLastAdminRace(t *testing.T, log *logger.Logger, db *sqlx.DB) {
+	t.Log("Given the need to always keep an admin.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen two admins are removed at the same time.", testID)
+		{
+			ctx := tests.Context()
+			now := time.Date(2020, time.July, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			admin := auth.Claims{
+				StandardClaims: jwt.StandardClaims{Subject: "5cf37266-3473-4006-984f-9325122678b7"},
+				Roles:          []string{auth.RoleAdmin},
+				Scopes:         auth.Permissions,
+			}
+
+			// Start from exactly two admins.
+			u := user.New(log, db)
+			admins, err := u.Query(ctx, traceID, user.QueryFilter{Roles: []string{auth.RoleAdmin}}, user.DefaultOrderBy, 1, 100)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to query the admins : %s.", tests.Failed, testID, err)
+			}
+			for len(admins) < 2 {
+				nu := user.NewUser{
+					Name:            "Race Admin",
+					Email:           fmt.Sprintf("race%d@admins.com", len(admins)),
+					Roles:           []string{auth.RoleAdmin},
+					Password:        "gophers",
+					PasswordConfirm: "gophers",
+				}
+				usr, err := u.Create(ctx, traceID, admin, nu, now)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to create an admin : %s.", tests.Failed, testID, err)
+				}
+				admins = append(admins, usr)
+			}
+			for _, adm := range admins[2:] {
+				if err := u.Update(ctx, traceID, admin, adm.ID, user.UpdateUser{Roles: []string{auth.RoleUser}}, 0, now); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to demote an admin : %s.", tests.Failed, testID, err)
+				}
+			}
+
+			errs := make(chan error, 2)
+			remove := []func(u user.User, userID string) error{
+				func(u user.User, userID string) error {
+					return u.Update(ctx, traceID, admin, userID, user.UpdateUser{Roles: []string{auth.RoleUser}}, 0, now)
+				},
+				func(u user.User, userID string) error {
+					return u.Delete(ctx, traceID, admin, userID, now)
+				},
+			}
+			for i, fn := range remove {
+				go func(fn func(u user.User, userID string) error, userID string) {
+					errs <- database.WithTx(ctx, db, func(tx *sqlx.Tx) error {
+						return fn(user.New(log, tx), userID)
+					})
+				}(fn, admins[i].ID)
+			}
+
+			var removed, refused int
+			for range remove {
+				switch err := <-errs; err {
+				case nil:
+					removed++
+				case user.ErrLastAdmin:
+					refused++
+				default:
+					t.Fatalf("\t%s\tTest %d:\tShould only fail with ErrLastAdmin : %s.", tests.Failed, testID, err)
+				}
+			}
+			if removed != 1 || refused != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould remove exactly one admin : removed %d, refused %d.", tests.Failed, testID, removed, refused)
+			}
+			t.Logf("\t%s\tTest %d:\tShould remove exactly one admin.", tests.Success, testID)
+		}
+	}
+}
+
+// testDeleteRole checks a role can only be deleted once no user, deleted or
+// not, holds it.
+func testDeleteRole(t *testing.T, u user.User, r role.Role) {
+	t.Log("Given the need to delete roles users may hold.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a user holds the role.", testID)
+		{
+			ctx := tests.Context()
+			now := time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			admin := auth.Claims{
+				StandardClaims: jwt.StandardClaims{Subject: "5cf37266-3473-4006-984f-9325122678b7"},
+				Roles:          []string{auth.RoleAdmin},
+				Scopes:         auth.Permissions,
+			}
+
+			if _, err := r.Create(ctx, traceID, admin, role.NewRole{Name: "EDITOR", Permissions: []string{auth.PermUsersRead}}, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a role : %s.", tests.Failed, testID, err)
+			}
+
+			nu := user.NewUser{
+				Name:            "Ed Itor",
+				Email:           "editor@example.com",
+				Roles:           []string{"EDITOR"},
+				Password:        "gophers",
+				PasswordConfirm: "gophers",
+			}
+			usr, err := u.Create(ctx, traceID, admin, nu, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a user : %s.", tests.Failed, testID, err)
+			}
+
+			if err := u.DeleteRole(ctx, traceID, admin, auth.RoleAdmin, now); err != role.ErrBuiltIn {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to delete a built-in role : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to delete a built-in role.", tests.Success, testID)
+
+			if err := u.DeleteRole(ctx, traceID, admin, "EDITOR", now); errors.Cause(err) != role.ErrInUse {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to delete a role a user holds : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to delete a role a user holds.", tests.Success, testID)
+
+			if err := u.Delete(ctx, traceID, admin, usr.ID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to delete the user : %s.", tests.Failed, testID, err)
+			}
+			if err := u.DeleteRole(ctx, traceID, admin, "EDITOR", now); errors.Cause(err) != role.ErrInUse {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to delete a role a deleted user holds : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to delete a role a deleted user holds.", tests.Success, testID)
+
+			if err := u.Purge(ctx, traceID, admin.Subject, usr.ID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to purge the user : %s.", tests.Failed, testID, err)
+			}
+			if err := u.DeleteRole(ctx, traceID, admin, "EDITOR", now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to delete a role nobody holds : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to delete a role nobody holds.", tests.Success, testID)
+		}
+	}
+}
+
+func testStore(t *testing.T, s user.Store) {
+	t.Log("Given the need for stores to behave the same way.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen handling a set of users.", testID)
+		{
+			ctx := context.Background()
+			traceID := "00000000-0000-0000-0000-000000000000"
+			now := time.Date(2020, time.May, 1, 0, 0, 0, 0, time.UTC)
+
+			users := []user.Info{
+				{ID: "a3f2a8b4-7d2f-4b8a-9c1e-2f8b6d1e9c01", Name: "Carol", Email: "carol@example.com", Roles: []string{auth.RoleUser}, DateCreated: now, DateUpdated: now},
+				{ID: "0b6c5e3d-2a1f-4c9e-8d7b-6a5f4e3d2c02", Name: "alice", Email: "alice@example.com", Roles: []string{auth.RoleAdmin, auth.RoleUser}, DateCreated: now, DateUpdated: now},
+				{ID: "5d4c3b2a-1f0e-4d9c-8b7a-6f5e4d3c2b03", Name: "Bob", Email: "bob@example.com", Roles: []string{auth.RoleUser}, DateCreated: now.Add(-time.Hour), DateUpdated: now},
+			}
+			for _, usr := range users {
+				if err := s.Create(ctx, traceID, usr); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to create user %s : %s.", tests.Failed, testID, usr.Name, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create users.", tests.Success, testID)
+
+			dup := users[0]
+			dup.ID = "9e8d7c6b-5a4f-4e3d-8c2b-1a0f9e8d7c04"
+			if err := s.Create(ctx, traceID, dup); err != user.ErrUniqueEmail {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to create a user with a used email : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to create a user with a used email.", tests.Success, testID)
+
+			upd := users[1]
+			upd.Email = users[2].Email
+			if err := s.Update(ctx, traceID, upd); err != user.ErrUniqueEmail {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to take another user's email : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to take another user's email.", tests.Success, testID)
+
+			upd.Email = users[1].Email
+			if err := s.Update(ctx, traceID, upd); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to update a user : %s.", tests.Failed, testID, err)
+			}
+			if err := s.Update(ctx, traceID, upd); err != user.ErrVersionConflict {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to update from a stale version : %v.", tests.Failed, testID, err)
+			}
+			if err := s.Update(ctx, traceID, dup); err != user.ErrVersionConflict {
+				t.Fatalf("\t%s\tTest %d:\tShould report a conflict updating a missing user : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only update the version that was read.", tests.Success, testID)
+
+			if _, err := s.QueryByID(ctx, traceID, dup.ID); err != user.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould get ErrNotFound for a missing id : %v.", tests.Failed, testID, err)
+			}
+			if _, err := s.QueryByEmail(ctx, traceID, "nobody@example.com"); err != user.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould get ErrNotFound for a missing email : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get ErrNotFound for missing users.", tests.Success, testID)
+
+			names := func(users []user.Info) []string {
+				var names []string
+				for _, usr := range users {
+					names = append(names, usr.Name)
+				}
+				return names
+			}
+
+			byEmail := database.OrderBy{Field: "email", Direction: database.DESC}
+			page, err := s.Query(ctx, traceID, user.QueryFilter{}, byEmail, 1, 2)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to query users : %s.", tests.Failed, testID, err)
+			}
+			if diff := cmp.Diff([]string{"Bob", "alice"}, names(page)); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get the second page in order. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the second page in order.", tests.Success, testID)
+
+			// Users created at the same time are ordered by id.
+			after, err := s.QueryAfter(ctx, traceID, user.QueryFilter{}, users[2].DateCreated, users[2].ID, 10)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to query after a key : %s.", tests.Failed, testID, err)
+			}
+			if diff := cmp.Diff([]string{"alice", "Carol"}, names(after)); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get the users after the key in order. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the users after the key in order.", tests.Success, testID)
+
+			filter := user.QueryFilter{Name: "ALI", Roles: []string{auth.RoleAdmin}}
+			total, err := s.Count(ctx, traceID, filter)
+			if err != nil || total != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould count the users matching a filter : got %d : %v.", tests.Failed, testID, total, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould count the users matching a filter.", tests.Success, testID)
 		}
 	}
 }
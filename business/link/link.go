@@ -0,0 +1,84 @@
+// Package link signs and checks the expiring tokens put in links that are
+// sent to users, like the one verifying an email address.
+package link
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Set of error variables for checking tokens.
+var (
+	ErrInvalid = errors.New("link is not valid")
+	ErrExpired = errors.New("link has expired")
+)
+
+// Signer signs tokens with a secret key. A token names a subject, like a
+// user id, and is only valid for the purpose it was signed for until it
+// expires. Tokens are not stored, so they can't be revoked before then.
+type Signer struct {
+	key []byte
+}
+
+// NewSigner constructs a Signer using the secret key.
+func NewSigner(key []byte) (Signer, error) {
+	if len(key) < 32 {
+		return Signer{}, errors.New("key must be at least 32 bytes")
+	}
+	return Signer{key: key}, nil
+}
+
+// Sign returns a token for the subject that is valid for the purpose until
+// it expires. The token is safe to use in a URL.
+func (s Signer) Sign(purpose string, subject string, expires time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(subject)) + "." + strconv.FormatInt(expires.Unix(), 10)
+	return payload + "." + s.signature(purpose, payload)
+}
+
+// Verify checks a token was signed for the purpose and has not expired. It
+// returns the subject of the token.
+func (s Signer) Verify(purpose string, token string, now time.Time) (string, error) {
+	i := strings.LastIndex(token, ".")
+	if i < 0 {
+		return "", ErrInvalid
+	}
+	payload, sig := token[:i], token[i+1:]
+
+	if !hmac.Equal([]byte(sig), []byte(s.signature(purpose, payload))) {
+		return "", ErrInvalid
+	}
+
+	parts := strings.Split(payload, ".")
+	if len(parts) != 2 {
+		return "", ErrInvalid
+	}
+	subject, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrInvalid
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", ErrInvalid
+	}
+
+	if now.Unix() >= expires {
+		return "", ErrExpired
+	}
+
+	return string(subject), nil
+}
+
+// signature returns the MAC binding the payload to the purpose.
+func (s Signer) signature(purpose string, payload string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(purpose))
+	mac.Write([]byte{0})
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,66 @@
+package link_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dapperauteur/go-base-service/business/link"
+	"github.com/dapperauteur/go-base-service/business/tests"
+)
+
+func TestLink(t *testing.T) {
+	t.Log("Given the need to sign links sent to users.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen handling a single token.", testID)
+		{
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+			if _, err := link.NewSigner([]byte("short")); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT accept a short key.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT accept a short key.", tests.Success, testID)
+
+			s, err := link.NewSigner([]byte(strings.Repeat("k", 32)))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct a signer : %s.", tests.Failed, testID, err)
+			}
+
+			tkn := s.Sign("verify", "5cf37266-3473-4006-984f-9325122678b7", now.Add(time.Hour))
+
+			subject, err := s.Verify("verify", tkn, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to verify the token : %s.", tests.Failed, testID, err)
+			}
+			if subject != "5cf37266-3473-4006-984f-9325122678b7" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the subject : %s.", tests.Failed, testID, subject)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to verify the token.", tests.Success, testID)
+
+			if _, err := s.Verify("reset", tkn, now); err != link.ErrInvalid {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT accept the token for another purpose : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT accept the token for another purpose.", tests.Success, testID)
+
+			if _, err := s.Verify("verify", "x"+tkn, now); err != link.ErrInvalid {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT accept a tampered token : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT accept a tampered token.", tests.Success, testID)
+
+			other, err := link.NewSigner([]byte(strings.Repeat("o", 32)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := other.Verify("verify", tkn, now); err != link.ErrInvalid {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT accept a token signed with another key : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT accept a token signed with another key.", tests.Success, testID)
+
+			if _, err := s.Verify("verify", tkn, now.Add(time.Hour)); err != link.ErrExpired {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT accept an expired token : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT accept an expired token.", tests.Success, testID)
+		}
+	}
+}
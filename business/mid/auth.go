@@ -3,11 +3,11 @@ package mid
 import (
 	"context"
 	"errors"
-	"log"
 	"net/http"
 	"strings"
 
 	"github.com/dapperauteur/go-base-service/business/auth"
+	"github.com/dapperauteur/go-base-service/foundation/logger"
 	"github.com/dapperauteur/go-base-service/foundation/web"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -45,13 +45,15 @@ func Authenticate(a *auth.Auth) web.Middleware {
 			}
 
 			// Validate the token is signed by us.
-			claims, err := a.ValidateToken(parts[1])
+			claims, err := a.ValidateToken(ctx, parts[1])
 			if err != nil {
 				return web.NewRequestError(err, http.StatusUnauthorized)
 			}
 
-			// Add claims to the context so they can be retrieved later.
+			// Add claims to the context so they can be retrieved later and
+			// tag every record logged for the request with the user.
 			ctx = context.WithValue(ctx, auth.Key, claims)
+			logger.AddFields(ctx, "subject", claims.Subject)
 
 			// Call the next handler.
 			return handler(ctx, w, r)
@@ -63,7 +65,7 @@ func Authenticate(a *auth.Auth) web.Middleware {
 
 // Authorize validates that an authenticated user has at least one role from a
 // specified list. This method constructs the actual function that is used.
-func Authorize(log *log.Logger, roles ...string) web.Middleware {
+func Authorize(log *logger.Logger, roles ...string) web.Middleware {
 
 	// This is the actual middleware function to be executed.
 	m := func(handler web.Handler) web.Handler {
@@ -81,7 +83,7 @@ func Authorize(log *log.Logger, roles ...string) web.Middleware {
 			}
 
 			if !claims.Authorize(roles...) {
-				log.Printf("mid: authorize: claims: %v exp: %v", claims.Roles, roles)
+				log.Warn(ctx, "authorize failed", "roles", claims.Roles, "required", roles)
 				// return validate.NewRequestError(
 				// 	fmt.Errorf("you are not authorized for that action: claims: %v exp: %v", claims.Roles, roles),
 				// 	http.StatusForbidden,
@@ -95,3 +97,35 @@ func Authorize(log *log.Logger, roles ...string) web.Middleware {
 	}
 	return m
 }
+
+// RequirePermission validates that an authenticated user was granted a
+// permission by one of their roles. The permissions are carried in the
+// scopes of the token.
+func RequirePermission(log *logger.Logger, permission string) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+			ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.mid.requirePermission")
+			defer span.End()
+
+			// If the context is missing this value return failure.
+			claims, ok := ctx.Value(auth.Key).(auth.Claims)
+			if !ok {
+				return errors.New("claims missing from context")
+			}
+
+			if !claims.HasPermission(permission) {
+				log.Warn(ctx, "permission denied", "scopes", claims.Scopes, "required", permission)
+				return ErrForbidden
+			}
+
+			return handler(ctx, w, r)
+		}
+		return h
+	}
+	return m
+}
@@ -2,9 +2,9 @@ package mid
 
 import (
 	"context"
-	"log"
 	"net/http"
 
+	"github.com/dapperauteur/go-base-service/foundation/logger"
 	"github.com/dapperauteur/go-base-service/foundation/web"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -12,7 +12,7 @@ import (
 // Errors handles errors coming out of the call chain. It detects normal
 // application errors which are used to respond to the client in a uniform way.
 // Unexpected errors (status >= 500) are logged.
-func Errors(log *log.Logger) web.Middleware {
+func Errors(log *logger.Logger) web.Middleware {
 
 	// This is the actual middleware function to be executed.
 	m := func(handler web.Handler) web.Handler {
@@ -22,18 +22,11 @@ func Errors(log *log.Logger) web.Middleware {
 			ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.mid.errors")
 			defer span.End()
 
-			// If the context is missing this value, request the service
-			// to be shutdown gracefully.
-			v, ok := ctx.Value(web.KeyValues).(*web.Values)
-			if !ok {
-				return web.NewShutdownError("web value missing from context")
-			}
-
 			// Run the next handler and catch any propagated error.
 			if err := handler(ctx, w, r); err != nil {
 
 				// Log the error.
-				log.Printf("TraceID %s : ERROR     : %v", v.TraceID, err)
+				log.Error(ctx, "request failed", "error", err)
 
 				// Respond with the error back to the client.
 				if err := web.RespondError(ctx, w, err); err != nil {
@@ -2,17 +2,19 @@ package mid
 
 import (
 	"context"
-	"log"
 	"net/http"
 	"time"
 
+	"github.com/dapperauteur/go-base-service/foundation/logger"
 	"github.com/dapperauteur/go-base-service/foundation/web"
 	"go.opentelemetry.io/otel/trace"
 )
 
-// Logger writes some information about the request to the logs in the
-// format: TraceID : (200) GET /foo -> IP ADDR (latency)
-func Logger(log *log.Logger) web.Middleware {
+// Logger writes a record to the logs when a request starts and completes.
+// Both records carry the trace_id, span_id, method and path of the request
+// and the completed record adds the status, latency and, for authenticated
+// requests, the subject of the user.
+func Logger(log *logger.Logger) web.Middleware {
 
 	// This is the actual middleware function to be executed.
 	m := func(handler web.Handler) web.Handler {
@@ -31,18 +33,13 @@ func Logger(log *log.Logger) web.Middleware {
 				return web.NewShutdownError("web value missing from context")
 			}
 
-			log.Printf("TraceID %s : started   : %s %s -> %s",
-				v.TraceID,
-				r.Method, r.URL.Path, r.RemoteAddr,
-			)
+			log.Info(ctx, "request started", "remote_addr", r.RemoteAddr)
 
 			// readiness from check.go
 			err := handler(ctx, w, r)
 
-			log.Printf("TraceID %s : completed : %s %s -> %s (%d) (%s)",
-				v.TraceID,
-				r.Method, r.URL.Path, r.RemoteAddr,
-				v.StatusCode, time.Since(v.Now),
+			log.Info(ctx, "request completed", "remote_addr", r.RemoteAddr,
+				"status", v.StatusCode, "latency", time.Since(v.Now),
 			)
 
 			// Return the error so it can be handled further up the chain.
@@ -5,7 +5,10 @@ import (
 	"expvar"
 	"net/http"
 	"runtime"
+	"strconv"
+	"time"
 
+	"github.com/dapperauteur/go-base-service/foundation/metrics"
 	"github.com/dapperauteur/go-base-service/foundation/web"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -21,7 +24,27 @@ var m = struct {
 	err: expvar.NewInt("errors"),
 }
 
-// Metrics updates program counters.
+// pm contains the request metrics exposed in the Prometheus format. Requests
+// are labelled by the route template they matched so ids in the path don't
+// create a series per resource.
+var pm = struct {
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+	inFlight *metrics.GaugeVec
+}{
+	requests: metrics.NewCounterVec("http_requests_total", "Number of requests handled.", "route", "method", "status"),
+	duration: metrics.NewHistogramVec("http_request_duration_seconds", "Time taken to handle a request.", metrics.DefaultBuckets, "route", "method", "status"),
+	inFlight: metrics.NewGaugeVec("http_requests_in_flight", "Number of requests being handled.", "route", "method"),
+}
+
+func init() {
+	metrics.NewGaugeFunc("go_goroutines", "Number of goroutines that currently exist.", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+}
+
+// Metrics updates program counters. It must run outside of Errors so the
+// status of failed requests is known when they are counted.
 func Metrics() web.Middleware {
 
 	// This is the actual middleware function to be executed.
@@ -33,9 +56,23 @@ func Metrics() web.Middleware {
 			ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.mid.metrics")
 			defer span.End()
 
+			// If the context is missing this value, request the service
+			// to be shutdown gracefully.
+			v, ok := ctx.Value(web.KeyValues).(*web.Values)
+			if !ok {
+				return web.NewShutdownError("web value missing from context")
+			}
+
+			pm.inFlight.Add(1, v.Route, r.Method)
+			defer pm.inFlight.Add(-1, v.Route, r.Method)
+
 			// Call the next handler.
 			err := handler(ctx, w, r)
 
+			status := strconv.Itoa(v.StatusCode)
+			pm.requests.Inc(v.Route, r.Method, status)
+			pm.duration.Observe(time.Since(v.Now).Seconds(), v.Route, r.Method, status)
+
 			// Increment the request counter.
 			m.req.Add(1)
 
@@ -45,7 +82,7 @@ func Metrics() web.Middleware {
 			}
 
 			// Increment the errors counter if an error occurred on this request.
-			if err != nil {
+			if err != nil || v.StatusCode >= http.StatusBadRequest {
 				m.err.Add(1)
 			}
 
@@ -2,10 +2,10 @@ package mid
 
 import (
 	"context"
-	"log"
 	"net/http"
 	"runtime/debug"
 
+	"github.com/dapperauteur/go-base-service/foundation/logger"
 	"github.com/dapperauteur/go-base-service/foundation/web"
 	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel/trace"
@@ -13,7 +13,7 @@ import (
 
 // Panics recovers from panics and converts the panic to an error so it is
 // reported in Metrics and handled in Errors.
-func Panics(log *log.Logger) web.Middleware {
+func Panics(log *logger.Logger) web.Middleware {
 
 	// This is the actual middleware function to be executed.
 	m := func(handler web.Handler) web.Handler {
@@ -24,13 +24,6 @@ func Panics(log *log.Logger) web.Middleware {
 			ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.mid.panics")
 			defer span.End()
 
-			// If the context is missing this value, request the service
-			// to be shutdown gracefully.
-			v, ok := ctx.Value(web.KeyValues).(*web.Values)
-			if !ok {
-				return web.NewShutdownError("web value missing from context")
-			}
-
 			// Defer a function to recover from a panic and set the err return
 			// variable after the fact.
 			defer func() {
@@ -38,8 +31,7 @@ func Panics(log *log.Logger) web.Middleware {
 					err = errors.Errorf("PANIC: %v", r)
 
 					// Log the Go stack trace for this panic'd goroutine.
-					log.Printf("TraceID %s : PANIC     :\n%s", v.TraceID, debug.Stack())
-
+					log.Error(ctx, "panic", "error", r, "stack", string(debug.Stack()))
 				}
 			}()
 
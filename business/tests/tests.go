@@ -5,16 +5,18 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/rsa"
-	"fmt"
-	"log"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/dapperauteur/go-base-service/business/auth"
+	"github.com/dapperauteur/go-base-service/business/data/audit"
+	"github.com/dapperauteur/go-base-service/business/data/role"
 	"github.com/dapperauteur/go-base-service/business/data/schema"
+	"github.com/dapperauteur/go-base-service/business/data/token"
 	"github.com/dapperauteur/go-base-service/business/data/user"
 	"github.com/dapperauteur/go-base-service/foundation/database"
+	"github.com/dapperauteur/go-base-service/foundation/logger"
 	"github.com/dapperauteur/go-base-service/foundation/web"
 	"github.com/google/uuid"
 
@@ -39,7 +41,7 @@ var (
 // NewUnit creates a test database inside a Docker container.
 // It creates the required table structure but the database is otherwise empty.
 // It returns the database to use as well as a function to call at the end of the test.
-func NewUnit(t *testing.T) (*log.Logger, *sqlx.DB, func()) {
+func NewUnit(t *testing.T) (*logger.Logger, *sqlx.DB, func()) {
 
 	c := startContainer(t, dbImage, dbPort, dbArgs...)
 
@@ -77,7 +79,7 @@ func NewUnit(t *testing.T) (*log.Logger, *sqlx.DB, func()) {
 		t.Fatalf("database never ready: %v", pingError)
 	}
 
-	if err := schema.Migrate(db); err != nil {
+	if err := schema.Migrate(context.Background(), db); err != nil {
 		stopContainer(t, c.ID)
 		t.Fatalf("migrating error: %s", err)
 	}
@@ -90,7 +92,7 @@ func NewUnit(t *testing.T) (*log.Logger, *sqlx.DB, func()) {
 		stopContainer(t, c.ID)
 	}
 
-	log := log.New(os.Stdout, "TEST : ", log.LstdFlags|log.Lmicroseconds|log.Lshortfile)
+	log := logger.New(os.Stdout, "TEST", logger.LevelDebug)
 
 	return log, db, teardown
 }
@@ -124,7 +126,10 @@ func IntPointer(i int) *int {
 type Test struct {
 	TraceID string
 	DB      *sqlx.DB
-	Log     *log.Logger
+	Users   user.Store
+	Audit   audit.Store
+	Roles   role.Store
+	Log     *logger.Logger
 	Auth    *auth.Auth
 	KID     string
 	// Teardown func()
@@ -137,10 +142,75 @@ type Test struct {
 func NewIntegration(t *testing.T) *Test {
 	log, db, cleanup := NewUnit(t)
 
-	if err := schema.Seed(db); err != nil {
+	if err := schema.Seed(db, schema.SeedTest); err != nil {
 		t.Fatal(err)
 	}
 
+	test := newTest(t, log, cleanup)
+	test.DB = db
+	test.Users = user.NewPostgresStore(log, db)
+	test.Audit = audit.NewPostgresStore(log, db)
+	test.Roles = role.NewPostgresStore(log, db)
+	test.Auth.SetDenylist(token.New(log, db))
+
+	return test
+}
+
+// NewMemoryIntegration constructs an authenticator, an in-memory user store
+// holding the users of the test seed set, an empty in-memory audit log and
+// the built-in roles. No database is started so DB is nil and only the user,
+// role and audit endpoints can be exercised.
+func NewMemoryIntegration(t *testing.T) *Test {
+	log := logger.New(os.Stdout, "TEST", logger.LevelDebug)
+
+	users := user.NewMemoryStore()
+	for _, usr := range seedUsers {
+		if err := users.Create(context.Background(), "", usr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	test := newTest(t, log, func() {})
+	test.Users = users
+	test.Audit = audit.NewMemoryStore()
+	test.Roles = role.NewMemoryStore()
+
+	return test
+}
+
+// seeded is when the users in the test seed set were created and verified.
+var seeded = time.Date(2019, time.March, 24, 0, 0, 0, 0, time.UTC)
+
+// seedUsers mirrors the users in the test seed set. Both passwords are
+// "gophers".
+var seedUsers = []user.Info{
+	{
+		ID:           "5cf37266-3473-4006-984f-9325122678b7",
+		Name:         "Admin Gopher",
+		Email:        "admin@example.com",
+		Roles:        []string{auth.RoleAdmin, auth.RoleUser},
+		PasswordHash: []byte("$2a$10$1ggfMVZV6Js0ybvJufLRUOWHS5f6KneuP0XwwHpJ8L8ipdry9f2/a"),
+		Version:      1,
+		DateCreated:  time.Date(2019, time.March, 24, 0, 0, 0, 0, time.UTC),
+		DateUpdated:  time.Date(2019, time.March, 24, 0, 0, 0, 0, time.UTC),
+		DateVerified: &seeded,
+	},
+	{
+		ID:           "45b5fbd3-755f-4379-8f07-a58d4a30fa2f",
+		Name:         "User Gopher",
+		Email:        "user@example.com",
+		Roles:        []string{auth.RoleUser},
+		PasswordHash: []byte("$2a$10$9/XASPKBbJKVfCAZKDH.UuhsuALDr5vVm6VrYA9VFR8rccK86C1hW"),
+		Version:      1,
+		DateCreated:  time.Date(2019, time.March, 24, 0, 0, 0, 0, time.UTC),
+		DateUpdated:  time.Date(2019, time.March, 24, 0, 0, 0, 0, time.UTC),
+		DateVerified: &seeded,
+	},
+}
+
+// newTest constructs an authenticator with a fresh RSA key.
+func newTest(t *testing.T, log *logger.Logger, cleanup func()) *Test {
+
 	// Create RSA keys to enable authentication in our service.
 	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
@@ -149,21 +219,14 @@ func NewIntegration(t *testing.T) *Test {
 
 	// Build an authenticator using this private key and id for the key store.
 	kidID := "4754d86b-7a6d-4df5-9c65-224741361492"
-	lookup := func(kid string) (*rsa.PublicKey, error) {
-		switch kid {
-		case kidID:
-			return &privateKey.PublicKey, nil
-		}
-		return nil, fmt.Errorf("no public key found for the specified kid: %s", kid)
-	}
-	auth, err := auth.New("RS256", lookup, auth.Keys{kidID: privateKey})
+	keys := auth.Keys{kidID: privateKey}
+	auth, err := auth.New("RS256", nil, keys)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	test := Test{
 		TraceID: "00000000-0000-0000-0000-000000000000",
-		DB:      db,
 		Log:     log,
 		Auth:    auth,
 		KID:     kidID,
@@ -183,7 +246,7 @@ func (test *Test) Teardown() {
 func (test *Test) Token(kid, email, pass string) string {
 	test.t.Log("Generating token for test ...")
 
-	u := user.New(test.Log, test.DB)
+	u := user.NewWithStore(test.Log, test.Users, test.Audit, test.Roles)
 	claims, err := u.Authenticate(context.Background(), test.TraceID, time.Now(), email, pass)
 	if err != nil {
 		test.t.Fatal(err)
@@ -62,11 +62,13 @@ func Open(cfg Config) (*sqlx.DB, error) {
 
 // NamedQueryStruct is a helper function for executing queries that return a
 // single value to be unmarshalled into a struct type.
-func NamedQueryStruct(ctx context.Context, db *sqlx.DB, query string, data interface{}, dest interface{}) error {
-	rows, err := db.NamedQueryContext(ctx, query, data)
+func NamedQueryStruct(ctx context.Context, db Executor, query string, data interface{}, dest interface{}) error {
+	rows, err := sqlx.NamedQueryContext(ctx, db, query, data)
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
+
 	if !rows.Next() {
 		return ErrNotFound
 	}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Set of directions for data ordering.
+const (
+	ASC  = "ASC"
+	DESC = "DESC"
+)
+
+// OrderBy represents a column and direction to sort a query by.
+type OrderBy struct {
+	Field     string
+	Direction string
+}
+
+// ParseOrderBy constructs an OrderBy from a value of the form "field" or
+// "field,direction". Only fields present in the whitelist are accepted and
+// the whitelist maps the public field name to the column used in SQL. An
+// empty value returns the default.
+func ParseOrderBy(value string, whitelist map[string]string, def OrderBy) (OrderBy, error) {
+	if value == "" {
+		return def, nil
+	}
+
+	parts := strings.Split(value, ",")
+
+	column, ok := whitelist[strings.TrimSpace(parts[0])]
+	if !ok {
+		return OrderBy{}, fmt.Errorf("unknown order field %q", parts[0])
+	}
+
+	ob := OrderBy{
+		Field:     column,
+		Direction: ASC,
+	}
+
+	switch len(parts) {
+	case 1:
+	case 2:
+		dir := strings.ToUpper(strings.TrimSpace(parts[1]))
+		if dir != ASC && dir != DESC {
+			return OrderBy{}, fmt.Errorf("unknown order direction %q", parts[1])
+		}
+		ob.Direction = dir
+	default:
+		return OrderBy{}, fmt.Errorf("unknown order format %q", value)
+	}
+
+	return ob, nil
+}
+
+// Builder assembles the WHERE and ORDER BY clauses of a SELECT statement from
+// a set of optional predicates. Positional parameters are numbered in the
+// order arguments are added so the clauses can be combined with any other
+// parameters the caller adds through Arg.
+type Builder struct {
+	where   []string
+	args    []interface{}
+	orderBy []OrderBy
+}
+
+// Arg adds an argument to the query and returns its positional parameter.
+func (b *Builder) Arg(arg interface{}) string {
+	b.args = append(b.args, arg)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+// Where adds a predicate to the query. Every ? in the clause is replaced, in
+// order, with the positional parameter of the matching argument. Predicates
+// are combined with AND.
+func (b *Builder) Where(clause string, args ...interface{}) {
+	var sb strings.Builder
+	var n int
+	for _, r := range clause {
+		if r == '?' && n < len(args) {
+			sb.WriteString(b.Arg(args[n]))
+			n++
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	b.where = append(b.where, "("+sb.String()+")")
+}
+
+// OrderBy adds a sort column to the query. Columns are applied in the order
+// they are added.
+func (b *Builder) OrderBy(ob OrderBy) {
+	b.orderBy = append(b.orderBy, ob)
+}
+
+// Args returns the arguments for the positional parameters of the query.
+func (b *Builder) Args() []interface{} {
+	return b.args
+}
+
+// WhereClause returns the WHERE clause of the query or an empty string when
+// no predicates were added.
+func (b *Builder) WhereClause() string {
+	if len(b.where) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(b.where, " AND ")
+}
+
+// OrderByClause returns the ORDER BY clause of the query or an empty string
+// when no sort columns were added.
+func (b *Builder) OrderByClause() string {
+	if len(b.orderBy) == 0 {
+		return ""
+	}
+
+	cols := make([]string, len(b.orderBy))
+	for i, ob := range b.orderBy {
+		cols[i] = ob.Field + " " + ob.Direction
+	}
+	return "ORDER BY " + strings.Join(cols, ", ")
+}
+
+// EscapeLike escapes the wildcard characters of a LIKE pattern so a user
+// supplied value is matched literally.
+func EscapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
@@ -0,0 +1,136 @@
+package database_test
+
+import (
+	"testing"
+
+	"github.com/dapperauteur/go-base-service/foundation/database"
+	"github.com/google/go-cmp/cmp"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestParseOrderBy(t *testing.T) {
+	whitelist := map[string]string{
+		"id":   "user_id",
+		"name": "name",
+	}
+	def := database.OrderBy{Field: "user_id", Direction: database.ASC}
+
+	tt := []struct {
+		value string
+		exp   database.OrderBy
+		fail  bool
+	}{
+		{"", def, false},
+		{"name", database.OrderBy{Field: "name", Direction: database.ASC}, false},
+		{"id,desc", database.OrderBy{Field: "user_id", Direction: database.DESC}, false},
+		{" name , Asc ", database.OrderBy{Field: "name", Direction: database.ASC}, false},
+		{"user_id", database.OrderBy{}, true},
+		{"name;DROP TABLE users", database.OrderBy{}, true},
+		{"name,sideways", database.OrderBy{}, true},
+		{"name,asc,desc", database.OrderBy{}, true},
+	}
+
+	t.Log("Given the need to only sort by whitelisted fields.")
+	{
+		for testID, tst := range tt {
+			t.Logf("\tTest %d:\tWhen parsing %q.", testID, tst.value)
+			{
+				got, err := database.ParseOrderBy(tst.value, whitelist, def)
+				if tst.fail {
+					if err == nil {
+						t.Fatalf("\t%s\tTest %d:\tShould reject the value : got %+v.", failed, testID, got)
+					}
+					t.Logf("\t%s\tTest %d:\tShould reject the value.", success, testID)
+					continue
+				}
+
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould parse the value : %s.", failed, testID, err)
+				}
+				if diff := cmp.Diff(tst.exp, got); diff != "" {
+					t.Fatalf("\t%s\tTest %d:\tShould get the expected order. Diff:\n%s", failed, testID, diff)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get the expected order.", success, testID)
+			}
+		}
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	t.Log("Given the need to build optional query clauses.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen nothing is added.", testID)
+		{
+			var b database.Builder
+			if b.WhereClause() != "" || b.OrderByClause() != "" || len(b.Args()) != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould get empty clauses : %q %q %v.", failed, testID, b.WhereClause(), b.OrderByClause(), b.Args())
+			}
+			t.Logf("\t%s\tTest %d:\tShould get empty clauses.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen predicates, arguments and sorts are mixed.", testID)
+		{
+			var b database.Builder
+			b.Where("deleted_at IS NULL")
+			b.Where("name ILIKE ? OR email ILIKE ?", "a%", "b%")
+			limit := b.Arg(10)
+			b.Where("date_created >= ?", "2019-01-01")
+			b.OrderBy(database.OrderBy{Field: "name", Direction: database.DESC})
+			b.OrderBy(database.OrderBy{Field: "user_id", Direction: database.ASC})
+
+			exp := "WHERE (deleted_at IS NULL) AND (name ILIKE $1 OR email ILIKE $2) AND (date_created >= $4)"
+			if got := b.WhereClause(); got != exp {
+				t.Fatalf("\t%s\tTest %d:\tShould number the placeholders in order : got %q, exp %q.", failed, testID, got, exp)
+			}
+			t.Logf("\t%s\tTest %d:\tShould number the placeholders in order.", success, testID)
+
+			if limit != "$3" {
+				t.Fatalf("\t%s\tTest %d:\tShould number a plain argument in order : got %s.", failed, testID, limit)
+			}
+			t.Logf("\t%s\tTest %d:\tShould number a plain argument in order.", success, testID)
+
+			if diff := cmp.Diff([]interface{}{"a%", "b%", 10, "2019-01-01"}, b.Args()); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the arguments in order. Diff:\n%s", failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould keep the arguments in order.", success, testID)
+
+			if got, exp := b.OrderByClause(), "ORDER BY name DESC, user_id ASC"; got != exp {
+				t.Fatalf("\t%s\tTest %d:\tShould sort by every column in order : got %q, exp %q.", failed, testID, got, exp)
+			}
+			t.Logf("\t%s\tTest %d:\tShould sort by every column in order.", success, testID)
+		}
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	tt := []struct {
+		value string
+		exp   string
+	}{
+		{"gopher", "gopher"},
+		{"100%", `100\%`},
+		{"first_name", `first\_name`},
+		{`C:\path`, `C:\\path`},
+		{`\%_`, `\\\%\_`},
+	}
+
+	t.Log("Given the need to match user input literally in LIKE patterns.")
+	{
+		for testID, tst := range tt {
+			t.Logf("\tTest %d:\tWhen escaping %q.", testID, tst.value)
+			{
+				if got := database.EscapeLike(tst.value); got != tst.exp {
+					t.Fatalf("\t%s\tTest %d:\tShould escape the wildcards : got %q, exp %q.", failed, testID, got, tst.exp)
+				}
+				t.Logf("\t%s\tTest %d:\tShould escape the wildcards.", success, testID)
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Executor is the set of behavior shared by *sqlx.DB and *sqlx.Tx. Packages
+// that accept an Executor run their queries the same way whether or not they
+// are part of a transaction.
+type Executor interface {
+	sqlx.ExtContext
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+}
+
+// Make sure both types keep satisfying the interface.
+var (
+	_ Executor = (*sqlx.DB)(nil)
+	_ Executor = (*sqlx.Tx)(nil)
+)
+
+// WithTx runs fn inside a transaction. The transaction is committed when fn
+// returns nil and rolled back when it returns an error or panics. The ctx is
+// used for the whole transaction so cancelling it rolls back the work.
+func WithTx(ctx context.Context, db *sqlx.DB, fn func(tx *sqlx.Tx) error) (err error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rerr := tx.Rollback(); rerr != nil && rerr != sql.ErrTxDone {
+			return errors.Wrapf(err, "rolling back: %v", rerr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing transaction")
+	}
+
+	return nil
+}
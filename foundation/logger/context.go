@@ -0,0 +1,59 @@
+package logger
+
+import (
+	"context"
+	"sync"
+)
+
+// ctxKey represents the type of value for the context key.
+type ctxKey int
+
+// key is used to store/retrieve the fields of a context.
+const key ctxKey = 1
+
+// fieldSet holds the fields shared by every record logged with a context.
+// It is mutable so fields added deep in a call chain, like the subject of an
+// authenticated request, show up in records logged further up the chain.
+type fieldSet struct {
+	mu sync.Mutex
+	kv []interface{}
+}
+
+// NewContext returns a context that carries its own set of fields, starting
+// with any fields already carried by ctx.
+func NewContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, key, &fieldSet{kv: contextFields(ctx)})
+}
+
+// AddFields adds the key/value pairs to every record logged with ctx or any
+// context derived from the one returned by NewContext. If ctx doesn't carry
+// a set of fields yet, a new one is created.
+func AddFields(ctx context.Context, kv ...interface{}) context.Context {
+	fs, ok := ctx.Value(key).(*fieldSet)
+	if !ok {
+		fs = &fieldSet{}
+		ctx = context.WithValue(ctx, key, fs)
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.kv = append(fs.kv, kv...)
+
+	return ctx
+}
+
+// contextFields returns a copy of the fields carried by ctx.
+func contextFields(ctx context.Context) []interface{} {
+	if ctx == nil {
+		return nil
+	}
+
+	fs, ok := ctx.Value(key).(*fieldSet)
+	if !ok {
+		return nil
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return append([]interface{}(nil), fs.kv...)
+}
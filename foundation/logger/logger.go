@@ -0,0 +1,222 @@
+// Package logger provides support for leveled, structured JSON logging.
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level represents the severity of a log record.
+type Level int
+
+// Set of levels a record can be logged at.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String returns the name of the level as written to the logs.
+func (lvl Level) String() string {
+	switch lvl {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return "level(" + strconv.Itoa(int(lvl)) + ")"
+}
+
+// ParseLevel converts a level name into a Level.
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", name)
+}
+
+// Logger writes records as single line JSON documents. Every record holds
+// the time, level, service, caller and message, followed by the fields of
+// the logger, the fields carried by the context and the fields provided in
+// the call, in that order. A later field replaces an earlier one with the
+// same key.
+type Logger struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	level  Level
+	fields []interface{}
+}
+
+// New constructs a Logger that writes records at or above the specified
+// level to w.
+func New(w io.Writer, service string, level Level) *Logger {
+	return &Logger{
+		mu:     &sync.Mutex{},
+		w:      w,
+		level:  level,
+		fields: []interface{}{"service", service},
+	}
+}
+
+// With returns a Logger that adds the key/value pairs to every record.
+func (l *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(fields, l.fields...)
+	fields = append(fields, kv...)
+
+	return &Logger{
+		mu:     l.mu,
+		w:      l.w,
+		level:  l.level,
+		fields: fields,
+	}
+}
+
+// WithLevel returns a Logger that only writes records at or above the
+// specified level.
+func (l *Logger) WithLevel(level Level) *Logger {
+	return &Logger{
+		mu:     l.mu,
+		w:      l.w,
+		level:  level,
+		fields: l.fields,
+	}
+}
+
+// Debug logs a record at LevelDebug.
+func (l *Logger) Debug(ctx context.Context, msg string, kv ...interface{}) {
+	l.write(ctx, LevelDebug, 2, msg, kv)
+}
+
+// Info logs a record at LevelInfo.
+func (l *Logger) Info(ctx context.Context, msg string, kv ...interface{}) {
+	l.write(ctx, LevelInfo, 2, msg, kv)
+}
+
+// Warn logs a record at LevelWarn.
+func (l *Logger) Warn(ctx context.Context, msg string, kv ...interface{}) {
+	l.write(ctx, LevelWarn, 2, msg, kv)
+}
+
+// Error logs a record at LevelError.
+func (l *Logger) Error(ctx context.Context, msg string, kv ...interface{}) {
+	l.write(ctx, LevelError, 2, msg, kv)
+}
+
+// StdLogger returns a standard library logger that writes each line it is
+// given as a record at the specified level. It is used for packages that
+// only know how to log through a *log.Logger.
+func (l *Logger) StdLogger(level Level) *log.Logger {
+	return log.New(stdWriter{l: l, level: level}, "", 0)
+}
+
+// write encodes and writes a single record. The skip value is the number of
+// stack frames between write and the caller to report.
+func (l *Logger) write(ctx context.Context, level Level, skip int, msg string, kv []interface{}) {
+	if level < l.level {
+		return
+	}
+
+	caller := "???"
+	if _, file, line, ok := runtime.Caller(skip); ok {
+		caller = filepath.Base(filepath.Dir(file)) + "/" + filepath.Base(file) + ":" + strconv.Itoa(line)
+	}
+
+	// Collect the fields so later keys replace earlier ones but keep the
+	// position of the first occurrence.
+	var keys []string
+	values := make(map[string]interface{})
+	add := func(pairs []interface{}) {
+		for i := 0; i < len(pairs); i += 2 {
+			key := fmt.Sprint(pairs[i])
+			var value interface{} = "MISSING"
+			if i+1 < len(pairs) {
+				value = pairs[i+1]
+			}
+			if _, exists := values[key]; !exists {
+				keys = append(keys, key)
+			}
+			values[key] = value
+		}
+	}
+	add(l.fields)
+	add(contextFields(ctx))
+	add(kv)
+
+	var b bytes.Buffer
+	b.WriteString(`{"ts":`)
+	writeJSON(&b, time.Now().UTC().Format(time.RFC3339Nano))
+	b.WriteString(`,"level":`)
+	writeJSON(&b, level.String())
+	b.WriteString(`,"caller":`)
+	writeJSON(&b, caller)
+	b.WriteString(`,"msg":`)
+	writeJSON(&b, msg)
+	for _, key := range keys {
+		b.WriteByte(',')
+		writeJSON(&b, key)
+		b.WriteByte(':')
+		writeJSON(&b, values[key])
+	}
+	b.WriteString("}\n")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(b.Bytes())
+}
+
+// writeJSON encodes a single value. Errors and durations are written as
+// text and values that can't be encoded fall back to their fmt form.
+func writeJSON(b *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case time.Duration:
+		value = v.String()
+	case fmt.Stringer:
+		value = v.String()
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+	b.Write(data)
+}
+
+// =============================================================================
+
+// stdWriter adapts a Logger to the io.Writer used by a standard library
+// logger.
+type stdWriter struct {
+	l     *Logger
+	level Level
+}
+
+// Write logs p as the message of a record.
+func (w stdWriter) Write(p []byte) (int, error) {
+	w.l.write(context.Background(), w.level, 4, strings.TrimSpace(string(p)), nil)
+	return len(p), nil
+}
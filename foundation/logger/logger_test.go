@@ -0,0 +1,195 @@
+package logger_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dapperauteur/go-base-service/foundation/logger"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+// records decodes every line written to the buffer.
+func records(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+
+	var recs []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var rec map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("record is not JSON : %s : %q", err, line)
+		}
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+func TestLevels(t *testing.T) {
+	t.Log("Given the need to filter records by level.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen logging at every level with an info logger.", testID)
+		{
+			var buf bytes.Buffer
+			log := logger.New(&buf, "TEST", logger.LevelInfo)
+			ctx := context.Background()
+
+			log.Debug(ctx, "debug")
+			log.Info(ctx, "info")
+			log.Warn(ctx, "warn")
+			log.Error(ctx, "error")
+
+			recs := records(t, &buf)
+			if len(recs) != 3 || recs[0]["level"] != "info" || recs[1]["level"] != "warn" || recs[2]["level"] != "error" {
+				t.Fatalf("\t%s\tTest %d:\tShould only write records at or above info : %s", failed, testID, buf.String())
+			}
+			t.Logf("\t%s\tTest %d:\tShould only write records at or above info.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen changing the level of a logger.", testID)
+		{
+			var buf bytes.Buffer
+			log := logger.New(&buf, "TEST", logger.LevelInfo)
+			ctx := context.Background()
+
+			log.WithLevel(logger.LevelDebug).Debug(ctx, "debug")
+			log.WithLevel(logger.LevelError).Warn(ctx, "warn")
+			log.Debug(ctx, "debug")
+
+			recs := records(t, &buf)
+			if len(recs) != 1 || recs[0]["msg"] != "debug" {
+				t.Fatalf("\t%s\tTest %d:\tShould only change the level of the derived logger : %s", failed, testID, buf.String())
+			}
+			t.Logf("\t%s\tTest %d:\tShould only change the level of the derived logger.", success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen parsing level names.", testID)
+		{
+			for name, exp := range map[string]logger.Level{"debug": logger.LevelDebug, "INFO": logger.LevelInfo, "Warn": logger.LevelWarn, "error": logger.LevelError} {
+				lvl, err := logger.ParseLevel(name)
+				if err != nil || lvl != exp {
+					t.Fatalf("\t%s\tTest %d:\tShould parse %q : got %v, %v", failed, testID, name, lvl, err)
+				}
+			}
+			if _, err := logger.ParseLevel("loud"); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould reject an unknown level.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould parse the level names and reject unknown ones.", success, testID)
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+	t.Log("Given the need to add fields to records.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen fields come from the logger, the context and the call.", testID)
+		{
+			var buf bytes.Buffer
+			log := logger.New(&buf, "TEST", logger.LevelDebug).With("component", "api", "who", "logger")
+
+			ctx := logger.NewContext(context.Background())
+			logger.AddFields(ctx, "trace_id", "abc", "who", "context")
+
+			log.Info(ctx, "hello", "who", "call", "took", time.Second, "error", errors.New("boom"))
+
+			line := strings.TrimSpace(buf.String())
+			order := []string{`"ts":`, `"level":"info"`, `"caller":"logger/logger_test.go:`, `"msg":"hello"`, `"service":"TEST"`, `"component":"api"`, `"who":"call"`, `"trace_id":"abc"`, `"took":"1s"`, `"error":"boom"`}
+			pos := -1
+			for _, part := range order {
+				i := strings.Index(line, part)
+				if i <= pos {
+					t.Fatalf("\t%s\tTest %d:\tShould write %s in order : %s", failed, testID, part, line)
+				}
+				pos = i
+			}
+			t.Logf("\t%s\tTest %d:\tShould write the fields in order.", success, testID)
+
+			if strings.Count(line, `"who"`) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould replace a key given again : %s", failed, testID, line)
+			}
+			t.Logf("\t%s\tTest %d:\tShould replace a key given again, keeping its first position.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen a value is missing from the key/value pairs.", testID)
+		{
+			var buf bytes.Buffer
+			log := logger.New(&buf, "TEST", logger.LevelDebug)
+
+			log.Info(context.Background(), "odd", "a", 1, "b")
+
+			recs := records(t, &buf)
+			if len(recs) != 1 || recs[0]["a"] != float64(1) || recs[0]["b"] != "MISSING" {
+				t.Fatalf("\t%s\tTest %d:\tShould mark the value as missing : %s", failed, testID, buf.String())
+			}
+			t.Logf("\t%s\tTest %d:\tShould mark the value as missing.", success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen fields are added to derived contexts.", testID)
+		{
+			var buf bytes.Buffer
+			log := logger.New(&buf, "TEST", logger.LevelDebug)
+
+			parent := logger.AddFields(context.Background(), "request", "1")
+			child := logger.NewContext(parent)
+			logger.AddFields(child, "user", "ann")
+
+			// Fields added through a derived context are seen by the context
+			// that was passed on, like a handler adding the subject.
+			derived, cancel := context.WithCancel(child)
+			defer cancel()
+			logger.AddFields(derived, "route", "/me")
+
+			log.Info(parent, "parent")
+			log.Info(child, "child")
+
+			recs := records(t, &buf)
+			if len(recs) != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould write two records : %s", failed, testID, buf.String())
+			}
+			if _, ok := recs[0]["user"]; ok || recs[0]["request"] != "1" {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the parent fields apart : %v", failed, testID, recs[0])
+			}
+			if recs[1]["request"] != "1" || recs[1]["user"] != "ann" || recs[1]["route"] != "/me" {
+				t.Fatalf("\t%s\tTest %d:\tShould carry the parent fields and its own : %v", failed, testID, recs[1])
+			}
+			t.Logf("\t%s\tTest %d:\tShould carry the parent fields and keep its own apart.", success, testID)
+		}
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	t.Log("Given the need to log through a standard library logger.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen printing a line.", testID)
+		{
+			var buf bytes.Buffer
+			log := logger.New(&buf, "TEST", logger.LevelDebug)
+
+			log.StdLogger(logger.LevelWarn).Println("http: TLS handshake error")
+
+			recs := records(t, &buf)
+			if len(recs) != 1 || recs[0]["level"] != "warn" || recs[0]["msg"] != "http: TLS handshake error" {
+				t.Fatalf("\t%s\tTest %d:\tShould write the line as the message : %s", failed, testID, buf.String())
+			}
+			t.Logf("\t%s\tTest %d:\tShould write the line as the message.", success, testID)
+		}
+	}
+}
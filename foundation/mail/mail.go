@@ -0,0 +1,134 @@
+// Package mail provides support for sending email.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer declares the behavior for sending email.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPConfig is the required properties to send email through an SMTP
+// server. Username can be left empty for servers that don't require
+// authentication.
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// smtpMailer sends email through an SMTP server.
+type smtpMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTP constructs a Mailer that sends email through an SMTP server.
+func NewSMTP(cfg SMTPConfig) Mailer {
+	m := smtpMailer{
+		addr: net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		from: cfg.From,
+	}
+	if cfg.Username != "" {
+		m.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	return m
+}
+
+// Send delivers the message to the SMTP server. The standard library client
+// does not take a context, so a canceled context only stops a message that
+// has not been handed over yet.
+func (m smtpMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := format(m.from, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, data); err != nil {
+		return errors.Wrapf(err, "sending mail to %s", msg.To)
+	}
+
+	return nil
+}
+
+// fileMailer writes every message to a writer instead of sending it.
+type fileMailer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewFile constructs a Mailer that writes messages to w, one after the
+// other. It is meant for local development and tests where no mail server
+// is available.
+func NewFile(w io.Writer) Mailer {
+	return &fileMailer{w: w}
+}
+
+// Send writes the message to the writer.
+func (m *fileMailer) Send(ctx context.Context, msg Message) error {
+	data, err := format("", msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.w.Write(append(data, '\n')); err != nil {
+		return errors.Wrapf(err, "writing mail to %s", msg.To)
+	}
+
+	return nil
+}
+
+// format renders a message with its headers. Headers are rejected when they
+// contain line breaks so they can't be used to inject more headers.
+func format(from string, msg Message, now time.Time) ([]byte, error) {
+	for _, h := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(h, "\r\n") {
+			return nil, errors.New("mail header contains a line break")
+		}
+	}
+
+	var b bytes.Buffer
+	if from != "" {
+		fmt.Fprintf(&b, "From: %s\r\n", from)
+	}
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+
+	return b.Bytes(), nil
+}
@@ -0,0 +1,373 @@
+// Package metrics provides support for collecting metrics and exposing them in
+// the Prometheus text format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the histogram buckets, in seconds, used for request
+// latencies.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector is the behavior every metric registered with a Registry has.
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds a set of metrics and writes them in the text format.
+type Registry struct {
+	mu         sync.Mutex
+	names      map[string]bool
+	collectors []collector
+}
+
+// NewRegistry constructs an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		names: make(map[string]bool),
+	}
+}
+
+// register adds a metric to the registry. Registering the same name twice is
+// a programming error.
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.names[name] {
+		panic(fmt.Sprintf("metrics: duplicate metric %q", name))
+	}
+	r.names[name] = true
+	r.collectors = append(r.collectors, c)
+}
+
+// ServeHTTP implements the http.Handler interface by writing every metric in
+// the Prometheus text format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	bw.Flush()
+}
+
+// =============================================================================
+
+// Default is the registry used by the package level functions. It is served
+// by Handler.
+var Default = NewRegistry()
+
+// Handler returns the http.Handler that serves the Default registry.
+func Handler() http.Handler {
+	return Default
+}
+
+// NewCounterVec registers a CounterVec with the Default registry.
+func NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labels...)
+}
+
+// NewGaugeVec registers a GaugeVec with the Default registry.
+func NewGaugeVec(name string, help string, labels ...string) *GaugeVec {
+	return Default.NewGaugeVec(name, help, labels...)
+}
+
+// NewHistogramVec registers a HistogramVec with the Default registry.
+func NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	return Default.NewHistogramVec(name, help, buckets, labels...)
+}
+
+// NewGaugeFunc registers a GaugeFunc with the Default registry.
+func NewGaugeFunc(name string, help string, fn func() float64) {
+	Default.NewGaugeFunc(name, help, fn)
+}
+
+// NewCounterFunc registers a CounterFunc with the Default registry.
+func NewCounterFunc(name string, help string, fn func() float64) {
+	Default.NewCounterFunc(name, help, fn)
+}
+
+// =============================================================================
+
+// vec holds the values of a metric for every combination of label values
+// seen so far.
+type vec struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string][]string
+}
+
+// key validates the label values and returns the key of their series.
+func (v *vec) key(values []string) string {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+	if _, exists := v.series[key]; !exists {
+		v.series[key] = append([]string(nil), values...)
+	}
+	return key
+}
+
+// keys returns the keys of every series in a stable order.
+func (v *vec) keys() []string {
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// header writes the HELP and TYPE lines of the metric.
+func (v *vec) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.kind)
+}
+
+// sample writes a single sample line.
+func (v *vec) sample(w *bufio.Writer, name string, values []string, extra string, value float64) {
+	w.WriteString(name)
+
+	pairs := make([]string, 0, len(values)+1)
+	for i, label := range v.labels {
+		pairs = append(pairs, label+`="`+escapeLabel(values[i])+`"`)
+	}
+	if extra != "" {
+		pairs = append(pairs, extra)
+	}
+	if len(pairs) > 0 {
+		w.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+
+	w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+// =============================================================================
+
+// CounterVec is a set of counters that only go up, partitioned by labels.
+type CounterVec struct {
+	vec
+	values map[string]float64
+}
+
+// NewCounterVec registers a CounterVec with the registry.
+func (r *Registry) NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	c := CounterVec{
+		vec:    vec{name: name, help: help, kind: "counter", labels: labels, series: make(map[string][]string)},
+		values: make(map[string]float64),
+	}
+	r.register(name, &c)
+	return &c
+}
+
+// Inc adds one to the counter for the label values.
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds delta, which must not be negative, to the counter for the label
+// values.
+func (c *CounterVec) Add(delta float64, values ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("metrics: counter %s can't decrease", c.name))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[c.key(values)] += delta
+}
+
+// write implements the collector interface.
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.header(w)
+	for _, key := range c.keys() {
+		c.sample(w, c.name, c.series[key], "", c.values[key])
+	}
+}
+
+// =============================================================================
+
+// GaugeVec is a set of values that can go up and down, partitioned by labels.
+type GaugeVec struct {
+	vec
+	values map[string]float64
+}
+
+// NewGaugeVec registers a GaugeVec with the registry.
+func (r *Registry) NewGaugeVec(name string, help string, labels ...string) *GaugeVec {
+	g := GaugeVec{
+		vec:    vec{name: name, help: help, kind: "gauge", labels: labels, series: make(map[string][]string)},
+		values: make(map[string]float64),
+	}
+	r.register(name, &g)
+	return &g
+}
+
+// Set sets the gauge for the label values.
+func (g *GaugeVec) Set(value float64, values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[g.key(values)] = value
+}
+
+// Add adds delta, which may be negative, to the gauge for the label values.
+func (g *GaugeVec) Add(delta float64, values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[g.key(values)] += delta
+}
+
+// write implements the collector interface.
+func (g *GaugeVec) write(w *bufio.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.header(w)
+	for _, key := range g.keys() {
+		g.sample(w, g.name, g.series[key], "", g.values[key])
+	}
+}
+
+// =============================================================================
+
+// histogram holds the observations of a single series.
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec is a set of histograms, partitioned by labels, that count
+// observations in cumulative buckets.
+type HistogramVec struct {
+	vec
+	buckets []float64
+	values  map[string]*histogram
+}
+
+// NewHistogramVec registers a HistogramVec with the registry. The buckets are
+// the sorted upper bounds of each bucket; a +Inf bucket is always added.
+func (r *Registry) NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := HistogramVec{
+		vec:     vec{name: name, help: help, kind: "histogram", labels: labels, series: make(map[string][]string)},
+		buckets: append([]float64(nil), buckets...),
+		values:  make(map[string]*histogram),
+	}
+	sort.Float64s(h.buckets)
+	r.register(name, &h)
+	return &h
+}
+
+// Observe adds a single observation to the histogram for the label values.
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := h.key(values)
+	hist, exists := h.values[key]
+	if !exists {
+		hist = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hist
+	}
+
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		hist.counts[i]++
+	}
+	hist.count++
+	hist.sum += value
+}
+
+// write implements the collector interface.
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.header(w)
+	for _, key := range h.keys() {
+		hist := h.values[key]
+		values := h.series[key]
+
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += hist.counts[i]
+			h.sample(w, h.name+"_bucket", values, `le="`+formatFloat(bound)+`"`, float64(cumulative))
+		}
+		h.sample(w, h.name+"_bucket", values, `le="+Inf"`, float64(hist.count))
+		h.sample(w, h.name+"_sum", values, "", hist.sum)
+		h.sample(w, h.name+"_count", values, "", float64(hist.count))
+	}
+}
+
+// =============================================================================
+
+// funcMetric is a metric without labels whose value is read when the metrics
+// are written.
+type funcMetric struct {
+	vec
+	fn func() float64
+}
+
+// NewGaugeFunc registers a gauge whose value is returned by fn.
+func (r *Registry) NewGaugeFunc(name string, help string, fn func() float64) {
+	r.register(name, &funcMetric{vec: vec{name: name, help: help, kind: "gauge"}, fn: fn})
+}
+
+// NewCounterFunc registers a counter whose value is returned by fn. The value
+// must never decrease.
+func (r *Registry) NewCounterFunc(name string, help string, fn func() float64) {
+	r.register(name, &funcMetric{vec: vec{name: name, help: help, kind: "counter"}, fn: fn})
+}
+
+// write implements the collector interface.
+func (f *funcMetric) write(w *bufio.Writer) {
+	f.header(w)
+	f.sample(w, f.name, nil, "", f.fn())
+}
+
+// =============================================================================
+
+// formatFloat formats a sample value the way the text format expects.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escapeHelp escapes the backslashes and line feeds of a HELP line.
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+// escapeLabel escapes the backslashes, double quotes and line feeds of a
+// label value.
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
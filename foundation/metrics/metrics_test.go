@@ -0,0 +1,141 @@
+package metrics_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dapperauteur/go-base-service/foundation/metrics"
+	"github.com/google/go-cmp/cmp"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+// scrape returns what the registry serves.
+func scrape(t *testing.T, r *metrics.Registry) string {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	return w.Body.String()
+}
+
+func TestHistogram(t *testing.T) {
+	t.Log("Given the need to count observations in cumulative buckets.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen observing values on, between and above the bounds.", testID)
+		{
+			r := metrics.NewRegistry()
+			h := r.NewHistogramVec("latency_seconds", "Request latency.", []float64{1, 0.5}, "route")
+
+			h.Observe(0.5, "/a")
+			h.Observe(0.75, "/a")
+			h.Observe(1, "/a")
+			h.Observe(3, "/a")
+			h.Observe(0.1, "/b")
+
+			exp := `# HELP latency_seconds Request latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a",le="0.5"} 1
+latency_seconds_bucket{route="/a",le="1"} 3
+latency_seconds_bucket{route="/a",le="+Inf"} 4
+latency_seconds_sum{route="/a"} 5.25
+latency_seconds_count{route="/a"} 4
+latency_seconds_bucket{route="/b",le="0.5"} 1
+latency_seconds_bucket{route="/b",le="1"} 1
+latency_seconds_bucket{route="/b",le="+Inf"} 1
+latency_seconds_sum{route="/b"} 0.1
+latency_seconds_count{route="/b"} 1
+`
+			if diff := cmp.Diff(exp, scrape(t, r)); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould count a value on a bound in that bucket, cumulatively. Diff:\n%s", failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould count a value on a bound in that bucket, cumulatively.", success, testID)
+		}
+	}
+}
+
+func TestCounterGauge(t *testing.T) {
+	t.Log("Given the need to expose counters and gauges.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen label values and help need escaping.", testID)
+		{
+			r := metrics.NewRegistry()
+			c := r.NewCounterVec("requests_total", "Requests by path,\nwith a \\ in it.", "path", "code")
+			g := r.NewGaugeVec("inflight", "Requests in flight.")
+			r.NewCounterFunc("uptime_seconds", "Seconds since start.", func() float64 { return 42 })
+
+			c.Inc(`/say "hi"`, "200")
+			c.Add(2, `/say "hi"`, "200")
+			c.Inc("C:\\tmp\nx", "500")
+			g.Add(3)
+			g.Add(-1)
+
+			exp := `# HELP requests_total Requests by path,\nwith a \\ in it.
+# TYPE requests_total counter
+requests_total{path="/say \"hi\"",code="200"} 3
+requests_total{path="C:\\tmp\nx",code="500"} 1
+# HELP inflight Requests in flight.
+# TYPE inflight gauge
+inflight 2
+# HELP uptime_seconds Seconds since start.
+# TYPE uptime_seconds counter
+uptime_seconds 42
+`
+			if diff := cmp.Diff(exp, scrape(t, r)); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould escape the help and label values. Diff:\n%s", failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould escape the help and label values.", success, testID)
+		}
+	}
+}
+
+func TestPanics(t *testing.T) {
+	tt := []struct {
+		name string
+		fn   func(r *metrics.Registry)
+	}{
+		{"duplicate name", func(r *metrics.Registry) {
+			r.NewCounterVec("dup", "First.")
+			r.NewGaugeFunc("dup", "Second.", func() float64 { return 0 })
+		}},
+		{"wrong label count", func(r *metrics.Registry) {
+			r.NewCounterVec("labelled", "Labelled.", "a", "b").Inc("x")
+		}},
+		{"decreasing counter", func(r *metrics.Registry) {
+			r.NewCounterVec("down", "Down.").Add(-1)
+		}},
+	}
+
+	t.Log("Given the need to catch programming errors early.")
+	{
+		for testID, tst := range tt {
+			t.Logf("\tTest %d:\tWhen registering or updating with a %s.", testID, tst.name)
+			{
+				err := func() (err error) {
+					defer func() {
+						if r := recover(); r != nil {
+							err = fmt.Errorf("%v", r)
+						}
+					}()
+					tst.fn(metrics.NewRegistry())
+					return nil
+				}()
+				if err == nil {
+					t.Fatalf("\t%s\tTest %d:\tShould panic.", failed, testID)
+				}
+				t.Logf("\t%s\tTest %d:\tShould panic : %s.", success, testID, err)
+			}
+		}
+	}
+}
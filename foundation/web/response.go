@@ -2,13 +2,24 @@ package web
 
 import (
 	"context"
+	"encoding/csv"
 	"encoding/json"
+	"mime"
 	"net/http"
+	"strings"
 
 	"github.com/pkg/errors"
 )
 
-// Respond converts a Go value to JSON and sends it to the client.
+// CSVMarshaler is implemented by response values that can also be rendered
+// as CSV. The first row returned is expected to be the header.
+type CSVMarshaler interface {
+	MarshalCSV() ([][]string, error)
+}
+
+// Respond converts a Go value to JSON and sends it to the client. If the
+// client asked for text/csv and the value implements CSVMarshaler, the value
+// is sent as CSV instead.
 func Respond(ctx context.Context, w http.ResponseWriter, data interface{}, statusCode int) error {
 
 	// Set the status code for the request logger middleware.
@@ -26,6 +37,11 @@ func Respond(ctx context.Context, w http.ResponseWriter, data interface{}, statu
 		return nil
 	}
 
+	// Honor a request for CSV when the value knows how to produce it.
+	if m, ok := data.(CSVMarshaler); ok && acceptsCSV(v.Accept) {
+		return respondCSV(w, m, statusCode)
+	}
+
 	// Convert the response value to JSON.
 	jsonData, err := json.Marshal(data)
 	if err != nil {
@@ -47,6 +63,39 @@ func Respond(ctx context.Context, w http.ResponseWriter, data interface{}, statu
 
 }
 
+// respondCSV writes the rows produced by the value as a CSV document.
+func respondCSV(w http.ResponseWriter, m CSVMarshaler, statusCode int) error {
+	rows, err := m.MarshalCSV()
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.WriteHeader(statusCode)
+
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// acceptsCSV reports whether the Accept header lists text/csv as one of
+// the media types the client is willing to receive.
+func acceptsCSV(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if mediaType == "text/csv" {
+			return true
+		}
+	}
+	return false
+}
+
 // RespondError sends an error reponse back to the client.
 func RespondError(ctx context.Context, w http.ResponseWriter, err error) error {
 
@@ -0,0 +1,68 @@
+package web_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dapperauteur/go-base-service/foundation/web"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+// table implements CSVMarshaler.
+type table struct {
+	Name string `json:"name"`
+}
+
+func (t table) MarshalCSV() ([][]string, error) {
+	return [][]string{{"name"}, {t.Name}}, nil
+}
+
+func TestRespondNegotiation(t *testing.T) {
+	tt := []struct {
+		name   string
+		accept string
+		data   interface{}
+		ctype  string
+		body   string
+	}{
+		{"no accept", "", table{"a,b"}, "application/json", `{"name":"a,b"}`},
+		{"json", "application/json", table{"a,b"}, "application/json", `{"name":"a,b"}`},
+		{"csv", "text/csv", table{"a,b"}, "text/csv", "name\n\"a,b\"\n"},
+		{"csv in a list", "application/json;q=0.9, text/csv;q=0.5", table{"x"}, "text/csv", "name\nx\n"},
+		{"csv with params", "text/csv; charset=utf-8", table{"x"}, "text/csv", "name\nx\n"},
+		{"malformed part", "text/;;, text/csv", table{"x"}, "text/csv", "name\nx\n"},
+		{"csv unsupported", "text/csv", map[string]string{"name": "x"}, "application/json", `{"name":"x"}`},
+	}
+
+	t.Log("Given the need to honor the media type a client accepts.")
+	{
+		for testID, tst := range tt {
+			t.Logf("\tTest %d:\tWhen the Accept header is %q for %s.", testID, tst.accept, tst.name)
+			{
+				ctx := context.WithValue(context.Background(), web.KeyValues, &web.Values{Accept: tst.accept})
+				w := httptest.NewRecorder()
+
+				if err := web.Respond(ctx, w, tst.data, http.StatusOK); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to respond : %s.", failed, testID, err)
+				}
+
+				if got := w.Header().Get("Content-Type"); got != tst.ctype {
+					t.Fatalf("\t%s\tTest %d:\tShould get content type %s : got %s.", failed, testID, tst.ctype, got)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get content type %s.", success, testID, tst.ctype)
+
+				if got := w.Body.String(); got != tst.body {
+					t.Fatalf("\t%s\tTest %d:\tShould get the expected body : got %q, exp %q.", failed, testID, got, tst.body)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get the expected body.", success, testID)
+			}
+		}
+	}
+}
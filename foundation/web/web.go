@@ -8,6 +8,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/dapperauteur/go-base-service/foundation/logger"
 	"github.com/dimfeld/httptreemux/v5"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel/api/trace"
@@ -22,8 +23,10 @@ const KeyValues ctxKey = 1
 // Values represent state for each request.
 type Values struct {
 	TraceID    string
+	Route      string
 	Now        time.Time
 	StatusCode int
+	Accept     string
 }
 
 // A Handler is a type that handles an http request within our own little mini
@@ -92,10 +95,21 @@ func (a *App) Handle(method string, path string, handler Handler, mw ...Middlewa
 		// process the request.
 		v := Values{
 			TraceID: span.SpanContext().TraceID.String(),
+			Route:   path,
 			Now:     time.Now(),
+			Accept:  r.Header.Get("Accept"),
 		}
 		ctx = context.WithValue(ctx, KeyValues, &v)
 
+		// Tag every record logged while processing the request.
+		ctx = logger.NewContext(ctx)
+		logger.AddFields(ctx,
+			"trace_id", v.TraceID,
+			"span_id", span.SpanContext().SpanID.String(),
+			"method", r.Method,
+			"path", r.URL.Path,
+		)
+
 		// r is the readiness function in check.go (check.readiness)
 		if err := handler(ctx, w, r); err != nil {
 			// Handling error, can do more